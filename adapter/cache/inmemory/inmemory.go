@@ -0,0 +1,126 @@
+package inmemory
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/Meduzz/modulr"
+	"github.com/Meduzz/modulr/api"
+)
+
+type (
+	inmemoryBackend struct {
+		entries  map[string]*list.Element // service + key -> element in recent
+		recent   *list.List               // least recently used at the back
+		size     int64
+		maxBytes int64
+		lock     *sync.Mutex
+	}
+
+	item struct {
+		service string
+		key     string
+		entry   *api.CachedResponse
+		size    int64
+	}
+)
+
+// how much is kept by the backend registered by default
+const DefaultMaxBytes = 64 << 20
+
+func init() {
+	modulr.ResponseCache.SetBackend(NewInMemoryBackend(DefaultMaxBytes))
+}
+
+// NewInMemoryBackend - keeps responses in memory, dropping the least recently used when they take up more than maxBytes
+func NewInMemoryBackend(maxBytes int64) api.CacheBackend {
+	return &inmemoryBackend{
+		entries:  make(map[string]*list.Element),
+		recent:   list.New(),
+		maxBytes: maxBytes,
+		lock:     &sync.Mutex{},
+	}
+}
+
+func (i *inmemoryBackend) Get(service, key string) (*api.CachedResponse, error) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	element, ok := i.entries[service+" "+key]
+
+	if !ok {
+		return nil, nil
+	}
+
+	i.recent.MoveToFront(element)
+
+	return element.Value.(*item).entry, nil
+}
+
+func (i *inmemoryBackend) Set(service, key string, entry *api.CachedResponse) error {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	if element, ok := i.entries[service+" "+key]; ok {
+		i.remove(element)
+	}
+
+	it := &item{
+		service: service,
+		key:     key,
+		entry:   entry,
+		size:    sizeOf(key, entry),
+	}
+
+	// entries that could never fit are not kept at all
+	if it.size > i.maxBytes {
+		return nil
+	}
+
+	i.entries[service+" "+key] = i.recent.PushFront(it)
+	i.size += it.size
+
+	for i.size > i.maxBytes {
+		i.remove(i.recent.Back())
+	}
+
+	return nil
+}
+
+func (i *inmemoryBackend) Purge(service string) error {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	for element := i.recent.Front(); element != nil; {
+		next := element.Next()
+
+		if element.Value.(*item).service == service {
+			i.remove(element)
+		}
+
+		element = next
+	}
+
+	return nil
+}
+
+func (i *inmemoryBackend) remove(element *list.Element) {
+	it := i.recent.Remove(element).(*item)
+	delete(i.entries, it.service+" "+it.key)
+	i.size -= it.size
+}
+
+// sizeOf - roughly what an entry takes up, the body, headers and key
+func sizeOf(key string, entry *api.CachedResponse) int64 {
+	size := int64(len(key) + len(entry.Body))
+
+	for name, values := range entry.Header {
+		size += int64(len(name))
+
+		for _, value := range values {
+			size += int64(len(value))
+		}
+	}
+
+	return size
+}
@@ -0,0 +1,46 @@
+package inmemory
+
+import (
+	"testing"
+
+	"github.com/Meduzz/modulr/api"
+)
+
+func TestInMemoryBackend(t *testing.T) {
+	subject := NewInMemoryBackend(30)
+
+	entry := func(body string) *api.CachedResponse {
+		return &api.CachedResponse{Status: 200, Body: []byte(body)}
+	}
+
+	subject.Set("a", "1", entry("0123456789"))
+	subject.Set("a", "2", entry("0123456789"))
+
+	// 1 is used, which leaves 2 to be dropped
+	subject.Get("a", "1")
+	subject.Set("b", "3", entry("0123456789"))
+
+	if it, _ := subject.Get("a", "2"); it != nil {
+		t.Error("expected the least recently used entry to be dropped")
+	}
+
+	if it, _ := subject.Get("a", "1"); it == nil {
+		t.Error("expected a recently used entry to be kept")
+	}
+
+	subject.Set("b", "4", entry("this one is way too large to ever fit"))
+
+	if it, _ := subject.Get("b", "4"); it != nil {
+		t.Error("expected an entry larger than the backend to be skipped")
+	}
+
+	subject.Purge("a")
+
+	if it, _ := subject.Get("a", "1"); it != nil {
+		t.Error("expected the entries of a purged service to be dropped")
+	}
+
+	if it, _ := subject.Get("b", "3"); it == nil {
+		t.Error("expected the entries of other services to be kept")
+	}
+}
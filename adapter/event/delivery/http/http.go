@@ -7,26 +7,23 @@ import (
 	"github.com/Meduzz/helper/http/client"
 	"github.com/Meduzz/modulr"
 	"github.com/Meduzz/modulr/api"
+	"github.com/Meduzz/modulr/lib/transport"
 )
 
-type httpAdapter struct{}
+type httpAdapter struct {
+	transports *transport.Transports
+}
 
 func init() {
 	modulr.EventSupport.RegisterDeliverer("http", NewHttpDeliverer())
 }
 
 func NewHttpDeliverer() api.EventDeliveryAdapter {
-	return &httpAdapter{}
+	return &httpAdapter{transport.NewTransports(modulr.UpstreamTLS)}
 }
 
 func (h *httpAdapter) Deliver(service api.Service, sub *api.Subscription, body []byte) error {
-	url := ""
-
-	if service.GetPort() != 0 {
-		url = fmt.Sprintf("%s://%s:%d%s%s", service.GetScheme(), service.GetAddress(), service.GetPort(), service.GetContext(), sub.Path)
-	} else {
-		url = fmt.Sprintf("%s://%s%s%s", service.GetScheme(), service.GetAddress(), service.GetContext(), sub.Path)
-	}
+	url := fmt.Sprintf("%s://%s%s%s", transport.Scheme(service), transport.Host(service), service.GetContext(), sub.Path)
 
 	req, err := client.POSTBytes(url, body, "application/json")
 
@@ -38,7 +35,7 @@ func (h *httpAdapter) Deliver(service api.Service, sub *api.Subscription, body [
 		req.Header("Authorization", sub.Secret)
 	}
 
-	res, err := req.Do(http.DefaultClient)
+	res, err := req.Do(&http.Client{Transport: h.transports.For(service)})
 
 	if err != nil {
 		return err
@@ -1,7 +1,10 @@
 package event
 
 import (
+	"net"
+	"net/http"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/Meduzz/modulr/api"
@@ -122,3 +125,33 @@ func TestInvalidProtection(t *testing.T) {
 
 	sub.Secret = "top secret"
 }
+
+func TestUnixSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "test.sock")
+	listener, err := net.Listen("unix", socket)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go http.Serve(listener, srv)
+	defer listener.Close()
+
+	text := "so happy!"
+	expectedData = text
+	protected = false
+	unix := &api.DefaultService{
+		ID:            "1",
+		Name:          "test",
+		Address:       socket,
+		Type:          "http",
+		Scheme:        "unix",
+		Subscriptions: service.Subscriptions,
+	}
+
+	err = subject.Deliver(unix, unix.GetSubscriptions()[0], []byte(text))
+
+	if err != nil {
+		t.Error(err)
+	}
+}
@@ -21,6 +21,7 @@ func init() {
 
 	modulr.EventSupport.SetLoadBalancer(LoadBalancer)
 	modulr.HttpProxy.SetLoadBalancer(LoadBalancer)
+	modulr.Layer4Proxy.SetLoadBalancer(LoadBalancer)
 }
 
 // NewRoundRobin - creates a new in memory round robin load balancer
@@ -0,0 +1,236 @@
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/Meduzz/modulr"
+	"github.com/Meduzz/modulr/api"
+	"github.com/Meduzz/modulr/lib/transport"
+)
+
+type (
+	// client - makes unary grpc calls with raw payloads
+	client struct {
+		transports *transport.Transports
+	}
+
+	// Status - the grpc status of a call
+	Status struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+)
+
+// status codes from https://github.com/grpc/grpc/blob/master/doc/statuscodes.md
+const (
+	CodeOK                 = 0
+	CodeCanceled           = 1
+	CodeUnknown            = 2
+	CodeInvalidArgument    = 3
+	CodeDeadlineExceeded   = 4
+	CodeNotFound           = 5
+	CodeAlreadyExists      = 6
+	CodePermissionDenied   = 7
+	CodeResourceExhausted  = 8
+	CodeFailedPrecondition = 9
+	CodeAborted            = 10
+	CodeOutOfRange         = 11
+	CodeUnimplemented      = 12
+	CodeInternal           = 13
+	CodeUnavailable        = 14
+	CodeDataLoss           = 15
+	CodeUnauthenticated    = 16
+)
+
+// maxMessageSize - the largest message we take from a service, the default receive limit of grpc
+const maxMessageSize = 4 << 20
+
+var errTooLarge = fmt.Errorf("grpc message is larger than %d bytes", maxMessageSize)
+
+// transports - shared by the forwarder & reflection, so both reach services with the upstream tls settings
+var transports = transport.NewTransports(modulr.UpstreamTLS)
+
+func newClient() *client {
+	return &client{transports}
+}
+
+// transport - h2c unless the service wants https
+func (c *client) transport(service api.Service) http.RoundTripper {
+	return c.transports.H2(service)
+}
+
+// call - make a unary call, the payload is the serialized request message
+func (c *client) call(ctx context.Context, service api.Service, path string, payload []byte, header http.Header) ([]byte, *Status, error) {
+	target := fmt.Sprintf("%s://%s%s%s", scheme(service), transport.Host(service), service.GetContext(), path)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(frame(payload)))
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("Te", "trailers")
+
+	res, err := c.transport(service).RoundTrip(req)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, &Status{Code: fromHttp(res.StatusCode), Message: res.Status}, nil
+	}
+
+	// trailers only responses carry the status in the headers
+	if res.Header.Get("Grpc-Status") != "" {
+		return nil, status(res.Header), nil
+	}
+
+	body, err := readFrame(res.Body)
+
+	if err == errTooLarge {
+		return nil, &Status{Code: CodeResourceExhausted, Message: err.Error()}, nil
+	}
+
+	if err != nil && err != io.EOF {
+		return nil, nil, err
+	}
+
+	// drain the body to get to the trailers
+	_, err = io.Copy(io.Discard, res.Body)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return body, status(res.Trailer), nil
+}
+
+// scheme - http unless the service wants https, unix sockets speak h2c
+func scheme(service api.Service) string {
+	if transport.Scheme(service) == "https" {
+		return "https"
+	}
+
+	return "http"
+}
+
+func (s *Status) Error() string {
+	return fmt.Sprintf("grpc status %d: %s", s.Code, s.Message)
+}
+
+// HttpStatus - the http status closest to the grpc status
+func (s *Status) HttpStatus() int {
+	switch s.Code {
+	case CodeOK:
+		return http.StatusOK
+	case CodeCanceled:
+		return 499
+	case CodeInvalidArgument, CodeFailedPrecondition, CodeOutOfRange:
+		return http.StatusBadRequest
+	case CodeDeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case CodeNotFound:
+		return http.StatusNotFound
+	case CodeAlreadyExists, CodeAborted:
+		return http.StatusConflict
+	case CodePermissionDenied:
+		return http.StatusForbidden
+	case CodeResourceExhausted:
+		return http.StatusTooManyRequests
+	case CodeUnimplemented:
+		return http.StatusNotImplemented
+	case CodeUnavailable:
+		return http.StatusServiceUnavailable
+	case CodeUnauthenticated:
+		return http.StatusUnauthorized
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// fromHttp - grpc status for a non 200 http response, as described in https://github.com/grpc/grpc/blob/master/doc/http-grpc-status-mapping.md
+func fromHttp(code int) int {
+	switch code {
+	case http.StatusBadRequest:
+		return CodeInternal
+	case http.StatusUnauthorized:
+		return CodeUnauthenticated
+	case http.StatusForbidden:
+		return CodePermissionDenied
+	case http.StatusNotFound:
+		return CodeUnimplemented
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return CodeUnavailable
+	default:
+		return CodeUnknown
+	}
+}
+
+func status(header http.Header) *Status {
+	code, err := strconv.Atoi(header.Get("Grpc-Status"))
+
+	if err != nil {
+		return &Status{Code: CodeUnknown, Message: "missing grpc status"}
+	}
+
+	message, err := url.PathUnescape(header.Get("Grpc-Message"))
+
+	if err != nil {
+		message = header.Get("Grpc-Message")
+	}
+
+	return &Status{Code: code, Message: message}
+}
+
+// frame - uncompressed length prefixed message
+func frame(payload []byte) []byte {
+	framed := make([]byte, 5+len(payload))
+	binary.BigEndian.PutUint32(framed[1:5], uint32(len(payload)))
+	copy(framed[5:], payload)
+
+	return framed
+}
+
+// readFrame - reads one uncompressed message of at most maxMessageSize bytes
+func readFrame(reader io.Reader) ([]byte, error) {
+	prefix := make([]byte, 5)
+	_, err := io.ReadFull(reader, prefix)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if prefix[0] != 0 {
+		return nil, fmt.Errorf("compressed grpc messages are not supported")
+	}
+
+	size := binary.BigEndian.Uint32(prefix[1:5])
+
+	// the length is the word of the service, don't allocate whatever it says
+	if size > maxMessageSize {
+		return nil, errTooLarge
+	}
+
+	payload := make([]byte, size)
+	_, err = io.ReadFull(reader, payload)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return payload, nil
+}
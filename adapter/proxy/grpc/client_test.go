@@ -0,0 +1,32 @@
+package grpc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestReadFrame(t *testing.T) {
+	t.Run("messages are read", func(t *testing.T) {
+		payload, err := readFrame(bytes.NewReader(frame([]byte("hello"))))
+
+		if err != nil {
+			t.Errorf("There was an unexpected error: %v", err)
+		}
+
+		if string(payload) != "hello" {
+			t.Errorf("expected hello but got %s", string(payload))
+		}
+	})
+
+	t.Run("oversized messages are refused", func(t *testing.T) {
+		prefix := make([]byte, 5)
+		binary.BigEndian.PutUint32(prefix[1:5], 1<<31)
+
+		_, err := readFrame(bytes.NewReader(prefix))
+
+		if err != errTooLarge {
+			t.Errorf("expected the message to be too large but got %v", err)
+		}
+	})
+}
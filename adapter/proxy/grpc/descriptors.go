@@ -0,0 +1,298 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/Meduzz/modulr/api"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+type (
+	// DescriptorSource - finds the descriptors of grpc services
+	DescriptorSource interface {
+		// FindService - find a grpc service by its full name (package.Service) on an instance
+		FindService(context.Context, api.Service, string) (protoreflect.ServiceDescriptor, error)
+	}
+
+	// Descriptors - descriptor source that looks in registered descriptor sets first and asks the instance through server reflection second
+	Descriptors struct {
+		files     *protoregistry.Files
+		reflected map[string]map[string]*protoregistry.Files // service name & id -> grpc service -> files
+		lock      *sync.RWMutex
+		client    *client
+	}
+)
+
+// reflection services, v1 is tried before v1alpha
+var reflectionPaths = []string{
+	"/grpc.reflection.v1.ServerReflection/ServerReflectionInfo",
+	"/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo",
+}
+
+// NewDescriptors - creates an empty descriptor source
+func NewDescriptors() *Descriptors {
+	return &Descriptors{
+		files:     &protoregistry.Files{},
+		reflected: make(map[string]map[string]*protoregistry.Files),
+		lock:      &sync.RWMutex{},
+		client:    newClient(),
+	}
+}
+
+// LoadFile - register a descriptor set, as created by protoc --descriptor_set_out=<file> --include_imports
+func (d *Descriptors) LoadFile(path string) error {
+	bs, err := os.ReadFile(path)
+
+	if err != nil {
+		return err
+	}
+
+	set := &descriptorpb.FileDescriptorSet{}
+	err = proto.Unmarshal(bs, set)
+
+	if err != nil {
+		return err
+	}
+
+	return d.Add(set)
+}
+
+// Add - register a descriptor set
+func (d *Descriptors) Add(set *descriptorpb.FileDescriptorSet) error {
+	files, err := protodesc.NewFiles(set)
+
+	if err != nil {
+		return err
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	var failed error
+
+	files.RangeFiles(func(file protoreflect.FileDescriptor) bool {
+		_, err := d.files.FindFileByPath(file.Path())
+
+		if err == nil {
+			// already known, keep the first one
+			return true
+		}
+
+		failed = d.files.RegisterFile(file)
+
+		return failed == nil
+	})
+
+	return failed
+}
+
+func (d *Descriptors) FindService(ctx context.Context, service api.Service, name string) (protoreflect.ServiceDescriptor, error) {
+	d.lock.RLock()
+	found, err := findService(d.files, name)
+	reflected, ok := d.reflected[instanceKey(service)][name]
+	d.lock.RUnlock()
+
+	if err == nil {
+		return found, nil
+	}
+
+	if ok {
+		return findService(reflected, name)
+	}
+
+	reflected, err = d.reflect(ctx, service, name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	d.lock.Lock()
+	instance, ok := d.reflected[instanceKey(service)]
+
+	// instances can serve many grpc services, each is reflected on its own
+	if !ok {
+		instance = make(map[string]*protoregistry.Files)
+		d.reflected[instanceKey(service)] = instance
+	}
+
+	instance[name] = reflected
+	d.lock.Unlock()
+
+	return findService(reflected, name)
+}
+
+// Forget - drop what was learned about an instance through reflection
+func (d *Descriptors) Forget(service api.Service) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	delete(d.reflected, instanceKey(service))
+}
+
+// reflect - ask the instance for the file containing the service, and its dependencies
+func (d *Descriptors) reflect(ctx context.Context, service api.Service, name string) (*protoregistry.Files, error) {
+	// ServerReflectionRequest.file_containing_symbol = 4
+	request := protowire.AppendTag(nil, 4, protowire.BytesType)
+	request = protowire.AppendString(request, name)
+
+	var last error
+
+	for _, path := range reflectionPaths {
+		payload, status, err := d.client.call(ctx, service, path, request, nil)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if status.Code != CodeOK {
+			last = status
+			continue
+		}
+
+		files, err := parseReflection(payload)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return protodesc.NewFiles(&descriptorpb.FileDescriptorSet{File: files})
+	}
+
+	return nil, fmt.Errorf("server reflection failed for %s: %w", name, last)
+}
+
+// parseReflection - pick the file descriptors out of a ServerReflectionResponse
+func parseReflection(payload []byte) ([]*descriptorpb.FileDescriptorProto, error) {
+	files := make([]*descriptorpb.FileDescriptorProto, 0)
+
+	for len(payload) > 0 {
+		num, typ, n := protowire.ConsumeTag(payload)
+
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+
+		payload = payload[n:]
+
+		if typ != protowire.BytesType || (num != 4 && num != 7) {
+			n = protowire.ConsumeFieldValue(num, typ, payload)
+
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+
+			payload = payload[n:]
+			continue
+		}
+
+		value, n := protowire.ConsumeBytes(payload)
+
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+
+		payload = payload[n:]
+
+		// error_response = 7
+		if num == 7 {
+			return nil, fmt.Errorf("server reflection returned an error: %s", reflectionError(value))
+		}
+
+		// file_descriptor_response = 4, with repeated bytes file_descriptor_proto = 1
+		for len(value) > 0 {
+			num, typ, n := protowire.ConsumeTag(value)
+
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+
+			value = value[n:]
+
+			if num != 1 || typ != protowire.BytesType {
+				n = protowire.ConsumeFieldValue(num, typ, value)
+
+				if n < 0 {
+					return nil, protowire.ParseError(n)
+				}
+
+				value = value[n:]
+				continue
+			}
+
+			bs, n := protowire.ConsumeBytes(value)
+
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+
+			value = value[n:]
+
+			file := &descriptorpb.FileDescriptorProto{}
+			err := proto.Unmarshal(bs, file)
+
+			if err != nil {
+				return nil, err
+			}
+
+			files = append(files, file)
+		}
+	}
+
+	return files, nil
+}
+
+// reflectionError - the error_message = 2 of an ErrorResponse
+func reflectionError(value []byte) string {
+	for len(value) > 0 {
+		num, typ, n := protowire.ConsumeTag(value)
+
+		if n < 0 {
+			break
+		}
+
+		value = value[n:]
+
+		if num == 2 && typ == protowire.BytesType {
+			msg, _ := protowire.ConsumeString(value)
+			return msg
+		}
+
+		n = protowire.ConsumeFieldValue(num, typ, value)
+
+		if n < 0 {
+			break
+		}
+
+		value = value[n:]
+	}
+
+	return "unknown error"
+}
+
+func findService(files *protoregistry.Files, name string) (protoreflect.ServiceDescriptor, error) {
+	desc, err := files.FindDescriptorByName(protoreflect.FullName(name))
+
+	if err != nil {
+		return nil, err
+	}
+
+	service, ok := desc.(protoreflect.ServiceDescriptor)
+
+	if !ok {
+		return nil, fmt.Errorf("%s is not a service", name)
+	}
+
+	return service, nil
+}
+
+func instanceKey(service api.Service) string {
+	return fmt.Sprintf("%s.%s", service.GetName(), service.GetID())
+}
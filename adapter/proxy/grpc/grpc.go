@@ -0,0 +1,108 @@
+package grpc
+
+import (
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/Meduzz/modulr"
+	"github.com/Meduzz/modulr/api"
+	"github.com/Meduzz/modulr/lib/router"
+	"github.com/Meduzz/modulr/lib/transport"
+	"github.com/gin-gonic/gin"
+)
+
+type (
+	grpcproxy struct {
+		client      *client
+		descriptors DescriptorSource
+	}
+)
+
+// DefaultDescriptors - descriptors used by the registered grpc forwarder, register descriptor sets here
+var DefaultDescriptors = NewDescriptors()
+
+func init() {
+	modulr.HttpProxy.RegisterForwarder("grpc", NewGrpcForwarder(DefaultDescriptors))
+	modulr.ServiceRegistry.Plugin(&forgetter{DefaultDescriptors})
+}
+
+// NewGrpcForwarder - creates a forwarder for grpc services, talks h2c to services with scheme http.
+// Requests that are not grpc are transcoded from json to unary grpc calls, with the help of the descriptors.
+func NewGrpcForwarder(descriptors DescriptorSource) api.Forwarder {
+	return &grpcproxy{
+		client:      newClient(),
+		descriptors: descriptors,
+	}
+}
+
+// Handler - gin handler that sends grpc calls (/package.Service/Method) to the service named package.Service,
+// anything that is not grpc is passed on to the next handler.
+func Handler(proxy api.Proxy) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if !IsGrpcRequest(ctx.Request) {
+			ctx.Next()
+			return
+		}
+
+		parts := strings.Split(strings.TrimPrefix(ctx.Request.URL.Path, "/"), "/")
+
+		if len(parts) != 2 {
+			trailersOnly(ctx.Writer, &Status{Code: CodeUnimplemented, Message: "malformed method name"})
+			ctx.Abort()
+			return
+		}
+
+		handler, err := proxy.ForwarderFor(parts[0])
+
+		if err != nil {
+			trailersOnly(ctx.Writer, &Status{Code: CodeUnavailable, Message: err.Error()})
+			ctx.Abort()
+			return
+		}
+
+		handler(ctx)
+		ctx.Abort()
+	}
+}
+
+// IsGrpcRequest - grpc is http/2 posts with a grpc content type
+func IsGrpcRequest(req *http.Request) bool {
+	return req.ProtoMajor == 2 && strings.HasPrefix(req.Header.Get("Content-Type"), "application/grpc")
+}
+
+func (g *grpcproxy) Handler(service api.Service) gin.HandlerFunc {
+	proxy := &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			req.URL.Scheme = scheme(service)
+			req.URL.Host = transport.Host(service)
+
+			req.URL.Path = service.GetContext() + router.Path(req, service.GetName())
+			req.URL.RawPath = ""
+		},
+		Transport:     g.client.transport(service),
+		FlushInterval: -1,
+		ErrorHandler: func(w http.ResponseWriter, req *http.Request, err error) {
+			trailersOnly(w, &Status{Code: CodeUnavailable, Message: err.Error()})
+		},
+	}
+
+	return func(ctx *gin.Context) {
+		if IsGrpcRequest(ctx.Request) {
+			proxy.ServeHTTP(ctx.Writer, ctx.Request)
+			return
+		}
+
+		g.transcode(ctx, service)
+	}
+}
+
+// trailersOnly - a grpc error response without a body
+func trailersOnly(w http.ResponseWriter, status *Status) {
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Grpc-Status", strconv.Itoa(status.Code))
+	w.Header().Set("Grpc-Message", url.PathEscape(status.Message))
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,179 @@
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/Meduzz/modulr/api"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+type (
+	fakeProxy struct {
+		api.Proxy
+		forwarder api.Forwarder
+		service   api.Service
+	}
+)
+
+func TestGrpc(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	greeter := h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.ProtoMajor != 2 || req.URL.Path != "/test.Greeter/Hello" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		bs, _ := io.ReadAll(req.Body)
+
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status")
+		w.Write(bs)
+		w.Header().Set("Grpc-Status", "0")
+	}), &http2.Server{})
+
+	upstream := httptest.NewServer(greeter)
+	defer upstream.Close()
+
+	u, _ := url.Parse(upstream.URL)
+	port, _ := strconv.Atoi(u.Port())
+	service := &api.DefaultService{ID: "1", Name: "test.Greeter", Address: u.Hostname(), Port: port, Scheme: "http", Type: "grpc"}
+
+	engine := gin.New()
+	engine.UseH2C = true
+	engine.NoRoute(Handler(&fakeProxy{forwarder: NewGrpcForwarder(NewDescriptors()), service: service}), func(ctx *gin.Context) {
+		ctx.String(200, "not grpc")
+	})
+
+	proxy := httptest.NewServer(engine.Handler())
+	defer proxy.Close()
+
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+			return net.Dial(network, addr)
+		},
+	}}
+
+	t.Run("calls are forwarded with trailers", func(t *testing.T) {
+		res := call(t, client, proxy.URL+"/test.Greeter/Hello")
+		defer res.Body.Close()
+
+		bs, _ := io.ReadAll(res.Body)
+
+		if string(bs) != "hello" {
+			t.Errorf("expected hello but got %s", string(bs))
+		}
+
+		if res.Trailer.Get("Grpc-Status") != "0" {
+			t.Errorf("expected grpc status 0 but got %s", res.Trailer.Get("Grpc-Status"))
+		}
+	})
+
+	t.Run("malformed method", func(t *testing.T) {
+		res := call(t, client, proxy.URL+"/test.Greeter")
+		defer res.Body.Close()
+		io.ReadAll(res.Body)
+
+		if res.Header.Get("Grpc-Status") != "12" {
+			t.Errorf("expected grpc status 12 but got %s", res.Header.Get("Grpc-Status"))
+		}
+	})
+
+	t.Run("unavailable upstream", func(t *testing.T) {
+		down := &api.DefaultService{ID: "2", Name: "test.Greeter", Address: "127.0.0.1", Port: 1, Scheme: "http", Type: "grpc"}
+		engine := gin.New()
+		engine.UseH2C = true
+		engine.NoRoute(Handler(&fakeProxy{forwarder: NewGrpcForwarder(NewDescriptors()), service: down}))
+
+		proxy := httptest.NewServer(engine.Handler())
+		defer proxy.Close()
+
+		res := call(t, client, proxy.URL+"/test.Greeter/Hello")
+		defer res.Body.Close()
+		io.ReadAll(res.Body)
+
+		if res.Header.Get("Grpc-Status") != "14" {
+			t.Errorf("expected grpc status 14 but got %s", res.Header.Get("Grpc-Status"))
+		}
+	})
+
+	t.Run("unix sockets", func(t *testing.T) {
+		socket := filepath.Join(t.TempDir(), "greeter.sock")
+		listener, err := net.Listen("unix", socket)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		upstream := &http.Server{Handler: greeter}
+		go upstream.Serve(listener)
+		defer upstream.Close()
+
+		local := &api.DefaultService{ID: "3", Name: "test.Greeter", Address: socket, Scheme: "unix", Type: "grpc"}
+		engine := gin.New()
+		engine.UseH2C = true
+		engine.NoRoute(Handler(&fakeProxy{forwarder: NewGrpcForwarder(NewDescriptors()), service: local}))
+
+		proxy := httptest.NewServer(engine.Handler())
+		defer proxy.Close()
+
+		res := call(t, client, proxy.URL+"/test.Greeter/Hello")
+		defer res.Body.Close()
+
+		bs, _ := io.ReadAll(res.Body)
+
+		if string(bs) != "hello" || res.Trailer.Get("Grpc-Status") != "0" {
+			t.Errorf("expected hello with grpc status 0 but got %s %s", string(bs), res.Trailer.Get("Grpc-Status"))
+		}
+	})
+
+	t.Run("other requests are passed on", func(t *testing.T) {
+		res, err := http.Get(proxy.URL + "/something")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer res.Body.Close()
+		bs, _ := io.ReadAll(res.Body)
+
+		if string(bs) != "not grpc" {
+			t.Errorf("expected the next handler to answer but got %s", string(bs))
+		}
+	})
+}
+
+func call(t *testing.T, client *http.Client, url string) *http.Response {
+	req, _ := http.NewRequest("POST", url, bytes.NewReader([]byte("hello")))
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("Te", "trailers")
+
+	res, err := client.Do(req)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return res
+}
+
+func (f *fakeProxy) ForwarderFor(name string) (gin.HandlerFunc, error) {
+	if name != f.service.GetName() {
+		return gin.WrapF(http.NotFound), nil
+	}
+
+	return f.forwarder.Handler(f.service), nil
+}
@@ -0,0 +1,161 @@
+package grpc
+
+import (
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/Meduzz/modulr/api"
+	"github.com/Meduzz/modulr/lib/router"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+type (
+	// forgetter - drops reflected descriptors when instances come and go, and the transports of unix sockets that left
+	forgetter struct {
+		descriptors *Descriptors
+	}
+)
+
+// headers that are never passed on as grpc metadata
+var skippedHeaders = map[string]bool{
+	"Accept":            true,
+	"Accept-Encoding":   true,
+	"Connection":        true,
+	"Content-Length":    true,
+	"Content-Type":      true,
+	"Host":              true,
+	"Keep-Alive":        true,
+	"Te":                true,
+	"Trailer":           true,
+	"Transfer-Encoding": true,
+	"Upgrade":           true,
+}
+
+// transcode - turn a json call to /<Method> or /<package.Service>/<Method> into a unary grpc call
+func (g *grpcproxy) transcode(ctx *gin.Context, service api.Service) {
+	if ctx.Request.Method != http.MethodPost && ctx.Request.Method != http.MethodGet {
+		fail(ctx, &Status{Code: CodeUnimplemented, Message: "only GET & POST are supported"})
+		return
+	}
+
+	parts := strings.Split(strings.Trim(router.Path(ctx.Request, service.GetName()), "/"), "/")
+	name := service.GetName()
+	method := parts[0]
+
+	if len(parts) == 2 {
+		name = parts[0]
+		method = parts[1]
+	} else if len(parts) != 1 || method == "" {
+		fail(ctx, &Status{Code: CodeNotFound, Message: "expected /<Method> or /<package.Service>/<Method>"})
+		return
+	}
+
+	desc, err := g.descriptors.FindService(ctx.Request.Context(), service, name)
+
+	if err != nil {
+		fail(ctx, &Status{Code: CodeNotFound, Message: err.Error()})
+		return
+	}
+
+	md := desc.Methods().ByName(protoreflect.Name(method))
+
+	if md == nil {
+		fail(ctx, &Status{Code: CodeNotFound, Message: "no method named " + method + " in " + name})
+		return
+	}
+
+	if md.IsStreamingClient() || md.IsStreamingServer() {
+		fail(ctx, &Status{Code: CodeUnimplemented, Message: "streaming methods can not be transcoded"})
+		return
+	}
+
+	body, err := io.ReadAll(ctx.Request.Body)
+
+	if err != nil {
+		fail(ctx, &Status{Code: CodeInvalidArgument, Message: err.Error()})
+		return
+	}
+
+	input := dynamicpb.NewMessage(md.Input())
+
+	if len(body) > 0 {
+		err = protojson.Unmarshal(body, input)
+
+		if err != nil {
+			fail(ctx, &Status{Code: CodeInvalidArgument, Message: err.Error()})
+			return
+		}
+	}
+
+	payload, err := proto.Marshal(input)
+
+	if err != nil {
+		fail(ctx, &Status{Code: CodeInternal, Message: err.Error()})
+		return
+	}
+
+	metadata := make(http.Header)
+
+	for key, values := range ctx.Request.Header {
+		if !skippedHeaders[key] && !strings.HasPrefix(key, "Grpc-") {
+			metadata[key] = values
+		}
+	}
+
+	reply, status, err := g.client.call(ctx.Request.Context(), service, "/"+name+"/"+method, payload, metadata)
+
+	if err != nil {
+		fail(ctx, &Status{Code: CodeUnavailable, Message: err.Error()})
+		return
+	}
+
+	if status.Code != CodeOK {
+		fail(ctx, status)
+		return
+	}
+
+	output := dynamicpb.NewMessage(md.Output())
+	err = proto.Unmarshal(reply, output)
+
+	if err != nil {
+		fail(ctx, &Status{Code: CodeInternal, Message: err.Error()})
+		return
+	}
+
+	bs, err := protojson.Marshal(output)
+
+	if err != nil {
+		fail(ctx, &Status{Code: CodeInternal, Message: err.Error()})
+		return
+	}
+
+	ctx.Data(http.StatusOK, "application/json", bs)
+}
+
+func fail(ctx *gin.Context, status *Status) {
+	ctx.AbortWithStatusJSON(status.HttpStatus(), status)
+}
+
+func (f *forgetter) RegisterService(service api.Service) error {
+	return nil
+}
+
+func (f *forgetter) DeregisterService(service api.Service) error {
+	return nil
+}
+
+func (f *forgetter) RegisterInstance(service api.Service) error {
+	f.descriptors.Forget(service)
+	return nil
+}
+
+func (f *forgetter) DeregisterInstance(service api.Service) error {
+	transports.Forget(service)
+	f.descriptors.Forget(service)
+	return nil
+}
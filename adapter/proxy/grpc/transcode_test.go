@@ -0,0 +1,295 @@
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/Meduzz/modulr/api"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+var greeterFile = &descriptorpb.FileDescriptorProto{
+	Name:    proto.String("greeter.proto"),
+	Package: proto.String("test"),
+	Syntax:  proto.String("proto3"),
+	MessageType: []*descriptorpb.DescriptorProto{
+		{
+			Name: proto.String("HelloRequest"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				{Name: proto.String("name"), JsonName: proto.String("name"), Number: proto.Int32(1), Type: descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(), Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()},
+			},
+		},
+		{
+			Name: proto.String("HelloReply"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				{Name: proto.String("message"), JsonName: proto.String("message"), Number: proto.Int32(1), Type: descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(), Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()},
+			},
+		},
+	},
+	Service: []*descriptorpb.ServiceDescriptorProto{
+		{
+			Name: proto.String("Greeter"),
+			Method: []*descriptorpb.MethodDescriptorProto{
+				{Name: proto.String("Hello"), InputType: proto.String(".test.HelloRequest"), OutputType: proto.String(".test.HelloReply")},
+				{Name: proto.String("Chat"), InputType: proto.String(".test.HelloRequest"), OutputType: proto.String(".test.HelloReply"), ServerStreaming: proto.Bool(true)},
+			},
+		},
+	},
+}
+
+// echoFile - a second grpc service on the same instance as the greeter
+var echoFile = &descriptorpb.FileDescriptorProto{
+	Name:       proto.String("echo.proto"),
+	Package:    proto.String("test"),
+	Syntax:     proto.String("proto3"),
+	Dependency: []string{"greeter.proto"},
+	Service: []*descriptorpb.ServiceDescriptorProto{
+		{
+			Name: proto.String("Echo"),
+			Method: []*descriptorpb.MethodDescriptorProto{
+				{Name: proto.String("Echo"), InputType: proto.String(".test.HelloRequest"), OutputType: proto.String(".test.HelloReply")},
+			},
+		},
+	},
+}
+
+func TestTranscoding(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	upstream := httptest.NewServer(h2c.NewHandler(greeter(t, true), &http2.Server{}))
+	defer upstream.Close()
+
+	service := serviceFor(upstream.URL)
+	engine := gin.New()
+	engine.Any("/call/test.Greeter/*path", NewGrpcForwarder(NewDescriptors()).Handler(service))
+
+	proxy := httptest.NewServer(engine)
+	defer proxy.Close()
+
+	t.Run("through reflection", func(t *testing.T) {
+		code, body := post(t, proxy.URL+"/call/test.Greeter/Hello", `{"name":"world"}`)
+
+		if code != 200 {
+			t.Errorf("expected 200 but got %d", code)
+		}
+
+		if body != `{"message":"Hello world"}` {
+			t.Errorf("unexpected body %s", body)
+		}
+	})
+
+	t.Run("with the grpc service in the path", func(t *testing.T) {
+		code, body := post(t, proxy.URL+"/call/test.Greeter/test.Greeter/Hello", `{"name":"you"}`)
+
+		if code != 200 {
+			t.Errorf("expected 200 but got %d", code)
+		}
+
+		if body != `{"message":"Hello you"}` {
+			t.Errorf("unexpected body %s", body)
+		}
+	})
+
+	t.Run("grpc errors are mapped", func(t *testing.T) {
+		code, _ := post(t, proxy.URL+"/call/test.Greeter/Hello", `{}`)
+
+		if code != 400 {
+			t.Errorf("expected 400 but got %d", code)
+		}
+	})
+
+	t.Run("invalid json", func(t *testing.T) {
+		code, _ := post(t, proxy.URL+"/call/test.Greeter/Hello", `{"nope":1}`)
+
+		if code != 400 {
+			t.Errorf("expected 400 but got %d", code)
+		}
+	})
+
+	t.Run("unknown method", func(t *testing.T) {
+		code, _ := post(t, proxy.URL+"/call/test.Greeter/Goodbye", `{}`)
+
+		if code != 404 {
+			t.Errorf("expected 404 but got %d", code)
+		}
+	})
+
+	t.Run("streaming method", func(t *testing.T) {
+		code, _ := post(t, proxy.URL+"/call/test.Greeter/Chat", `{}`)
+
+		if code != 501 {
+			t.Errorf("expected 501 but got %d", code)
+		}
+	})
+}
+
+func TestDescriptorSet(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	upstream := httptest.NewServer(h2c.NewHandler(greeter(t, false), &http2.Server{}))
+	defer upstream.Close()
+
+	service := serviceFor(upstream.URL)
+	descriptors := NewDescriptors()
+
+	engine := gin.New()
+	engine.Any("/call/test.Greeter/*path", NewGrpcForwarder(descriptors).Handler(service))
+
+	proxy := httptest.NewServer(engine)
+	defer proxy.Close()
+
+	t.Run("without reflection or descriptors", func(t *testing.T) {
+		code, _ := post(t, proxy.URL+"/call/test.Greeter/Hello", `{"name":"world"}`)
+
+		if code != 404 {
+			t.Errorf("expected 404 but got %d", code)
+		}
+	})
+
+	t.Run("with descriptor set", func(t *testing.T) {
+		bs, _ := proto.Marshal(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{greeterFile}})
+		file := filepath.Join(t.TempDir(), "greeter.pb")
+		os.WriteFile(file, bs, 0644)
+
+		err := descriptors.LoadFile(file)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		code, body := post(t, proxy.URL+"/call/test.Greeter/Hello", `{"name":"world"}`)
+
+		if code != 200 {
+			t.Errorf("expected 200 but got %d", code)
+		}
+
+		if body != `{"message":"Hello world"}` {
+			t.Errorf("unexpected body %s", body)
+		}
+	})
+}
+
+func TestReflectionPerService(t *testing.T) {
+	upstream := httptest.NewServer(h2c.NewHandler(greeter(t, true), &http2.Server{}))
+	defer upstream.Close()
+
+	service := serviceFor(upstream.URL)
+	subject := NewDescriptors()
+
+	for _, name := range []string{"test.Greeter", "test.Echo"} {
+		found, err := subject.FindService(context.Background(), service, name)
+
+		if err != nil {
+			t.Fatalf("There was an unexpected error: %v", err)
+		}
+
+		if string(found.FullName()) != name {
+			t.Errorf("expected %s but got %s", name, found.FullName())
+		}
+	}
+}
+
+// greeter - fake grpc server, with v1alpha reflection if asked to. Reflection answers with the file of the symbol asked for.
+func greeter(t *testing.T, reflection bool) http.Handler {
+	file, err := protodesc.NewFile(greeterFile, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service := file.Services().ByName("Greeter")
+	input := service.Methods().ByName("Hello").Input()
+	output := service.Methods().ByName("Hello").Output()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		payload, _ := readFrame(req.Body)
+
+		switch {
+		case req.URL.Path == "/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo" && reflection:
+			found := []*descriptorpb.FileDescriptorProto{greeterFile}
+
+			if bytes.Contains(payload, []byte("test.Echo")) {
+				found = append(found, echoFile)
+			}
+
+			files := make([]byte, 0)
+
+			for _, it := range found {
+				bs, _ := proto.Marshal(it)
+				files = protowire.AppendTag(files, 1, protowire.BytesType)
+				files = protowire.AppendBytes(files, bs)
+			}
+
+			res := protowire.AppendTag(nil, 4, protowire.BytesType)
+			res = protowire.AppendBytes(res, files)
+
+			reply(w, res, "0", "")
+		case req.URL.Path == "/test.Greeter/Hello":
+			msg := dynamicpb.NewMessage(input)
+			proto.Unmarshal(payload, msg)
+			name := msg.Get(input.Fields().ByName("name")).String()
+
+			if name == "" {
+				reply(w, nil, "3", "name is required")
+				return
+			}
+
+			res := dynamicpb.NewMessage(output)
+			res.Set(output.Fields().ByName("message"), protoreflect.ValueOfString("Hello "+name))
+			bs, _ := proto.Marshal(res)
+
+			reply(w, bs, "0", "")
+		default:
+			w.Header().Set("Content-Type", "application/grpc")
+			w.Header().Set("Grpc-Status", "12")
+		}
+	})
+}
+
+func reply(w http.ResponseWriter, payload []byte, status, message string) {
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+
+	if payload != nil {
+		w.Write(frame(payload))
+	}
+
+	w.Header().Set("Grpc-Status", status)
+	w.Header().Set("Grpc-Message", message)
+}
+
+func serviceFor(raw string) *api.DefaultService {
+	u, _ := url.Parse(raw)
+	port, _ := strconv.Atoi(u.Port())
+
+	return &api.DefaultService{ID: "1", Name: "test.Greeter", Address: u.Hostname(), Port: port, Scheme: "http", Type: "grpc"}
+}
+
+func post(t *testing.T, url, body string) (int, string) {
+	res, err := http.Post(url, "application/json", bytes.NewReader([]byte(body)))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer res.Body.Close()
+	bs, _ := io.ReadAll(res.Body)
+
+	return res.StatusCode, string(bs)
+}
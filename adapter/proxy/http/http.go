@@ -1,18 +1,31 @@
 package http
 
 import (
+	"context"
 	"fmt"
+	"log"
 	"net/http"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/Meduzz/modulr"
 	"github.com/Meduzz/modulr/api"
+	"github.com/Meduzz/modulr/lib/router"
+	"github.com/Meduzz/modulr/lib/transform"
+	"github.com/Meduzz/modulr/lib/transport"
 	"github.com/gin-gonic/gin"
 	"github.com/vulcand/oxy/forward"
 )
 
 type (
-	httpproxy struct{}
+	httpproxy struct {
+		idleTimeout time.Duration
+		streams     map[string]map[*stream]bool // service name & id -> open streams
+		transports  *transport.Transports
+		transformer api.Transformer
+		lock        *sync.Mutex
+	}
 
 	rewriter struct {
 		service api.Service
@@ -21,31 +34,185 @@ type (
 	chained struct {
 		rewriters []forward.ReqRewriter
 	}
+
+	// responseModifier - the response side of the pipeline, changes responses before they're passed on to the caller
+	responseModifier interface {
+		Modify(*http.Response) error
+	}
+
+	chainedModifiers struct {
+		modifiers []responseModifier
+	}
+
+	// transforming - applies the transformations of the service to requests & responses
+	transforming struct {
+		service     api.Service
+		transformer api.Transformer
+	}
+
+	// Option - configures the http forwarder
+	Option func(*httpproxy)
 )
 
 func init() {
-	modulr.HttpProxy.RegisterForwarder("http", NewHttpForwarder())
+	forwarder := NewHttpForwarder()
+
+	modulr.HttpProxy.RegisterForwarder("http", forwarder)
+	modulr.ServiceRegistry.Plugin(forwarder.(api.Lifecycle))
+}
+
+// NewHttpForwarder - creates a forwarder for http services, that also handles websockets & server sent events
+func NewHttpForwarder(options ...Option) api.Forwarder {
+	h := &httpproxy{
+		idleTimeout: 5 * time.Minute,
+		streams:     make(map[string]map[*stream]bool),
+		transports:  transport.NewTransports(modulr.UpstreamTLS),
+		transformer: modulr.Transformer,
+		lock:        &sync.Mutex{},
+	}
+
+	for _, option := range options {
+		option(h)
+	}
+
+	return h
+}
+
+// UpstreamTLS - use these tls settings to reach services, instead of modulr.UpstreamTLS
+func UpstreamTLS(upstreamTLS api.UpstreamTLS) Option {
+	return func(h *httpproxy) {
+		h.transports = transport.NewTransports(upstreamTLS)
+	}
+}
+
+// Transformer - use these transformations of requests & responses, instead of modulr.Transformer
+func Transformer(transformer api.Transformer) Option {
+	return func(h *httpproxy) {
+		h.transformer = transformer
+	}
 }
 
-func NewHttpForwarder() api.Forwarder {
-	return &httpproxy{}
+// IdleTimeout - close websockets & event streams that has not seen any traffic for this long, 0 disables it
+func IdleTimeout(timeout time.Duration) Option {
+	return func(h *httpproxy) {
+		h.idleTimeout = timeout
+	}
 }
 
 func (h *httpproxy) Handler(service api.Service) gin.HandlerFunc {
 	// TODO circuitbreaker?
 	// TODO retries?
-	handler, err := forward.New(forward.Rewriter(chainedRewriters(&rewriter{service})), forward.PassHostHeader(true))
+	// event streams & chunked responses are flushed on every write by the underlying reverse proxy
+	transforming := &transforming{service, h.transformer}
+	rewriters := chainedRewriters(&rewriter{service}, transforming)
+	websockets := &websockets{rewriters}
+
+	handler, err := forward.New(
+		forward.Rewriter(rewriters),
+		forward.ResponseModifier(chainedResponseModifiers(transforming).Modify),
+		forward.RoundTripper(h.transports.For(service)),
+		forward.PassHostHeader(true))
 
 	if err != nil {
 		return nil
 	}
 
-	return gin.WrapF(handler.ServeHTTP)
+	return func(ctx *gin.Context) {
+		if !isStream(ctx.Request) {
+			handler.ServeHTTP(ctx.Writer, ctx.Request)
+			return
+		}
+
+		reqCtx, cancel := context.WithCancel(ctx.Request.Context())
+		defer cancel()
+
+		s := newStream(ctx.Writer, cancel, h.idleTimeout)
+		defer s.stop()
+
+		key := streamKey(service)
+		h.track(key, s)
+		defer h.untrack(key, s)
+
+		if forward.IsWebsocketRequest(ctx.Request) {
+			websockets.ServeHTTP(s, ctx.Request.WithContext(h.transports.WithService(reqCtx, service)))
+			return
+		}
+
+		handler.ServeHTTP(s, ctx.Request.WithContext(reqCtx))
+	}
+}
+
+func (h *httpproxy) RegisterService(service api.Service) error {
+	return nil
+}
+
+func (h *httpproxy) DeregisterService(service api.Service) error {
+	return nil
+}
+
+func (h *httpproxy) RegisterInstance(service api.Service) error {
+	return nil
+}
+
+// DeregisterInstance - closes all open streams to the instance
+func (h *httpproxy) DeregisterInstance(service api.Service) error {
+	h.transports.Forget(service)
+
+	h.lock.Lock()
+	streams := h.streams[streamKey(service)]
+	delete(h.streams, streamKey(service))
+	h.lock.Unlock()
+
+	for s := range streams {
+		s.close()
+	}
+
+	return nil
+}
+
+func (h *httpproxy) track(key string, s *stream) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	streams, ok := h.streams[key]
+
+	if !ok {
+		streams = make(map[*stream]bool)
+		h.streams[key] = streams
+	}
+
+	streams[s] = true
 }
 
-func chainedRewriters(rewriter forward.ReqRewriter) forward.ReqRewriter {
+func (h *httpproxy) untrack(key string, s *stream) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	streams, ok := h.streams[key]
+
+	if !ok {
+		return
+	}
+
+	delete(streams, s)
+
+	if len(streams) == 0 {
+		delete(h.streams, key)
+	}
+}
+
+func streamKey(service api.Service) string {
+	return fmt.Sprintf("%s.%s", service.GetName(), service.GetID())
+}
+
+// isStream - websockets & event streams are long lived and tracked
+func isStream(req *http.Request) bool {
+	return forward.IsWebsocketRequest(req) || strings.Contains(req.Header.Get("Accept"), "text/event-stream")
+}
+
+func chainedRewriters(rewriters ...forward.ReqRewriter) forward.ReqRewriter {
 	list := make([]forward.ReqRewriter, 0)
-	list = append(list, rewriter)
+	list = append(list, rewriters...)
 	list = append(list, &forward.HeaderRewriter{
 		TrustForwardHeader: false,
 		Hostname:           ""})
@@ -57,15 +224,18 @@ func chainedRewriters(rewriter forward.ReqRewriter) forward.ReqRewriter {
 
 // Host/Path request rewriter.
 func (r *rewriter) Rewrite(req *http.Request) {
-	req.URL.RawPath = strings.Replace(req.URL.RawPath, fmt.Sprintf("/call/%s", r.service.GetName()), r.service.GetContext(), 1)
-	req.URL.Path = strings.Replace(req.URL.Path, fmt.Sprintf("/call/%s", r.service.GetName()), r.service.GetContext(), 1)
-	req.URL.Scheme = r.service.GetScheme()
+	match := router.MatchFrom(req.Context())
 
-	if r.service.GetPort() != 0 {
-		req.URL.Host = fmt.Sprintf("%s:%d", r.service.GetAddress(), r.service.GetPort())
+	if match != nil {
+		req.URL.RawPath = ""
+		req.URL.Path = r.service.GetContext() + match.Path
 	} else {
-		req.URL.Host = r.service.GetAddress()
+		req.URL.RawPath = strings.Replace(req.URL.RawPath, fmt.Sprintf("/call/%s", r.service.GetName()), r.service.GetContext(), 1)
+		req.URL.Path = strings.Replace(req.URL.Path, fmt.Sprintf("/call/%s", r.service.GetName()), r.service.GetContext(), 1)
 	}
+
+	req.URL.Scheme = transport.Scheme(r.service)
+	req.URL.Host = transport.Host(r.service)
 }
 
 // Chained request rewriter
@@ -74,3 +244,62 @@ func (c *chained) Rewrite(req *http.Request) {
 		r.Rewrite(req)
 	}
 }
+
+func chainedResponseModifiers(modifiers ...responseModifier) *chainedModifiers {
+	return &chainedModifiers{
+		modifiers: modifiers,
+	}
+}
+
+// Chained response modifier, the first error stops the chain and fails the request
+func (c *chainedModifiers) Modify(res *http.Response) error {
+	for _, m := range c.modifiers {
+		err := m.Modify(res)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Transforming request rewriter, bodies that can't be rewritten are passed on as they were
+func (t *transforming) Rewrite(req *http.Request) {
+	if t.transformer == nil {
+		return
+	}
+
+	for _, it := range t.transformer.For(t.service.GetName(), req) {
+		if it.Request == nil {
+			continue
+		}
+
+		err := transform.Request(req, t.service, it.Request)
+
+		if err != nil {
+			log.Printf("Transforming request to %s with %s threw error: %v\n", t.service.GetName(), it.Name, err)
+		}
+	}
+}
+
+// Transforming response modifier, bodies that can't be rewritten are passed on as they were
+func (t *transforming) Modify(res *http.Response) error {
+	if t.transformer == nil || res.Request == nil {
+		return nil
+	}
+
+	for _, it := range t.transformer.For(t.service.GetName(), res.Request) {
+		if it.Response == nil {
+			continue
+		}
+
+		err := transform.Response(res, t.service, it.Response)
+
+		if err != nil {
+			log.Printf("Transforming response from %s with %s threw error: %v\n", t.service.GetName(), it.Name, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,433 @@
+package http
+
+import (
+	"bufio"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Meduzz/modulr/api"
+	"github.com/Meduzz/modulr/lib/transform"
+	"github.com/Meduzz/modulr/lib/transport"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+func TestWebsocket(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(echo))
+	defer upstream.Close()
+
+	subject := NewHttpForwarder(IdleTimeout(200 * time.Millisecond))
+	service := serviceFor(upstream.URL)
+	proxy := proxyFor(subject, service)
+	defer proxy.Close()
+
+	t.Run("messages are forwarded", func(t *testing.T) {
+		conn := dial(t, proxy.URL)
+		defer conn.Close()
+
+		conn.WriteMessage(websocket.TextMessage, []byte("hello"))
+		_, msg, err := conn.ReadMessage()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(msg) != "hello" {
+			t.Errorf("expected hello but got %s", string(msg))
+		}
+	})
+
+	t.Run("idle connections are closed", func(t *testing.T) {
+		conn := dial(t, proxy.URL)
+		defer conn.Close()
+
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, _, err := conn.ReadMessage()
+
+		if err == nil {
+			t.Error("expected the connection to be closed")
+		}
+
+		if strings.Contains(err.Error(), "timeout") {
+			t.Errorf("the proxy never closed the connection: %v", err)
+		}
+	})
+
+	t.Run("deregistering the instance closes connections", func(t *testing.T) {
+		conn := dial(t, proxy.URL)
+		defer conn.Close()
+
+		conn.WriteMessage(websocket.TextMessage, []byte("hello"))
+		conn.ReadMessage()
+
+		subject.(api.Lifecycle).DeregisterInstance(service)
+
+		conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		_, _, err := conn.ReadMessage()
+
+		if err == nil {
+			t.Error("expected the connection to be closed")
+		}
+
+		if strings.Contains(err.Error(), "timeout") {
+			t.Errorf("the proxy never closed the connection: %v", err)
+		}
+	})
+}
+
+func TestServerSentEvents(t *testing.T) {
+	release := make(chan bool)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: first\n\n")
+		w.(http.Flusher).Flush()
+
+		select {
+		case <-release:
+			fmt.Fprint(w, "data: second\n\n")
+		case <-req.Context().Done():
+		}
+	}))
+	defer upstream.Close()
+
+	subject := NewHttpForwarder(IdleTimeout(200 * time.Millisecond))
+	service := serviceFor(upstream.URL)
+	proxy := proxyFor(subject, service)
+	defer proxy.Close()
+
+	t.Run("events are flushed", func(t *testing.T) {
+		res := events(t, proxy.URL)
+		defer res.Body.Close()
+
+		reader := bufio.NewReader(res.Body)
+		line, err := reader.ReadString('\n')
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if line != "data: first\n" {
+			t.Errorf("expected the first event but got %s", line)
+		}
+
+		release <- true
+		reader.ReadString('\n')
+		line, _ = reader.ReadString('\n')
+
+		if line != "data: second\n" {
+			t.Errorf("expected the second event but got %s", line)
+		}
+	})
+
+	t.Run("idle streams are closed", func(t *testing.T) {
+		res := events(t, proxy.URL)
+		defer res.Body.Close()
+
+		done := make(chan bool)
+
+		go func() {
+			bufio.NewReader(res.Body).ReadString('x')
+			done <- true
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			t.Error("the stream was never closed")
+		}
+	})
+
+	t.Run("deregistering the instance closes streams", func(t *testing.T) {
+		res := events(t, proxy.URL)
+		defer res.Body.Close()
+
+		reader := bufio.NewReader(res.Body)
+		reader.ReadString('\n')
+
+		done := make(chan bool)
+
+		go func() {
+			reader.ReadString('x')
+			done <- true
+		}()
+
+		subject.(api.Lifecycle).DeregisterInstance(service)
+
+		select {
+		case <-done:
+		case <-time.After(150 * time.Millisecond):
+			t.Error("the stream was never closed")
+		}
+	})
+}
+
+func TestUnixSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "test.sock")
+	listener, err := net.Listen("unix", socket)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/ws" {
+			echo(w, req)
+			return
+		}
+
+		fmt.Fprintf(w, "%s from the socket", req.URL.Path)
+	}))
+	upstream.Listener = listener
+	upstream.Start()
+	defer upstream.Close()
+
+	subject := NewHttpForwarder()
+	service := &api.DefaultService{ID: "1", Name: "test", Address: socket, Scheme: "unix", Type: "http"}
+	proxy := proxyFor(subject, service)
+	defer proxy.Close()
+
+	t.Run("requests are forwarded", func(t *testing.T) {
+		res, err := http.Get(proxy.URL + "/call/test/hello")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer res.Body.Close()
+		bs, _ := io.ReadAll(res.Body)
+
+		if string(bs) != "/hello from the socket" {
+			t.Errorf("unexpected body %s", string(bs))
+		}
+	})
+
+	t.Run("websockets are forwarded", func(t *testing.T) {
+		conn := dial(t, proxy.URL)
+		defer conn.Close()
+
+		conn.WriteMessage(websocket.TextMessage, []byte("hello"))
+		_, msg, err := conn.ReadMessage()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(msg) != "hello" {
+			t.Errorf("expected hello but got %s", string(msg))
+		}
+	})
+}
+
+func TestTransformations(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/old" {
+			http.Redirect(w, req, "/new", http.StatusFound)
+			return
+		}
+
+		bs, _ := io.ReadAll(req.Body)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Internal", "yes")
+		fmt.Fprintf(w, `{"data":{"instance":%q,"body":%s}}`, req.Header.Get("X-Instance"), string(bs))
+	}))
+	defer upstream.Close()
+
+	transformer := transform.NewTransformer()
+	transformer.Set(&api.Transformation{
+		Name:    "envelopes",
+		Service: "test",
+		Request: &api.Transform{
+			InstanceHeader: "X-Instance",
+			WrapBody:       "payload",
+		},
+		Response: &api.Transform{
+			RemoveHeaders:   []string{"X-Internal"},
+			UnwrapBody:      "data",
+			RewriteLocation: true,
+		},
+	})
+
+	subject := NewHttpForwarder(Transformer(transformer))
+	proxy := proxyFor(subject, serviceFor(upstream.URL))
+	defer proxy.Close()
+
+	t.Run("bodies & headers", func(t *testing.T) {
+		res, err := http.Post(proxy.URL+"/call/test/things", "application/json", strings.NewReader(`{"a":1}`))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer res.Body.Close()
+		bs, _ := io.ReadAll(res.Body)
+
+		if string(bs) != `{"instance":"1","body":{"payload":{"a":1}}}` {
+			t.Errorf("unexpected body %s", string(bs))
+		}
+
+		if res.Header.Get("X-Internal") != "" {
+			t.Error("expected the header to be removed")
+		}
+	})
+
+	t.Run("redirects", func(t *testing.T) {
+		client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}}
+
+		res, err := client.Get(proxy.URL + "/call/test/old")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res.Body.Close()
+
+		if res.Header.Get("Location") != "/call/test/new" {
+			t.Errorf("expected the redirect to go through the proxy but got %s", res.Header.Get("Location"))
+		}
+	})
+}
+
+func TestUpstreamTLS(t *testing.T) {
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/ws" {
+			echo(w, req)
+			return
+		}
+
+		fmt.Fprintf(w, "%s over %s", req.URL.Path, req.TLS.ServerName)
+	}))
+	defer upstream.Close()
+
+	ca := filepath.Join(t.TempDir(), "ca.pem")
+	os.WriteFile(ca, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: upstream.Certificate().Raw}), 0600)
+
+	settings := transport.NewUpstreamTLS()
+	err := settings.Set(&api.TLSSettings{Service: "test", CA: ca, ServerName: "example.com"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subject := NewHttpForwarder(UpstreamTLS(settings))
+	service := serviceFor(upstream.URL)
+	service.Scheme = "https"
+	proxy := proxyFor(subject, service)
+	defer proxy.Close()
+
+	t.Run("requests are forwarded", func(t *testing.T) {
+		res, err := http.Get(proxy.URL + "/call/test/hello")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer res.Body.Close()
+		bs, _ := io.ReadAll(res.Body)
+
+		if string(bs) != "/hello over example.com" {
+			t.Errorf("unexpected body %s", string(bs))
+		}
+	})
+
+	t.Run("websockets are forwarded", func(t *testing.T) {
+		conn := dial(t, proxy.URL)
+		defer conn.Close()
+
+		conn.WriteMessage(websocket.TextMessage, []byte("hello"))
+		_, msg, err := conn.ReadMessage()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(msg) != "hello" {
+			t.Errorf("expected hello but got %s", string(msg))
+		}
+	})
+
+	t.Run("the default dialer is left alone", func(t *testing.T) {
+		if websocket.DefaultDialer.NetDialContext != nil || websocket.DefaultDialer.NetDialTLSContext != nil {
+			t.Error("expected websocket.DefaultDialer to dial like it always does")
+		}
+	})
+}
+
+func echo(w http.ResponseWriter, req *http.Request) {
+	upgrader := websocket.Upgrader{}
+	conn, err := upgrader.Upgrade(w, req, nil)
+
+	if err != nil {
+		return
+	}
+
+	defer conn.Close()
+
+	for {
+		typ, msg, err := conn.ReadMessage()
+
+		if err != nil {
+			return
+		}
+
+		conn.WriteMessage(typ, msg)
+	}
+}
+
+func serviceFor(raw string) *api.DefaultService {
+	u, _ := url.Parse(raw)
+	port, _ := strconv.Atoi(u.Port())
+
+	return &api.DefaultService{
+		ID:      "1",
+		Name:    "test",
+		Address: u.Hostname(),
+		Port:    port,
+		Scheme:  "http",
+		Type:    "http",
+	}
+}
+
+func proxyFor(forwarder api.Forwarder, service api.Service) *httptest.Server {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Any("/call/test/*path", forwarder.Handler(service))
+
+	return httptest.NewServer(engine)
+}
+
+func dial(t *testing.T, base string) *websocket.Conn {
+	conn, _, err := websocket.DefaultDialer.Dial(strings.Replace(base, "http", "ws", 1)+"/call/test/ws", nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return conn
+}
+
+func events(t *testing.T, base string) *http.Response {
+	req, _ := http.NewRequest("GET", base+"/call/test/events", nil)
+	req.Header.Set("Accept", "text/event-stream")
+
+	res, err := http.DefaultClient.Do(req)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return res
+}
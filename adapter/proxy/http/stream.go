@@ -0,0 +1,160 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+type (
+	// stream - response writer for long lived requests, that knows how to close them
+	stream struct {
+		http.ResponseWriter
+		cancel context.CancelFunc
+		idle   time.Duration
+		timer  *time.Timer
+		lock   *sync.Mutex
+		conn   net.Conn
+		closed bool
+	}
+
+	// idleConn - hijacked connection that times out when neither side has sent anything for a while
+	idleConn struct {
+		net.Conn
+		idle time.Duration
+		lock *sync.Mutex
+		last time.Time
+	}
+)
+
+func newStream(w http.ResponseWriter, cancel context.CancelFunc, idle time.Duration) *stream {
+	s := &stream{
+		ResponseWriter: w,
+		cancel:         cancel,
+		idle:           idle,
+		lock:           &sync.Mutex{},
+	}
+
+	if idle > 0 {
+		s.timer = time.AfterFunc(idle, s.close)
+	}
+
+	return s
+}
+
+func (s *stream) Write(bs []byte) (int, error) {
+	if s.timer != nil {
+		s.timer.Reset(s.idle)
+	}
+
+	return s.ResponseWriter.Write(bs)
+}
+
+func (s *stream) Flush() {
+	flusher, ok := s.ResponseWriter.(http.Flusher)
+
+	if ok {
+		flusher.Flush()
+	}
+}
+
+func (s *stream) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := s.ResponseWriter.(http.Hijacker)
+
+	if !ok {
+		return nil, nil, errors.New("response writer can not be hijacked")
+	}
+
+	conn, rw, err := hijacker.Hijack()
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// the connection deadlines handle idleness from here on
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+
+	if s.idle > 0 {
+		conn = &idleConn{Conn: conn, idle: s.idle, lock: &sync.Mutex{}, last: time.Now()}
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.conn = conn
+
+	if s.closed {
+		conn.Close()
+	}
+
+	return conn, rw, nil
+}
+
+func (s *stream) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// close - cancel the upstream request and close the client connection if it was hijacked
+func (s *stream) close() {
+	s.cancel()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.closed = true
+
+	if s.conn != nil {
+		s.conn.Close()
+	}
+}
+
+// stop - the request is done, stop watching it
+func (s *stream) stop() {
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+}
+
+func (c *idleConn) Read(bs []byte) (int, error) {
+	for {
+		c.Conn.SetReadDeadline(c.lastSeen().Add(c.idle))
+		n, err := c.Conn.Read(bs)
+
+		// the other direction might have been busy while we waited
+		if n == 0 && errors.Is(err, os.ErrDeadlineExceeded) && time.Since(c.lastSeen()) < c.idle {
+			continue
+		}
+
+		if n > 0 {
+			c.touch()
+		}
+
+		return n, err
+	}
+}
+
+func (c *idleConn) Write(bs []byte) (int, error) {
+	c.touch()
+	return c.Conn.Write(bs)
+}
+
+func (c *idleConn) touch() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.last = time.Now()
+}
+
+func (c *idleConn) lastSeen() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.last
+}
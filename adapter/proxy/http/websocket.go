@@ -0,0 +1,162 @@
+package http
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Meduzz/modulr/lib/transport"
+	"github.com/gorilla/websocket"
+	"github.com/vulcand/oxy/forward"
+	"github.com/vulcand/oxy/utils"
+)
+
+type (
+	// websockets - forwards websockets like oxy does, but with a dialer of our own. Oxy only dials with
+	// websocket.DefaultDialer, which would have to learn about unix sockets & upstream tls settings for everyone.
+	// Ported from the websocket support of github.com/vulcand/oxy/forward, which is based on https://github.com/yhat/wsutil
+	websockets struct {
+		rewriter forward.ReqRewriter
+	}
+)
+
+// dialer - reaches the service set on the context with transport.WithService
+var dialer = &websocket.Dialer{
+	Proxy:             http.ProxyFromEnvironment,
+	HandshakeTimeout:  45 * time.Second,
+	NetDialContext:    transport.DialContext,
+	NetDialTLSContext: transport.DialTLSContext,
+}
+
+func (ws *websockets) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	out := ws.outgoing(req)
+	upstream, res, err := dialer.DialContext(out.Context(), out.URL.String(), out.Header)
+
+	if err != nil {
+		if res == nil {
+			utils.DefaultHandler.ServeHTTP(w, req, err)
+			return
+		}
+
+		// the service refused the upgrade, its answer is passed on as it is
+		defer res.Body.Close()
+		utils.CopyHeaders(w.Header(), res.Header)
+		w.WriteHeader(res.StatusCode)
+		io.Copy(w, res.Body)
+
+		return
+	}
+
+	defer upstream.Close()
+
+	// the service is the one to check the origin
+	upgrader := websocket.Upgrader{CheckOrigin: func(r *http.Request) bool {
+		return true
+	}}
+
+	utils.RemoveHeaders(res.Header, forward.WebsocketUpgradeHeaders...)
+	utils.CopyHeaders(res.Header, w.Header())
+
+	conn, err := upgrader.Upgrade(w, req, res.Header)
+
+	if err != nil {
+		log.Printf("Upgrading websocket to %s threw error: %v\n", out.URL.Host, err)
+		return
+	}
+
+	defer conn.Close()
+
+	errs := make(chan error, 2)
+	go replicate(conn, upstream, errs)
+	go replicate(upstream, conn, errs)
+
+	err = <-errs
+
+	if e, ok := err.(*websocket.CloseError); !ok || e.Code == websocket.CloseAbnormalClosure {
+		log.Printf("Forwarding websocket to %s threw error: %v\n", out.URL.Host, err)
+	}
+}
+
+// outgoing - the request to dial the service with, dialed with ws/wss urls
+func (ws *websockets) outgoing(req *http.Request) *http.Request {
+	out := req.Clone(req.Context())
+	out.RequestURI = ""
+
+	out.Header = make(http.Header)
+	// gorilla sends the host of the request from this header
+	out.Header.Set("Host", req.Host)
+	utils.CopyHeaders(out.Header, req.Header)
+	utils.RemoveHeaders(out.Header, forward.WebsocketDialHeaders...)
+
+	ws.rewriter.Rewrite(out)
+
+	switch out.URL.Scheme {
+	case "https":
+		out.URL.Scheme = "wss"
+	case "http":
+		out.URL.Scheme = "ws"
+	}
+
+	return out
+}
+
+// replicate - copies messages from src to dst until either side fails, closes are passed on
+func replicate(dst, src *websocket.Conn, errs chan error) {
+	forward := func(typ int, reader io.Reader) error {
+		writer, err := dst.NextWriter(typ)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = io.Copy(writer, reader)
+
+		if err != nil {
+			return err
+		}
+
+		return writer.Close()
+	}
+
+	src.SetPingHandler(func(data string) error {
+		return forward(websocket.PingMessage, bytes.NewReader([]byte(data)))
+	})
+
+	src.SetPongHandler(func(data string) error {
+		return forward(websocket.PongMessage, bytes.NewReader([]byte(data)))
+	})
+
+	for {
+		typ, reader, err := src.NextReader()
+
+		if err != nil {
+			msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, err.Error())
+
+			if e, ok := err.(*websocket.CloseError); ok && e.Code != websocket.CloseNoStatusReceived {
+				msg = nil
+
+				// these codes are not valid on the wire, the connection is just closed without a close frame
+				if e.Code != websocket.CloseAbnormalClosure && e.Code != websocket.CloseTLSHandshake {
+					msg = websocket.FormatCloseMessage(e.Code, e.Text)
+				}
+			}
+
+			errs <- err
+
+			if msg != nil {
+				forward(websocket.CloseMessage, bytes.NewReader(msg))
+			}
+
+			return
+		}
+
+		err = forward(typ, reader)
+
+		if err != nil {
+			errs <- err
+			return
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package inprocess
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Meduzz/modulr"
+	"github.com/Meduzz/modulr/api"
+	"github.com/Meduzz/modulr/lib/response"
+	"github.com/Meduzz/modulr/lib/router"
+)
+
+type (
+	// InProcess - forwards calls, and delivers events, to handlers living in the proxy process instead of over the network
+	InProcess interface {
+		api.HttpForwarder
+		api.EventDeliveryAdapter
+		api.Lifecycle
+		// Handle - the handler of an instance of a service, calls & events for it go here
+		Handle(api.Service, http.Handler)
+	}
+
+	inprocess struct {
+		handlers map[string]http.Handler // name/id -> handler
+		lock     *sync.RWMutex
+	}
+
+	// status - response writer for event deliveries, only the status is of interest
+	status struct {
+		header http.Header
+		code   int
+	}
+)
+
+const (
+	// Type - the service type of in process services
+	Type = "inprocess"
+
+	// deliveries that take longer than this are cancelled
+	deliveryTimeout = 30 * time.Second
+)
+
+var modules = NewInProcess(modulr.ServiceRegistry)
+
+func init() {
+	modulr.HttpProxy.RegisterHttpForwarder(Type, modules)
+	modulr.EventSupport.RegisterDeliverer(Type, modules)
+}
+
+// Register - register an instance of a service that's handled in process, it's looked up, loadbalanced & delivered events like any other
+func Register(service *api.DefaultService, handler http.Handler) error {
+	service.Type = Type
+	modules.Handle(service, handler)
+
+	err := modulr.ServiceRegistry.Register(service)
+
+	if err != nil {
+		modules.DeregisterInstance(service)
+		return err
+	}
+
+	return nil
+}
+
+// NewInProcess - creates a forwarder & delivery adapter for handlers in process, the handler of an instance is dropped when it's deregistered
+func NewInProcess(registry api.ServiceRegistry) InProcess {
+	i := &inprocess{
+		handlers: make(map[string]http.Handler),
+		lock:     &sync.RWMutex{},
+	}
+
+	registry.Plugin(i)
+
+	return i
+}
+
+func (i *inprocess) Handle(service api.Service, handler http.Handler) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	i.handlers[key(service)] = handler
+}
+
+// HttpHandler - the handler sees the path the service would see over the network, its context followed by the path of the call
+func (i *inprocess) HttpHandler(service api.Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		handler, ok := i.handler(service)
+
+		if !ok {
+			http.Error(w, fmt.Sprintf("no handler for instance %s of %s", service.GetID(), service.GetName()), http.StatusBadGateway)
+			return
+		}
+
+		clone := req.Clone(req.Context())
+		clone.URL.Path = service.GetContext() + router.Path(req, service.GetName())
+		clone.URL.RawPath = ""
+		clone.RequestURI = clone.URL.RequestURI()
+
+		writer := response.NewWriter(w)
+		err := serve(handler, writer, clone)
+
+		if err == nil {
+			return
+		}
+
+		log.Printf("Serving %s in process threw error: %v\n", service.GetName(), err)
+
+		// half a response can't be taken back, the connection is aborted like net/http would
+		if writer.Written() {
+			panic(http.ErrAbortHandler)
+		}
+
+		w.WriteHeader(http.StatusBadGateway)
+	})
+}
+
+// Deliver - events are posted to the path of the subscription, like the http deliverer does
+func (i *inprocess) Deliver(service api.Service, sub *api.Subscription, body []byte) error {
+	handler, ok := i.handler(service)
+
+	if !ok {
+		return fmt.Errorf("no handler for instance %s of %s", service.GetID(), service.GetName())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), deliveryTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, service.GetContext()+sub.Path, bytes.NewReader(body))
+
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	if sub.Secret != "" {
+		req.Header.Set("Authorization", sub.Secret)
+	}
+
+	res := &status{header: make(http.Header)}
+	err = serve(handler, res, req)
+
+	if err != nil {
+		return err
+	}
+
+	// handlers that never write answer 200, like they would over the network
+	if res.code != 0 && res.code != http.StatusOK {
+		return fmt.Errorf("call did not return 200")
+	}
+
+	return nil
+}
+
+func (i *inprocess) RegisterService(service api.Service) error {
+	return nil
+}
+
+func (i *inprocess) DeregisterService(service api.Service) error {
+	return nil
+}
+
+func (i *inprocess) RegisterInstance(service api.Service) error {
+	return nil
+}
+
+// DeregisterInstance - forget the handler of the instance
+func (i *inprocess) DeregisterInstance(service api.Service) error {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	delete(i.handlers, key(service))
+
+	return nil
+}
+
+func (i *inprocess) handler(service api.Service) (http.Handler, bool) {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+
+	handler, ok := i.handlers[key(service)]
+
+	return handler, ok
+}
+
+// serve - a handler that panics fails the call or delivery instead of taking the proxy down with it
+func serve(handler http.Handler, w http.ResponseWriter, req *http.Request) (err error) {
+	defer func() {
+		it := recover()
+
+		if it != nil {
+			err = fmt.Errorf("handler panicked: %v", it)
+		}
+	}()
+
+	handler.ServeHTTP(w, req)
+
+	return nil
+}
+
+func key(service api.Service) string {
+	return service.GetName() + "/" + service.GetID()
+}
+
+func (s *status) Header() http.Header {
+	return s.header
+}
+
+func (s *status) Write(bs []byte) (int, error) {
+	if s.code == 0 {
+		s.code = http.StatusOK
+	}
+
+	return len(bs), nil
+}
+
+func (s *status) WriteHeader(code int) {
+	if s.code == 0 {
+		s.code = code
+	}
+}
@@ -0,0 +1,145 @@
+package inprocess
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Meduzz/modulr"
+	_ "github.com/Meduzz/modulr/adapter/loadbalancer/roundrobin"
+	_ "github.com/Meduzz/modulr/adapter/registry/inmemory"
+	"github.com/Meduzz/modulr/api"
+	"github.com/gin-gonic/gin"
+)
+
+type (
+	fakeRegistry struct {
+		api.ServiceRegistry
+	}
+)
+
+func TestInProcess(t *testing.T) {
+	subject := NewInProcess(&fakeRegistry{})
+	service := &api.DefaultService{ID: "1", Name: "test", Context: "/api", Type: Type}
+
+	subject.Handle(service, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+
+		if req.URL.Path == "/api/events/fail" {
+			w.WriteHeader(500)
+			return
+		}
+
+		if req.URL.Path == "/api/events/panic" {
+			panic("boom")
+		}
+
+		fmt.Fprintf(w, "%s %s %s %s", req.Method, req.URL.RequestURI(), req.Header.Get("Authorization"), string(body))
+	}))
+
+	t.Run("calls", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		subject.HttpHandler(service).ServeHTTP(res, httptest.NewRequest("GET", "/call/test/things?a=b", nil))
+
+		if res.Code != 200 || res.Body.String() != "GET /api/things?a=b  " {
+			t.Errorf("unexpected response %d %s", res.Code, res.Body.String())
+		}
+	})
+
+	t.Run("events", func(t *testing.T) {
+		err := subject.Deliver(service, &api.Subscription{Topic: "orders", Path: "/events/orders", Secret: "shh"}, []byte(`{}`))
+
+		if err != nil {
+			t.Errorf("There was an unexpected error: %v", err)
+		}
+
+		err = subject.Deliver(service, &api.Subscription{Topic: "orders", Path: "/events/fail"}, []byte(`{}`))
+
+		if err == nil {
+			t.Error("expected a failed delivery to return an error")
+		}
+	})
+
+	t.Run("panicking handlers", func(t *testing.T) {
+		err := subject.Deliver(service, &api.Subscription{Topic: "orders", Path: "/events/panic"}, []byte(`{}`))
+
+		if err == nil {
+			t.Error("expected a panicking handler to fail the delivery")
+		}
+
+		res := httptest.NewRecorder()
+		subject.HttpHandler(service).ServeHTTP(res, httptest.NewRequest("GET", "/call/test/events/panic", nil))
+
+		if res.Code != 502 {
+			t.Errorf("expected a panicking handler to answer 502 but got %d", res.Code)
+		}
+	})
+
+	t.Run("deregistered instances", func(t *testing.T) {
+		subject.DeregisterInstance(service)
+
+		res := httptest.NewRecorder()
+		subject.HttpHandler(service).ServeHTTP(res, httptest.NewRequest("GET", "/call/test/", nil))
+
+		if res.Code != 502 {
+			t.Errorf("expected 502 but got %d", res.Code)
+		}
+
+		if subject.Deliver(service, &api.Subscription{Path: "/events/orders"}, nil) == nil {
+			t.Error("expected an error without a handler")
+		}
+	})
+}
+
+func TestThroughTheProxy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	for _, id := range []string{"1", "2"} {
+		id := id
+		err := Register(&api.DefaultService{ID: id, Name: "module"}, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			fmt.Fprintf(w, "%s %s", id, req.URL.Path)
+		}))
+
+		if err != nil {
+			t.Fatalf("There was an unexpected error: %v", err)
+		}
+	}
+
+	engine := gin.New()
+	engine.Any("/call/:service/*path", func(ctx *gin.Context) {
+		handler, err := modulr.HttpProxy.ForwarderFor(ctx.Param("service"))
+
+		if err != nil {
+			ctx.AbortWithError(500, err)
+			return
+		}
+
+		handler(ctx)
+	})
+
+	seen := make(map[string]bool)
+
+	for i := 0; i < 2; i++ {
+		res := httptest.NewRecorder()
+		engine.ServeHTTP(res, httptest.NewRequest("GET", "/call/module/hello", nil))
+
+		seen[res.Body.String()] = true
+	}
+
+	if !seen["1 /hello"] || !seen["2 /hello"] {
+		t.Errorf("expected both instances to be called but saw %v", seen)
+	}
+
+	modulr.ServiceRegistry.Deregister("module", "1")
+
+	res := httptest.NewRecorder()
+	engine.ServeHTTP(res, httptest.NewRequest("GET", "/call/module/hello", nil))
+
+	if res.Body.String() != "2 /hello" {
+		t.Errorf("expected the remaining instance to answer but got %s", res.Body.String())
+	}
+}
+
+func (f *fakeRegistry) Plugin(api.Lifecycle) {}
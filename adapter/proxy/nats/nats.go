@@ -0,0 +1,155 @@
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/Meduzz/modulr"
+	"github.com/Meduzz/modulr/api"
+	"github.com/Meduzz/modulr/lib/auth"
+	"github.com/Meduzz/modulr/lib/policy"
+	"github.com/Meduzz/modulr/lib/router"
+	"github.com/gin-gonic/gin"
+	"github.com/nats-io/nats.go"
+)
+
+type (
+	natsproxy struct {
+		requester Requester
+		timeout   time.Duration
+	}
+
+	// Requester - does request/reply over the event bus, api.EventSupport is one
+	Requester interface {
+		Request(*api.Event, string) ([]byte, error)
+	}
+
+	// Request - the envelope a http request is sent to the service in
+	Request struct {
+		Method  string      `json:"method"`
+		Path    string      `json:"path"`
+		Query   string      `json:"query,omitempty"`
+		Headers http.Header `json:"headers,omitempty"`
+		Body    []byte      `json:"body,omitempty"`
+	}
+
+	// Response - the envelope the service replies with
+	Response struct {
+		Status  int         `json:"status"`
+		Headers http.Header `json:"headers,omitempty"`
+		Body    []byte      `json:"body,omitempty"`
+	}
+)
+
+// TimeoutHeader - lets a caller lower the time to wait for the reply, ie 500ms. It's never raised above the configured timeout.
+const TimeoutHeader = "X-Timeout"
+
+func init() {
+	modulr.HttpProxy.RegisterForwarder("nats", NewNatsForwarder(modulr.EventSupport, 30*time.Second))
+}
+
+// NewNatsForwarder - creates a forwarder that turns http requests into request/reply over the event bus, waiting up to timeout for the reply.
+// The request is sent to the address of the service, or its name if it has no address.
+func NewNatsForwarder(requester Requester, timeout time.Duration) api.Forwarder {
+	return &natsproxy{
+		requester: requester,
+		timeout:   timeout,
+	}
+}
+
+func (n *natsproxy) Handler(service api.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		timeout := n.timeout
+		header := ctx.GetHeader(TimeoutHeader)
+
+		if header != "" {
+			parsed, err := time.ParseDuration(header)
+
+			if err == nil && parsed <= 0 {
+				err = fmt.Errorf("%s must be positive, was %s", TimeoutHeader, header)
+			}
+
+			if err != nil {
+				ctx.AbortWithError(http.StatusBadRequest, err)
+				return
+			}
+
+			if parsed < timeout {
+				timeout = parsed
+			}
+		}
+
+		body, err := io.ReadAll(ctx.Request.Body)
+
+		if err != nil {
+			ctx.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+
+		envelope := &Request{
+			Method:  ctx.Request.Method,
+			Path:    service.GetContext() + router.Path(ctx.Request, service.GetName()),
+			Query:   ctx.Request.URL.RawQuery,
+			Headers: ctx.Request.Header,
+			Body:    body,
+		}
+
+		bs, err := json.Marshal(envelope)
+
+		if err != nil {
+			ctx.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+
+		topic := service.GetAddress()
+
+		if topic == "" {
+			topic = service.GetName()
+		}
+
+		// the caller publishes the request, so the topic is held to the publish policy too
+		event := &api.Event{Topic: topic, Body: bs, Publisher: auth.IdentityFrom(ctx.Request.Context())}
+		reply, err := n.requester.Request(event, timeout.String())
+
+		if errors.Is(err, policy.ErrDenied) {
+			ctx.AbortWithError(http.StatusForbidden, err)
+			return
+		}
+
+		if errors.Is(err, nats.ErrTimeout) || errors.Is(err, context.DeadlineExceeded) {
+			ctx.AbortWithError(http.StatusGatewayTimeout, err)
+			return
+		}
+
+		if err != nil {
+			ctx.AbortWithError(http.StatusBadGateway, err)
+			return
+		}
+
+		res := &Response{}
+		err = json.Unmarshal(reply, res)
+
+		if err != nil {
+			ctx.AbortWithError(http.StatusBadGateway, err)
+			return
+		}
+
+		if res.Status == 0 {
+			res.Status = http.StatusOK
+		}
+
+		for key, values := range res.Headers {
+			for _, value := range values {
+				ctx.Writer.Header().Add(key, value)
+			}
+		}
+
+		ctx.Status(res.Status)
+		ctx.Writer.Write(res.Body)
+	}
+}
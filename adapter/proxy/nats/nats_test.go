@@ -0,0 +1,153 @@
+package nats
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Meduzz/modulr/api"
+	"github.com/Meduzz/modulr/lib/policy"
+	"github.com/gin-gonic/gin"
+	"github.com/nats-io/nats.go"
+)
+
+type (
+	fakeBus struct {
+		topic   string
+		maxWait string
+	}
+)
+
+func TestNatsForwarder(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	bus := &fakeBus{}
+	subject := NewNatsForwarder(bus, time.Second)
+	service := &api.DefaultService{ID: "1", Name: "test", Address: "test.http", Context: "/api", Type: "nats"}
+
+	engine := gin.New()
+	engine.Any("/call/test/*path", subject.Handler(service))
+
+	t.Run("request is enveloped and reply is mapped", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/call/test/echo?a=b", strings.NewReader("hello"))
+		req.Header.Set("X-Test", "yes")
+		res := httptest.NewRecorder()
+
+		engine.ServeHTTP(res, req)
+
+		if res.Code != 201 {
+			t.Errorf("expected 201 but got %d", res.Code)
+		}
+
+		if res.Body.String() != "POST /api/echo a=b yes hello" {
+			t.Errorf("unexpected body: %s", res.Body.String())
+		}
+
+		if res.Header().Get("X-Reply") != "yes" {
+			t.Error("reply header was missing")
+		}
+
+		if bus.topic != "test.http" {
+			t.Errorf("expected topic test.http but was %s", bus.topic)
+		}
+
+		if bus.maxWait != "1s" {
+			t.Errorf("expected the default timeout but was %s", bus.maxWait)
+		}
+	})
+
+	t.Run("timeouts", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/call/test/slow", nil)
+		req.Header.Set(TimeoutHeader, "10ms")
+		res := httptest.NewRecorder()
+
+		engine.ServeHTTP(res, req)
+
+		if res.Code != 504 {
+			t.Errorf("expected 504 but got %d", res.Code)
+		}
+
+		if bus.maxWait != "10ms" {
+			t.Errorf("expected the header timeout but was %s", bus.maxWait)
+		}
+	})
+
+	t.Run("timeouts are never raised", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/call/test/things", nil)
+		req.Header.Set(TimeoutHeader, "1h")
+		res := httptest.NewRecorder()
+
+		engine.ServeHTTP(res, req)
+
+		if bus.maxWait != "1s" {
+			t.Errorf("expected the configured timeout but was %s", bus.maxWait)
+		}
+	})
+
+	t.Run("invalid timeout", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/call/test/slow", nil)
+		req.Header.Set(TimeoutHeader, "soon")
+		res := httptest.NewRecorder()
+
+		engine.ServeHTTP(res, req)
+
+		if res.Code != 400 {
+			t.Errorf("expected 400 but got %d", res.Code)
+		}
+	})
+
+	t.Run("denied by policy", func(t *testing.T) {
+		res := httptest.NewRecorder()
+
+		engine.ServeHTTP(res, httptest.NewRequest("GET", "/call/test/secret", nil))
+
+		if res.Code != 403 {
+			t.Errorf("expected 403 but got %d", res.Code)
+		}
+	})
+
+	t.Run("garbage reply", func(t *testing.T) {
+		res := httptest.NewRecorder()
+
+		engine.ServeHTTP(res, httptest.NewRequest("GET", "/call/test/garbage", nil))
+
+		if res.Code != 502 {
+			t.Errorf("expected 502 but got %d", res.Code)
+		}
+	})
+}
+
+// Request - pretends to be a service on the other side of the bus
+func (f *fakeBus) Request(event *api.Event, maxWait string) ([]byte, error) {
+	f.topic = event.Topic
+	f.maxWait = maxWait
+
+	req := &Request{}
+	err := json.Unmarshal(event.Body, req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch req.Path {
+	case "/api/slow":
+		return nil, nats.ErrTimeout
+	case "/api/garbage":
+		return []byte("garbage"), nil
+	case "/api/secret":
+		return nil, fmt.Errorf("%w: %s", policy.ErrDenied, event.Topic)
+	}
+
+	body := fmt.Sprintf("%s %s %s %s %s", req.Method, req.Path, req.Query, req.Headers.Get("X-Test"), string(req.Body))
+	res := &Response{
+		Status:  201,
+		Headers: http.Header{"X-Reply": []string{"yes"}},
+		Body:    []byte(body),
+	}
+
+	return json.Marshal(res)
+}
@@ -0,0 +1,302 @@
+package static
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Meduzz/modulr"
+	"github.com/Meduzz/modulr/api"
+	"github.com/Meduzz/modulr/lib/router"
+)
+
+type (
+	// StaticForwarder - serves files from the file system mounted for a static service. What's served is always decided
+	// by the operator, never by what a service sent when it registered: a static service can't point the proxy at a
+	// directory, it's mounted from Go with Mount or MountDir by whoever runs the proxy.
+	StaticForwarder interface {
+		api.HttpForwarder
+		// Mount - serve the file system for static services with the name, ie an embed.FS or os.DirFS
+		Mount(string, fs.FS)
+	}
+
+	staticproxy struct {
+		mounted map[string]*mount // service name -> mounted file system
+		lock    *sync.RWMutex
+	}
+
+	// mount - the hashed etags of files without modification times are kept, ie the files of an embed.FS
+	mount struct {
+		fsys  fs.FS
+		etags *sync.Map // path, encoding & size -> etag
+	}
+
+	// file - what's served for a request, name says what the content is when it's precompressed
+	file struct {
+		name     string
+		encoding string
+		content  io.ReadSeeker
+		info     fs.FileInfo
+		closer   io.Closer
+	}
+)
+
+const (
+	// assets with a hash in their name never change
+	immutable = "public, max-age=31536000, immutable"
+	// everything else is checked with the etag before it's used again
+	revalidate = "no-cache"
+	index      = "index.html"
+)
+
+// hashed - a dot or dash followed by at least 8 letters & digits before the extension. Ie app.3f2a9c1b.js or index-BQz3x7aW.js
+var hashed = regexp.MustCompile(`[.-]([A-Za-z0-9_]{8,})\.[A-Za-z0-9]+$`)
+
+// precompressed - the encodings we look for files of, in the order we prefer them
+var precompressed = []struct {
+	encoding  string
+	extension string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+var files = NewStaticForwarder()
+
+func init() {
+	modulr.HttpProxy.RegisterHttpForwarder("static", files)
+}
+
+// Mount - serve the file system for static services with the name, on the forwarder registered for the static type
+func Mount(name string, fsys fs.FS) {
+	files.Mount(name, fsys)
+}
+
+// MountDir - serve the directory for static services with the name, on the forwarder registered for the static type
+func MountDir(name, dir string) {
+	files.Mount(name, os.DirFS(dir))
+}
+
+// NewStaticForwarder - creates a forwarder serving front end bundles. Paths without a file fall back to index.html,
+// so that single page apps can route on their own, and br & gzip versions of files are served to clients that accept them.
+func NewStaticForwarder() StaticForwarder {
+	return &staticproxy{
+		mounted: make(map[string]*mount),
+		lock:    &sync.RWMutex{},
+	}
+}
+
+func (s *staticproxy) Mount(name string, fsys fs.FS) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.mounted[name] = &mount{
+		fsys:  fsys,
+		etags: &sync.Map{},
+	}
+}
+
+func (s *staticproxy) HttpHandler(service api.Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet && req.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		root, ok := s.root(service)
+
+		if !ok {
+			http.Error(w, fmt.Sprintf("static service %s has nothing mounted", service.GetName()), http.StatusInternalServerError)
+			return
+		}
+
+		name := strings.TrimPrefix(path.Clean("/"+router.Path(req, service.GetName())), "/")
+
+		if name == "" {
+			name = index
+		}
+
+		it, err := open(root.fsys, name, req.Header.Get("Accept-Encoding"))
+
+		// client side routes, paths without an extension, get the app
+		if err != nil && path.Ext(name) == "" {
+			name = index
+			it, err = open(root.fsys, name, req.Header.Get("Accept-Encoding"))
+		}
+
+		if err != nil {
+			http.NotFound(w, req)
+			return
+		}
+
+		defer it.closer.Close()
+
+		header := w.Header()
+		header.Add("Vary", "Accept-Encoding")
+
+		if it.encoding != "" {
+			header.Set("Content-Encoding", it.encoding)
+		}
+
+		if fingerprinted(name) {
+			header.Set("Cache-Control", immutable)
+		} else {
+			header.Set("Cache-Control", revalidate)
+		}
+
+		etag, err := root.etag(it)
+
+		if err == nil {
+			header.Set("ETag", etag)
+		}
+
+		http.ServeContent(w, req, it.name, it.info.ModTime(), it.content)
+	})
+}
+
+// root - the file system mounted for the service
+func (s *staticproxy) root(service api.Service) (*mount, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	it, ok := s.mounted[service.GetName()]
+
+	return it, ok
+}
+
+// etag - size & modification time when there is one, a hash of the content otherwise.
+// Directories on disk change under us, so only hashes are kept, they're what's expensive.
+func (m *mount) etag(it *file) (string, error) {
+	if !it.info.ModTime().IsZero() {
+		return fmt.Sprintf(`"%x-%x"`, it.info.Size(), it.info.ModTime().UnixNano()), nil
+	}
+
+	key := fmt.Sprintf("%s;%s;%d", it.name, it.encoding, it.info.Size())
+
+	if etag, ok := m.etags.Load(key); ok {
+		return etag.(string), nil
+	}
+
+	hash := sha256.New()
+	_, err := io.Copy(hash, it.content)
+
+	if err != nil {
+		return "", err
+	}
+
+	_, err = it.content.Seek(0, io.SeekStart)
+
+	if err != nil {
+		return "", err
+	}
+
+	etag := fmt.Sprintf(`"%s"`, hex.EncodeToString(hash.Sum(nil))[:16])
+	m.etags.Store(key, etag)
+
+	return etag, nil
+}
+
+// open - the precompressed version the client accepts, or the file itself. Directories are served by their index.html.
+func open(fsys fs.FS, name, accept string) (*file, error) {
+	info, err := fs.Stat(fsys, name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		name = path.Join(name, index)
+	}
+
+	for _, it := range precompressed {
+		if !accepts(accept, it.encoding) {
+			continue
+		}
+
+		compressed, err := read(fsys, name+it.extension)
+
+		if err == nil {
+			compressed.name = name
+			compressed.encoding = it.encoding
+			return compressed, nil
+		}
+	}
+
+	return read(fsys, name)
+}
+
+func read(fsys fs.FS, name string) (*file, error) {
+	f, err := fsys.Open(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := f.Stat()
+
+	if err != nil || info.IsDir() {
+		f.Close()
+		return nil, fs.ErrNotExist
+	}
+
+	content, ok := f.(io.ReadSeeker)
+
+	if !ok {
+		bs, err := io.ReadAll(f)
+
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+
+		content = bytes.NewReader(bs)
+	}
+
+	return &file{
+		name:    name,
+		content: content,
+		info:    info,
+		closer:  f,
+	}, nil
+}
+
+// fingerprinted - whether the name has a hash in it, with at least one digit so that words aren't taken for one
+func fingerprinted(name string) bool {
+	match := hashed.FindStringSubmatch(path.Base(name))
+
+	return match != nil && strings.ContainsAny(match[1], "0123456789")
+}
+
+// accepts - whether the Accept-Encoding header allows the encoding, q=0 turns it down
+func accepts(header, encoding string) bool {
+	for _, it := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(it), ";")
+
+		if !strings.EqualFold(strings.TrimSpace(name), encoding) {
+			continue
+		}
+
+		q, found := strings.CutPrefix(strings.TrimSpace(params), "q=")
+
+		if !found {
+			return true
+		}
+
+		weight, err := strconv.ParseFloat(q, 64)
+
+		return err == nil && weight > 0
+	}
+
+	return false
+}
@@ -0,0 +1,162 @@
+package static
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/Meduzz/modulr/api"
+)
+
+func TestStaticForwarder(t *testing.T) {
+	subject := NewStaticForwarder()
+	subject.Mount("app", fstest.MapFS{
+		"index.html":                {Data: []byte("<html>app</html>")},
+		"assets/app.3f2a9c1b.js":    {Data: []byte("console.log('plain')")},
+		"assets/app.3f2a9c1b.js.br": {Data: []byte("brotli")},
+		"assets/app.3f2a9c1b.js.gz": {Data: []byte("gzip")},
+		"assets/logo.svg":           {Data: []byte("<svg/>")},
+		"docs/index.html":           {Data: []byte("<html>docs</html>")},
+	})
+
+	handler := subject.HttpHandler(&api.DefaultService{ID: "1", Name: "app", Type: "static"})
+
+	call := func(method, path string, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+
+		for key, value := range header {
+			req.Header.Set(key, value)
+		}
+
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+
+		return res
+	}
+
+	t.Run("index", func(t *testing.T) {
+		res := call("GET", "/call/app/", nil)
+
+		if res.Code != 200 || res.Body.String() != "<html>app</html>" {
+			t.Errorf("expected the index but got %d %s", res.Code, res.Body.String())
+		}
+
+		if res.Header().Get("Cache-Control") != "no-cache" || res.Header().Get("Content-Type") != "text/html; charset=utf-8" {
+			t.Errorf("unexpected headers %v", res.Header())
+		}
+	})
+
+	t.Run("single page app routes", func(t *testing.T) {
+		res := call("GET", "/call/app/users/42", nil)
+
+		if res.Code != 200 || res.Body.String() != "<html>app</html>" {
+			t.Errorf("expected the index but got %d %s", res.Code, res.Body.String())
+		}
+
+		if call("GET", "/call/app/assets/missing.js", nil).Code != 404 {
+			t.Error("expected missing assets to 404")
+		}
+
+		if call("GET", "/call/app/docs", nil).Body.String() != "<html>docs</html>" {
+			t.Error("expected directories to serve their index")
+		}
+	})
+
+	t.Run("hashed assets", func(t *testing.T) {
+		res := call("GET", "/call/app/assets/app.3f2a9c1b.js", nil)
+
+		if res.Body.String() != "console.log('plain')" || res.Header().Get("Cache-Control") != immutable {
+			t.Errorf("expected an immutable asset but got %s %v", res.Body.String(), res.Header())
+		}
+
+		if call("GET", "/call/app/assets/logo.svg", nil).Header().Get("Cache-Control") != "no-cache" {
+			t.Error("expected assets without a hash to be revalidated")
+		}
+	})
+
+	t.Run("precompressed", func(t *testing.T) {
+		res := call("GET", "/call/app/assets/app.3f2a9c1b.js", map[string]string{"Accept-Encoding": "gzip, br"})
+
+		if res.Body.String() != "brotli" || res.Header().Get("Content-Encoding") != "br" {
+			t.Errorf("expected brotli but got %s", res.Body.String())
+		}
+
+		if res.Header().Get("Content-Type") != "text/javascript; charset=utf-8" {
+			t.Errorf("expected the type of the original but got %s", res.Header().Get("Content-Type"))
+		}
+
+		res = call("GET", "/call/app/assets/app.3f2a9c1b.js", map[string]string{"Accept-Encoding": "gzip, br;q=0"})
+
+		if res.Body.String() != "gzip" || res.Header().Get("Content-Encoding") != "gzip" {
+			t.Errorf("expected gzip but got %s", res.Body.String())
+		}
+	})
+
+	t.Run("revalidation", func(t *testing.T) {
+		etag := call("GET", "/call/app/", nil).Header().Get("ETag")
+
+		if etag == "" {
+			t.Fatal("expected an etag")
+		}
+
+		if call("GET", "/call/app/", map[string]string{"If-None-Match": etag}).Code != 304 {
+			t.Error("expected 304 for a matching etag")
+		}
+	})
+
+	t.Run("only GET & HEAD", func(t *testing.T) {
+		res := call("POST", "/call/app/", nil)
+
+		if res.Code != 405 || res.Header().Get("Allow") != "GET, HEAD" {
+			t.Errorf("expected 405 but got %d", res.Code)
+		}
+	})
+}
+
+func TestStaticDirectory(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("<html>dir</html>"), 0600)
+	os.WriteFile(filepath.Join(dir, "secret.txt"), []byte("secret"), 0600)
+
+	subject := NewStaticForwarder()
+	subject.Mount("site", os.DirFS(dir))
+	handler := subject.HttpHandler(&api.DefaultService{ID: "1", Name: "site", Type: "static"})
+
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, httptest.NewRequest("GET", "/call/site/index.html", nil))
+
+	if res.Body.String() != "<html>dir</html>" {
+		t.Errorf("expected the file but got %d %s", res.Code, res.Body.String())
+	}
+
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, httptest.NewRequest("GET", "/call/site/../../etc/passwd", nil))
+
+	if res.Body.String() != "<html>dir</html>" {
+		t.Errorf("expected paths to stay inside the directory but got %s", res.Body.String())
+	}
+
+	// files that change on disk get a new etag
+	etag := res.Header().Get("ETag")
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("<html>changed</html>"), 0600)
+	modified := time.Now().Add(time.Minute)
+	os.Chtimes(filepath.Join(dir, "index.html"), modified, modified)
+
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, httptest.NewRequest("GET", "/call/site/index.html", nil))
+
+	if res.Header().Get("ETag") == etag || res.Body.String() != "<html>changed</html>" {
+		t.Errorf("expected the changed file with a new etag but got %s %s", res.Header().Get("ETag"), res.Body.String())
+	}
+
+	// the address of a service never decides what's served
+	res = httptest.NewRecorder()
+	subject.HttpHandler(&api.DefaultService{ID: "1", Name: "other", Type: "static", Address: dir}).ServeHTTP(res, httptest.NewRequest("GET", "/call/other/index.html", nil))
+
+	if res.Code != 500 {
+		t.Errorf("expected a service without a mount to fail but got %d", res.Code)
+	}
+}
@@ -0,0 +1,90 @@
+package inmemory
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Meduzz/modulr"
+	"github.com/Meduzz/modulr/api"
+)
+
+type (
+	inmemoryBackend struct {
+		buckets map[string]*bucket // key -> bucket
+		swept   time.Time
+		lock    *sync.Mutex
+	}
+
+	bucket struct {
+		tokens float64
+		last   time.Time
+		full   time.Time // when the bucket is full again, and can be forgotten
+	}
+)
+
+// how often buckets that filled up again are dropped
+const sweepInterval = time.Minute
+
+func init() {
+	modulr.RateLimiter.SetBackend(NewInMemoryBackend())
+}
+
+// NewInMemoryBackend - keeps token buckets in memory, so every proxy replica limits on its own
+func NewInMemoryBackend() api.RateLimitBackend {
+	return &inmemoryBackend{
+		buckets: make(map[string]*bucket),
+		swept:   time.Now(),
+		lock:    &sync.Mutex{},
+	}
+}
+
+func (i *inmemoryBackend) Take(key string, rate float64, burst int) (bool, time.Duration, error) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	now := time.Now()
+	i.sweep(now)
+
+	it, ok := i.buckets[key]
+
+	if !ok {
+		it = &bucket{
+			tokens: float64(burst),
+			last:   now,
+		}
+
+		i.buckets[key] = it
+	}
+
+	it.tokens += now.Sub(it.last).Seconds() * rate
+	it.last = now
+
+	if it.tokens > float64(burst) {
+		it.tokens = float64(burst)
+	}
+
+	if it.tokens < 1 {
+		wait := time.Duration((1 - it.tokens) / rate * float64(time.Second))
+		return false, wait, nil
+	}
+
+	it.tokens--
+	it.full = now.Add(time.Duration((float64(burst) - it.tokens) / rate * float64(time.Second)))
+
+	return true, 0, nil
+}
+
+// sweep - forget buckets that are full again, they're the same as new ones
+func (i *inmemoryBackend) sweep(now time.Time) {
+	if now.Sub(i.swept) < sweepInterval {
+		return
+	}
+
+	i.swept = now
+
+	for key, it := range i.buckets {
+		if now.After(it.full) {
+			delete(i.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package inmemory
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInMemoryBackend(t *testing.T) {
+	subject := NewInMemoryBackend()
+
+	t.Run("burst is allowed at once", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			ok, _, err := subject.Take("burst", 1, 3)
+
+			if err != nil {
+				t.Errorf("There was an unexpected error: %v", err)
+			}
+
+			if !ok {
+				t.Errorf("expected token %d to be taken", i)
+			}
+		}
+
+		ok, wait, _ := subject.Take("burst", 1, 3)
+
+		if ok {
+			t.Error("expected the bucket to be empty")
+		}
+
+		if wait <= 0 || wait > time.Second {
+			t.Errorf("expected to wait up to a second, but was %s", wait)
+		}
+	})
+
+	t.Run("buckets are refilled", func(t *testing.T) {
+		subject.Take("refill", 20, 1)
+
+		ok, _, _ := subject.Take("refill", 20, 1)
+
+		if ok {
+			t.Error("expected the bucket to be empty")
+		}
+
+		time.Sleep(60 * time.Millisecond)
+
+		ok, _, _ = subject.Take("refill", 20, 1)
+
+		if !ok {
+			t.Error("expected the bucket to be refilled")
+		}
+	})
+
+	t.Run("keys have buckets of their own", func(t *testing.T) {
+		subject.Take("a", 1, 1)
+
+		ok, _, _ := subject.Take("b", 1, 1)
+
+		if !ok {
+			t.Error("expected b to have a bucket of its own")
+		}
+	})
+
+	t.Run("full buckets are swept", func(t *testing.T) {
+		backend := subject.(*inmemoryBackend)
+		backend.Take("sweep", 1000, 1)
+
+		time.Sleep(10 * time.Millisecond)
+		backend.swept = time.Now().Add(-2 * sweepInterval)
+		backend.Take("other", 1, 1)
+
+		_, ok := backend.buckets["sweep"]
+
+		if ok {
+			t.Error("expected the full bucket to be forgotten")
+		}
+	})
+}
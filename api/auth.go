@@ -0,0 +1,36 @@
+package api
+
+import (
+	"net/http"
+)
+
+type (
+	// Authenticator - verifies who is calling a service
+	Authenticator interface {
+		// Wrap - wraps the handler of a service, answering 401 or 403 when the caller does not meet the requirements
+		Wrap(*AuthRequirements, http.Handler) http.Handler
+		// RegisterMethod - register a way to authenticate callers by its name, ie jwt
+		RegisterMethod(string, AuthMethod)
+	}
+
+	// AuthMethod - a way to authenticate callers
+	AuthMethod interface {
+		// Authenticate - find out who's calling, nil without error means the request has no credentials for this method
+		Authenticate(*http.Request) (*Identity, error)
+	}
+
+	// AuthRequirements - what callers of a service must pass, declared when it registers
+	AuthRequirements struct {
+		Methods  []string          `json:"methods"`            // names of the methods of which any will do, ie jwt, apikey or hmac
+		Audience string            `json:"audience,omitempty"` // the audience tokens must be issued for
+		Claims   map[string]string `json:"claims,omitempty"`   // claims that must have these values
+	}
+
+	// Identity - a verified caller
+	Identity struct {
+		Subject  string
+		Method   string
+		Audience []string
+		Claims   map[string]string
+	}
+)
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"net/http"
+	"time"
+)
+
+type (
+	// ResponseCache - caches GET & HEAD responses of services, the way Cache-Control, ETag & Vary from the service says
+	ResponseCache interface {
+		Lifecycle
+		// Wrap - wraps the handler of a service, answering from the cache when possible
+		Wrap(string, http.Handler) http.Handler
+		// Set - enable caching for a service, or replace its settings
+		Set(*CacheSettings) error
+		// Remove - disable caching for a service by its name, dropping what's cached
+		Remove(string)
+		// Settings - list the settings of all services with caching enabled
+		Settings() []*CacheSettings
+		// SetBackend - set the backend storing the responses
+		SetBackend(CacheBackend)
+	}
+
+	// CacheBackend - stores cached responses per service, nil without error means there's nothing stored
+	CacheBackend interface {
+		// Get - fetch a response by service name and key
+		Get(string, string) (*CachedResponse, error)
+		// Set - store a response by service name and key
+		Set(string, string, *CachedResponse) error
+		// Purge - drop everything stored for a service by its name
+		Purge(string) error
+	}
+
+	// CacheSettings - caching of a service
+	CacheSettings struct {
+		Service      string `json:"service"`                // name of the service
+		MaxEntrySize int64  `json:"maxEntrySize,omitempty"` // bodies larger than this many bytes are not stored, defaults to 1MB
+	}
+
+	// CachedResponse - a stored response, or a pointer to its variants when the service answered with Vary
+	CachedResponse struct {
+		Status  int
+		Header  http.Header
+		Body    []byte
+		Vary    []string  // request headers the response depends on
+		Stored  time.Time // when the response was stored or last revalidated
+		Expires time.Time // fresh until
+	}
+)
@@ -0,0 +1,32 @@
+package api
+
+import (
+	"net/http"
+)
+
+type (
+	// ConcurrencyLimiter - limits how many calls a service, and each of its instances, handles at once
+	ConcurrencyLimiter interface {
+		Lifecycle
+		// Wrap - wraps the handler of a service, answering 503 when the service is full and the queue too
+		Wrap(string, http.Handler) http.Handler
+		// WrapInstance - wraps the handler of one instance, answering 503 when the instance is full and the queue too
+		WrapInstance(Service, http.Handler) http.Handler
+		// Set - add or replace the limits of a service
+		Set(*ConcurrencyLimit) error
+		// Remove - remove the limits of a service by its name
+		Remove(string)
+		// Limits - list all limits
+		Limits() []*ConcurrencyLimit
+	}
+
+	// ConcurrencyLimit - how many calls a service takes at once, and how many may wait for their turn
+	ConcurrencyLimit struct {
+		Service                string `json:"service"`                          // name of the service
+		MaxInFlight            int    `json:"maxInFlight,omitempty"`            // calls to the whole service at once, 0 means no limit
+		MaxInFlightPerInstance int    `json:"maxInFlightPerInstance,omitempty"` // calls to each instance at once, 0 means no limit
+		MaxQueue               int    `json:"maxQueue,omitempty"`               // calls that may wait when full, 0 rejects them right away
+		QueueTimeout           string `json:"queueTimeout,omitempty"`           // how long calls may wait, defaults to 1s
+		Adaptive               bool   `json:"adaptive,omitempty"`               // adjust the limits between 1 and the max by latency & errors
+	}
+)
@@ -13,6 +13,10 @@ type (
 		RegisterDeliverer(string, EventDeliveryAdapter)
 		SetEventAdapter(EventAdapter)
 		SetLoadBalancer(LoadBalancer)
+		// SetPolicyEngine - allows us to decide who may publish to which topics
+		SetPolicyEngine(PolicyEngine)
+		// SetFaultInjector - allows us to fail deliveries on purpose
+		SetFaultInjector(FaultInjector)
 	}
 
 	// EventAdapter - interface to be implemented by event adapters
@@ -38,5 +42,7 @@ type (
 		Topic   string          `json:"topic"`
 		Routing string          `json:"routing"`
 		Body    json.RawMessage `json:"body"`
+		// Publisher - who's publishing, checked against policies. Set from the authenticated caller, never from the body.
+		Publisher *Identity `json:"-"`
 	}
 )
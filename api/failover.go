@@ -0,0 +1,41 @@
+package api
+
+import (
+	"net/http"
+)
+
+type (
+	// Failover - answers calls to services without instances through a chain of fallbacks, instead of 404
+	Failover interface {
+		// Wrap - wraps the handler of a service, remembering its last good responses when its chain wants them
+		Wrap(string, http.Handler) http.Handler
+		// Fallback - handler walking the chain of a service by its name, nil when it has no chain
+		Fallback(string) http.Handler
+		// Set - add or replace the chain of a service
+		Set(*FallbackChain) error
+		// Remove - remove the chain of a service by its name, dropping its last good responses
+		Remove(string)
+		// Chains - list all chains
+		Chains() []*FallbackChain
+	}
+
+	// FallbackChain - the fallbacks of a service, tried in order until one can answer
+	FallbackChain struct {
+		Service string          `json:"service"` // name of the service
+		Steps   []*FallbackStep `json:"steps"`   // fallbacks in the order they're tried
+	}
+
+	// FallbackStep - exactly one of the fields is set
+	FallbackStep struct {
+		Service  string          `json:"service,omitempty"`  // forward to another service, when it has instances
+		Static   *StaticResponse `json:"static,omitempty"`   // answer with a static response
+		LastGood bool            `json:"lastGood,omitempty"` // answer with the last good response to a GET of the same url, when there is one
+	}
+
+	// StaticResponse - a response declared up front
+	StaticResponse struct {
+		Status  int               `json:"status,omitempty"`  // defaults to 200
+		Headers map[string]string `json:"headers,omitempty"` // headers of the response
+		Body    string            `json:"body,omitempty"`    // body of the response
+	}
+)
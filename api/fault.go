@@ -0,0 +1,48 @@
+package api
+
+import (
+	"net/http"
+)
+
+type (
+	// FaultInjector - injects failures into calls to, and event deliveries to, services, to see how the rest copes
+	FaultInjector interface {
+		// Wrap - wraps the handler of a service, delaying, aborting or resetting a share of the calls
+		Wrap(string, http.Handler) http.Handler
+		// Delivery - call before delivering an event to a service by its name, delays and returns the injected failure if any
+		Delivery(string) error
+		// Set - add or replace the faults of a service
+		Set(*Fault) error
+		// Remove - stop injecting faults into a service by its name
+		Remove(string)
+		// Faults - list all faults
+		Faults() []*Fault
+	}
+
+	// Fault - what to inject into a service, a call that's delayed may still be aborted or reset
+	Fault struct {
+		Service         string        `json:"service"`                   // name of the service
+		Delay           *FaultDelay   `json:"delay,omitempty"`           // delay calls before they're forwarded
+		Abort           *FaultAbort   `json:"abort,omitempty"`           // answer calls with a status instead of forwarding them
+		Reset           *FaultPercent `json:"reset,omitempty"`           // close the connection of calls without answering
+		DeliveryDelay   *FaultDelay   `json:"deliveryDelay,omitempty"`   // delay event deliveries
+		DeliveryFailure *FaultPercent `json:"deliveryFailure,omitempty"` // fail event deliveries without trying
+	}
+
+	// FaultDelay - a delay of a share of calls or deliveries
+	FaultDelay struct {
+		Percent  float64 `json:"percent"`  // share of calls, 0-100
+		Duration string  `json:"duration"` // how long to delay them, ie 500ms
+	}
+
+	// FaultAbort - a status to answer a share of calls with
+	FaultAbort struct {
+		Percent float64 `json:"percent"`          // share of calls, 0-100
+		Status  int     `json:"status,omitempty"` // status to answer with, defaults to 503
+	}
+
+	// FaultPercent - a share of calls or deliveries to fail
+	FaultPercent struct {
+		Percent float64 `json:"percent"` // share of calls, 0-100
+	}
+)
@@ -0,0 +1,33 @@
+package api
+
+import (
+	"net/http"
+)
+
+type (
+	// Hedger - sends a second request to another instance when the first is slow, the first answer wins
+	Hedger interface {
+		// Wrap - wraps the handler of a service, running it a second time when the first call is slower than the delay
+		Wrap(string, http.Handler) http.Handler
+		// WrapInstance - wraps the handler of one instance, remembering that the request went there
+		WrapInstance(Service, http.Handler) http.Handler
+		// Filter - keep second requests away from the instance that got the first one
+		Filter(*http.Request, []Service) []Service
+		// Set - add or replace the hedging of a service
+		Set(*Hedge) error
+		// Remove - stop hedging calls to a service by its name
+		Remove(string)
+		// Hedges - list all hedges
+		Hedges() []*Hedge
+	}
+
+	// Hedge - which calls to a service are hedged and after how long
+	Hedge struct {
+		Service    string   `json:"service"`              // name of the service
+		Routes     []string `json:"routes,omitempty"`     // only requests matched by the routes with these names, all requests when empty
+		Methods    []string `json:"methods,omitempty"`    // idempotent methods to hedge, defaults to GET & HEAD
+		Percentile float64  `json:"percentile,omitempty"` // hedge calls slower than this percentile of recent calls, defaults to 95
+		Delay      string   `json:"delay,omitempty"`      // used until enough calls have been seen, defaults to 100ms
+		MaxBody    int64    `json:"maxBody,omitempty"`    // requests with larger bodies are not hedged, larger responses are streamed by the first attempt to outgrow it. Defaults to 1MB
+	}
+)
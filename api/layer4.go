@@ -0,0 +1,26 @@
+package api
+
+type (
+	// Layer4Proxy - forwards tcp connections & udp datagrams to services
+	Layer4Proxy interface {
+		Lifecycle
+		// Listen - start listening for a service
+		Listen(*Listener) error
+		// Close - stop a listener by its name, closing its connections
+		Close(string) error
+		// Listeners - list all listeners
+		Listeners() []*Listener
+		// SetLoadBalancer - set the loadbalancer to pick instances with
+		SetLoadBalancer(LoadBalancer)
+	}
+
+	// Listener - a port that forwards to a service
+	Listener struct {
+		Name         string `json:"name"`                   // unique name of the listener
+		Protocol     string `json:"protocol"`               // tcp or udp
+		Address      string `json:"address"`                // address to listen on, ie :5432
+		Service      string `json:"service"`                // name of the service to forward to
+		DrainTimeout string `json:"drainTimeout,omitempty"` // how long connections to a deregistered instance may live on, defaults to 30s
+		IdleTimeout  string `json:"idleTimeout,omitempty"`  // udp sessions without traffic are dropped after this, defaults to 1m
+	}
+)
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"net/http"
+	"time"
+)
+
+type (
+	// RequestMirror - copies a share of the requests to a service over to a shadow service
+	RequestMirror interface {
+		// Wrap - wraps the handler of a service, mirroring requests when a mirror is configured for it
+		Wrap(string, http.Handler) http.Handler
+		// Set - add or replace the mirror of a service
+		Set(*Mirror) error
+		// Remove - remove the mirror of a service by its name
+		Remove(string)
+		// Mirrors - list all mirrors
+		Mirrors() []*Mirror
+	}
+
+	// MirrorRecorder - receives the outcome of every mirrored request
+	MirrorRecorder interface {
+		// Record - called once both the primary and the shadow request has finished
+		Record(*MirrorResult)
+	}
+
+	// Mirror - details of how to mirror requests of a service
+	Mirror struct {
+		Service string  `json:"service"`           // name of the service to mirror
+		Shadow  string  `json:"shadow"`            // name of the service receiving the copies
+		Percent float64 `json:"percent"`           // share of requests to mirror, 0-100
+		MaxBody int64   `json:"maxBody,omitempty"` // requests with larger bodies are not mirrored, defaults to 1mb
+		Timeout string  `json:"timeout,omitempty"` // max time to wait for the shadow, defaults to 30s
+	}
+
+	// MirrorResult - the primary and shadow outcome of a mirrored request
+	MirrorResult struct {
+		Service       string
+		Shadow        string
+		Method        string
+		Path          string
+		Status        int
+		ShadowStatus  int
+		Latency       time.Duration
+		ShadowLatency time.Duration
+		ShadowError   error
+	}
+)
@@ -0,0 +1,36 @@
+package api
+
+import (
+	"net/http"
+)
+
+type (
+	// OutlierDetector - watches calls to instances and keeps the ones that misbehave out of the pool for a while
+	OutlierDetector interface {
+		Lifecycle
+		// Filter - remove ejected instances from the pool given to the loadbalancer, it never returns an empty pool
+		Filter([]Service) []Service
+		// WrapInstance - wraps the handler of one instance, watching how its calls go
+		WrapInstance(Service, http.Handler) http.Handler
+		// Set - add or replace the outlier detection of a service
+		Set(*OutlierDetection) error
+		// Remove - stop detecting outliers of a service by its name, letting all of its instances back
+		Remove(string)
+		// Detections - list all outlier detections
+		Detections() []*OutlierDetection
+		// Ejected - list the ids of the ejected instances of a service by its name
+		Ejected(string) []string
+	}
+
+	// OutlierDetection - when to eject instances of a service and for how long, detectors left at 0 are off
+	OutlierDetection struct {
+		Service                  string  `json:"service"`                            // name of the service
+		ConsecutiveErrors        int     `json:"consecutiveErrors,omitempty"`        // 5xx answers in a row
+		ConsecutiveGatewayErrors int     `json:"consecutiveGatewayErrors,omitempty"` // 502, 503 & 504 answers in a row
+		LatencyFactor            float64 `json:"latencyFactor,omitempty"`            // average latency this many times the median of the siblings
+		MinRequests              int     `json:"minRequests,omitempty"`              // calls an instance needs before its latency is judged, defaults to 10
+		BaseEjectionTime         string  `json:"baseEjectionTime,omitempty"`         // multiplied by the number of ejections in a row, defaults to 30s
+		MaxEjectionTime          string  `json:"maxEjectionTime,omitempty"`          // longest ejection, defaults to 5m
+		MaxEjectionPercent       int     `json:"maxEjectionPercent,omitempty"`       // share of instances that may be ejected at once, defaults to 10. One may always be ejected, but never all.
+	}
+)
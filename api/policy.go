@@ -0,0 +1,40 @@
+package api
+
+import (
+	"net/http"
+)
+
+type (
+	// PolicyEngine - decides which callers may call which services and publish to which topics
+	PolicyEngine interface {
+		// Wrap - wraps the handler of a service, answering 403 when the authenticated caller may not call it
+		Wrap(string, http.Handler) http.Handler
+		// AuthorizeCall - may the identity (nil when unauthenticated) call the service with method & path, errors when not
+		AuthorizeCall(*Identity, string, string, string) error
+		// AuthorizePublish - may the identity (nil when unauthenticated) publish to the topic, errors when not
+		AuthorizePublish(*Identity, string) error
+		// Load - replace the policy
+		Load(*Policy) error
+		// Policy - the current policy, nil when everything is allowed
+		Policy() *Policy
+	}
+
+	// Policy - allow & deny rules, a matching deny rule always wins over matching allow rules
+	Policy struct {
+		DefaultDeny bool          `json:"defaultDeny"` // deny what no rule matches, otherwise it's allowed
+		Rules       []*PolicyRule `json:"rules"`
+	}
+
+	// PolicyRule - what a rule matches, empty lists match anything. Patterns ending with * match by prefix.
+	// Rules with services match calls, rules with topics match publishes and rules with neither match both.
+	PolicyRule struct {
+		Name     string            `json:"name"`
+		Effect   string            `json:"effect"`             // allow or deny
+		Subjects []string          `json:"subjects,omitempty"` // subjects of callers, * matches any authenticated caller
+		Claims   map[string]string `json:"claims,omitempty"`   // claims callers must have
+		Services []string          `json:"services,omitempty"` // names of services
+		Methods  []string          `json:"methods,omitempty"`  // http methods
+		Paths    []string          `json:"paths,omitempty"`    // paths, relative to the service
+		Topics   []string          `json:"topics,omitempty"`   // topics published to
+	}
+)
@@ -1,24 +1,72 @@
 package api
 
 import (
+	"net/http"
+
 	"github.com/gin-gonic/gin"
 )
 
 type (
 	// Proxy - interface to forward http requests
 	Proxy interface {
-		// ForwarderFor - looks through internal registry for Forwarders matching the provided service
+		// ForwarderFor - the gin twin of HandlerFor, it strips /call/<name> from the path unless a route matched
 		ForwarderFor(string) (gin.HandlerFunc, error)
 
-		// RegisterForwarder - allows us ot register forwarders for service types
+		// HandlerFor - the service as a http.Handler for the standard mux, chi or any other router. Instances are looked up per request,
+		// and the path is forwarded as is unless a route matched, so mount it with http.StripPrefix.
+		// Everything set on the proxy wraps it, ForwarderFor runs it as a gin handler.
+		HandlerFor(string) http.Handler
+
+		// RegisterForwarder - allows us ot register gin forwarders for service types, they're run as a HttpForwarder
 		RegisterForwarder(string, Forwarder)
 
+		// RegisterHttpForwarder - allows us to register forwarders written against net/http for service types
+		RegisterHttpForwarder(string, HttpForwarder)
+
 		// SetLoadbalancerFactory - allows us to register a loadbalancer factory
 		SetLoadBalancer(LoadBalancer)
+
+		// SetTrafficSplitter - allows us to split traffic between versions of a service, sits between lookup & loadbalancing
+		SetTrafficSplitter(TrafficSplitter)
+
+		// SetOutlierDetector - allows us to keep misbehaving instances out of the pool for a while, sits between splitting & loadbalancing
+		SetOutlierDetector(OutlierDetector)
+
+		// SetHedger - allows us to send slow calls a second time to another instance, right around picking an instance
+		SetHedger(Hedger)
+
+		// SetFailover - allows us to answer calls to services without instances through fallbacks
+		SetFailover(Failover)
+
+		// SetFaultInjector - allows us to fail calls on purpose, right before they're forwarded
+		SetFaultInjector(FaultInjector)
+
+		// SetConcurrencyLimiter - allows us to limit how many calls services, and their instances, handle at once
+		SetConcurrencyLimiter(ConcurrencyLimiter)
+
+		// SetRequestMirror - allows us to copy requests to shadow services
+		SetRequestMirror(RequestMirror)
+
+		// SetResponseCache - allows us to answer GET & HEAD requests from a cache, responses from the cache are never mirrored
+		SetResponseCache(ResponseCache)
+
+		// SetRateLimiter - allows us to limit how often services are called, rejected requests are never mirrored
+		SetRateLimiter(RateLimiter)
+
+		// SetAuthenticator - allows us to verify callers of services that require it, before anything else happens
+		SetAuthenticator(Authenticator)
+
+		// SetPolicyEngine - allows us to decide which authenticated callers may call which services, right after authentication
+		SetPolicyEngine(PolicyEngine)
 	}
 
-	// Forwarder - interface defining the adapter that forwards the actual request and returns the actual response
+	// Forwarder - interface defining the adapter that forwards the actual request and returns the actual response, written against gin
 	Forwarder interface {
 		Handler(Service) gin.HandlerFunc
 	}
+
+	// HttpForwarder - a Forwarder written against net/http alone, what the proxy forwards with
+	HttpForwarder interface {
+		HttpHandler(Service) http.Handler
+	}
 )
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"net/http"
+	"time"
+)
+
+type (
+	// RateLimiter - limits how often a service may be called
+	RateLimiter interface {
+		// Wrap - wraps the handler of a service, answering 429 when a limit of the service is reached
+		Wrap(string, http.Handler) http.Handler
+		// Set - add or replace the limits of a service
+		Set(*RateLimit) error
+		// Remove - remove the limits of a service by its name
+		Remove(string)
+		// Limits - list all limits
+		Limits() []*RateLimit
+		// SetBackend - set the backend keeping the counters
+		SetBackend(RateLimitBackend)
+	}
+
+	// RateLimitBackend - keeps token buckets, share one between proxy replicas to limit them as a whole
+	RateLimitBackend interface {
+		// Take - take a token from the bucket with the key, refilled with rate tokens/s up to burst.
+		// When the bucket is empty it returns false and the time until there's a token again.
+		Take(string, float64, int) (bool, time.Duration, error)
+	}
+
+	// RateLimit - the limits of a service, a request must pass all of its rules
+	RateLimit struct {
+		Service string           `json:"service"` // name of the service
+		Rules   []*RateLimitRule `json:"rules"`
+	}
+
+	// RateLimitRule - a token bucket per key
+	RateLimitRule struct {
+		Key    string  `json:"key,omitempty"`    // what to count by: service (default), ip, apikey or header
+		Header string  `json:"header,omitempty"` // header to count by, for apikey it defaults to X-Api-Key
+		Route  string  `json:"route,omitempty"`  // only count requests matched by the route with this name
+		Rate   float64 `json:"rate"`             // requests per second
+		Burst  int     `json:"burst,omitempty"`  // requests allowed at once, defaults to rate
+	}
+)
@@ -0,0 +1,39 @@
+package api
+
+import "net/http"
+
+type (
+	// Router - maps incoming requests to services by host, path, method & headers
+	Router interface {
+		// Match - find the best route for the request, nil if none matched
+		Match(*http.Request) *Match
+		// Add - add a route, replacing any existing route with the same name
+		Add(*Route) error
+		// Remove - remove a route by its name
+		Remove(string) error
+		// Routes - list all routes in the order they are evaluated
+		Routes() []*Route
+		// Load - replace all routes with the provided ones
+		Load([]*Route) error
+	}
+
+	// Route - a declarative routing rule
+	Route struct {
+		Name        string            `json:"name"`                  // unique name of the route
+		Service     string            `json:"service"`               // name of the service to route to
+		Priority    int               `json:"priority,omitempty"`    // higher priorities are evaluated first
+		Host        string            `json:"host,omitempty"`        // exact host or wildcard (*.example.com)
+		Prefix      string            `json:"prefix,omitempty"`      // path prefix (/api/users)
+		Regex       string            `json:"regex,omitempty"`       // path regex, used instead of prefix
+		Methods     []string          `json:"methods,omitempty"`     // allowed methods, empty means all
+		Headers     map[string]string `json:"headers,omitempty"`     // headers that must be present with the value, empty value means any
+		StripPrefix bool              `json:"stripPrefix,omitempty"` // remove the prefix before forwarding
+		Rewrite     string            `json:"rewrite,omitempty"`     // replaces the prefix, or a regex template ($1) when regex is used
+	}
+
+	// Match - the outcome of routing a request
+	Match struct {
+		Route *Route // the route that matched
+		Path  string // the path to forward, relative to the service context
+	}
+)
@@ -11,18 +11,22 @@ type (
 		GetSubscriptions() []*Subscription
 		GetScheme() string
 		GetType() string
+		GetVersion() string
+		GetAuth() *AuthRequirements
 	}
 
 	// DefaultService - implements a service
 	DefaultService struct {
-		ID            string          `json:"id"`                      // used in deregister
-		Name          string          `json:"name"`                    // used in path (/call/<name>/...)
-		Address       string          `json:"address"`                 // ip/hostname
-		Port          int             `json:"port"`                    // port 1024+
-		Context       string          `json:"context"`                 // used in routing
-		Subscriptions []*Subscription `json:"subscriptions,omitempty"` // event subscriptions
-		Scheme        string          `json:"scheme,omitempty"`        // optional scheme (if not http)
-		Type          string          `json:"type"`                    // service type, as a way to decide how to deliver the payload
+		ID            string            `json:"id"`                      // used in deregister
+		Name          string            `json:"name"`                    // used in path (/call/<name>/...)
+		Address       string            `json:"address"`                 // ip/hostname
+		Port          int               `json:"port"`                    // port 1024+
+		Context       string            `json:"context"`                 // used in routing
+		Subscriptions []*Subscription   `json:"subscriptions,omitempty"` // event subscriptions
+		Scheme        string            `json:"scheme,omitempty"`        // optional scheme (if not http)
+		Type          string            `json:"type"`                    // service type, as a way to decide how to deliver the payload
+		Version       string            `json:"version,omitempty"`       // optional version, used when splitting traffic
+		Auth          *AuthRequirements `json:"auth,omitempty"`          // optional auth callers must pass before reaching the service
 	}
 
 	// Subscription - details needed for an event subscriptions
@@ -66,3 +70,11 @@ func (s *DefaultService) GetScheme() string {
 func (s *DefaultService) GetType() string {
 	return s.Type
 }
+
+func (s *DefaultService) GetVersion() string {
+	return s.Version
+}
+
+func (s *DefaultService) GetAuth() *AuthRequirements {
+	return s.Auth
+}
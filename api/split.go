@@ -0,0 +1,33 @@
+package api
+
+import "net/http"
+
+type (
+	// TrafficSplitter - decides which versions of a service should receive a request
+	TrafficSplitter interface {
+		// Split - narrow the pool of services down to the ones that should handle the request
+		Split(*http.Request, []Service) []Service
+		// Set - add or replace the split of a service
+		Set(*Split) error
+		// Remove - remove the split of a service by its name
+		Remove(string)
+		// Splits - list all splits
+		Splits() []*Split
+	}
+
+	// Split - how traffic to a service is divided between its versions
+	Split struct {
+		Service string         `json:"service"`           // name of the service
+		Rules   []*SplitRule   `json:"rules,omitempty"`   // evaluated in order before weights
+		Weights map[string]int `json:"weights,omitempty"` // version -> weight
+		Sticky  string         `json:"sticky,omitempty"`  // header or cookie identifying a client, defaults to client ip
+	}
+
+	// SplitRule - send requests with a header or cookie to a version
+	SplitRule struct {
+		Header  string `json:"header,omitempty"` // header name, ie X-Canary
+		Cookie  string `json:"cookie,omitempty"` // cookie name
+		Value   string `json:"value,omitempty"`  // expected value, empty means any
+		Version string `json:"version"`          // version to route to
+	}
+)
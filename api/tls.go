@@ -0,0 +1,27 @@
+package api
+
+import "crypto/tls"
+
+type (
+	// UpstreamTLS - keeps the tls settings used to reach the instances of services
+	UpstreamTLS interface {
+		// Config - the tls config of a service by its name, nil when it has no settings
+		Config(string) *tls.Config
+		// Set - add or replace the settings of a service
+		Set(*TLSSettings) error
+		// Remove - remove the settings of a service by its name
+		Remove(string)
+		// Settings - list all settings
+		Settings() []*TLSSettings
+	}
+
+	// TLSSettings - how to talk tls to a service, files are reloaded when they change on disk
+	TLSSettings struct {
+		Service    string `json:"service"`              // name of the service
+		CA         string `json:"ca,omitempty"`         // pem bundle of CAs to trust, defaults to the system roots
+		Cert       string `json:"cert,omitempty"`       // client certificate, for mutual tls
+		Key        string `json:"key,omitempty"`        // key of the client certificate
+		ServerName string `json:"serverName,omitempty"` // server name to send and verify, defaults to the address of the instance
+		Verify     string `json:"verify,omitempty"`     // full (default), chain to skip the hostname check or none
+	}
+)
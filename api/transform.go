@@ -0,0 +1,38 @@
+package api
+
+import "net/http"
+
+type (
+	// Transformer - keeps the transformations of requests to, and responses from, services
+	Transformer interface {
+		// Set - add a transformation, replacing any existing transformation with the same name
+		Set(*Transformation) error
+		// Remove - remove a transformation by its name
+		Remove(string)
+		// Transformations - list all transformations
+		Transformations() []*Transformation
+		// For - the transformations of a service that apply to the request, the ones without route first
+		For(string, *http.Request) []*Transformation
+	}
+
+	// Transformation - changes made to requests to a service and the responses it gives, optionally only for a route
+	Transformation struct {
+		Name     string     `json:"name"`               // unique name of the transformation
+		Service  string     `json:"service"`            // name of the service
+		Route    string     `json:"route,omitempty"`    // only requests matched by the route with this name
+		Request  *Transform `json:"request,omitempty"`  // changes to requests
+		Response *Transform `json:"response,omitempty"` // changes to responses
+	}
+
+	// Transform - changes to headers & json bodies, applied in the order the fields are declared
+	Transform struct {
+		RenameHeaders   map[string]string `json:"renameHeaders,omitempty"`   // from -> to
+		RemoveHeaders   []string          `json:"removeHeaders,omitempty"`   // headers to remove
+		SetHeaders      map[string]string `json:"setHeaders,omitempty"`      // headers to add or replace
+		InstanceHeader  string            `json:"instanceHeader,omitempty"`  // header to put the id of the instance in
+		UnwrapBody      string            `json:"unwrapBody,omitempty"`      // replace json bodies with the value under this key, dots for nested keys
+		WrapBody        string            `json:"wrapBody,omitempty"`        // wrap json bodies in an object under this key, dots for nested keys
+		RewriteLocation bool              `json:"rewriteLocation,omitempty"` // responses only, point redirects to the service back at the proxy
+		MaxBody         int64             `json:"maxBody,omitempty"`         // larger bodies are passed on untouched, defaults to 1mb
+	}
+)
@@ -1,13 +1,60 @@
 package modulr
 
 import (
+	"github.com/Meduzz/modulr/lib/auth"
+	"github.com/Meduzz/modulr/lib/cache"
+	"github.com/Meduzz/modulr/lib/concurrency"
 	"github.com/Meduzz/modulr/lib/event"
+	"github.com/Meduzz/modulr/lib/failover"
+	"github.com/Meduzz/modulr/lib/fault"
+	"github.com/Meduzz/modulr/lib/hedge"
+	"github.com/Meduzz/modulr/lib/layer4"
+	"github.com/Meduzz/modulr/lib/mirror"
+	"github.com/Meduzz/modulr/lib/outlier"
+	"github.com/Meduzz/modulr/lib/policy"
 	"github.com/Meduzz/modulr/lib/proxy"
+	"github.com/Meduzz/modulr/lib/ratelimit"
 	"github.com/Meduzz/modulr/lib/registry"
+	"github.com/Meduzz/modulr/lib/router"
+	"github.com/Meduzz/modulr/lib/split"
+	"github.com/Meduzz/modulr/lib/transform"
+	"github.com/Meduzz/modulr/lib/transport"
 )
 
 var (
-	ServiceRegistry = registry.NewServiceRegistry()
-	HttpProxy       = proxy.NewProxy(ServiceRegistry)
-	EventSupport    = event.NewEventSupport(ServiceRegistry)
+	ServiceRegistry    = registry.NewServiceRegistry()
+	HttpProxy          = proxy.NewProxy(ServiceRegistry)
+	EventSupport       = event.NewEventSupport(ServiceRegistry)
+	Router             = router.NewRouter()
+	TrafficSplitter    = split.NewTrafficSplitter()
+	OutlierDetector    = outlier.NewOutlierDetector(ServiceRegistry)
+	Hedger             = hedge.NewHedger(ServiceRegistry)
+	Failover           = failover.NewFailover(ServiceRegistry, HttpProxy)
+	MirrorStats        = mirror.NewStatsRecorder()
+	RequestMirror      = mirror.NewRequestMirror(HttpProxy, MirrorStats)
+	Layer4Proxy        = layer4.NewLayer4Proxy(ServiceRegistry)
+	UpstreamTLS        = transport.NewUpstreamTLS()
+	RateLimiter        = ratelimit.NewRateLimiter()
+	ResponseCache      = cache.NewResponseCache(ServiceRegistry)
+	Transformer        = transform.NewTransformer()
+	FaultInjector      = fault.NewFaultInjector()
+	ConcurrencyLimiter = concurrency.NewConcurrencyLimiter(ServiceRegistry)
+	Authenticator      = auth.NewAuthenticator()
+	PolicyEngine       = policy.NewPolicyEngine()
 )
+
+func init() {
+	HttpProxy.SetTrafficSplitter(TrafficSplitter)
+	HttpProxy.SetOutlierDetector(OutlierDetector)
+	HttpProxy.SetHedger(Hedger)
+	HttpProxy.SetFailover(Failover)
+	HttpProxy.SetFaultInjector(FaultInjector)
+	HttpProxy.SetConcurrencyLimiter(ConcurrencyLimiter)
+	HttpProxy.SetRequestMirror(RequestMirror)
+	HttpProxy.SetResponseCache(ResponseCache)
+	HttpProxy.SetRateLimiter(RateLimiter)
+	HttpProxy.SetAuthenticator(Authenticator)
+	HttpProxy.SetPolicyEngine(PolicyEngine)
+	EventSupport.SetPolicyEngine(PolicyEngine)
+	EventSupport.SetFaultInjector(FaultInjector)
+}
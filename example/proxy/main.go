@@ -2,81 +2,577 @@ package main
 
 import (
 	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/Meduzz/modulr"
+	_ "github.com/Meduzz/modulr/adapter/cache/inmemory"
 	_ "github.com/Meduzz/modulr/adapter/event/adapter/nats"
 	_ "github.com/Meduzz/modulr/adapter/event/delivery/http"
 	_ "github.com/Meduzz/modulr/adapter/loadbalancer/roundrobin"
+	"github.com/Meduzz/modulr/adapter/proxy/grpc"
 	_ "github.com/Meduzz/modulr/adapter/proxy/http"
+	_ "github.com/Meduzz/modulr/adapter/proxy/inprocess"
+	_ "github.com/Meduzz/modulr/adapter/proxy/nats"
+	_ "github.com/Meduzz/modulr/adapter/proxy/static"
+	_ "github.com/Meduzz/modulr/adapter/ratelimit/inmemory"
 	_ "github.com/Meduzz/modulr/adapter/registry/inmemory"
 	"github.com/Meduzz/modulr/api"
+	"github.com/Meduzz/modulr/lib/auth"
+	"github.com/Meduzz/modulr/lib/policy"
+	"github.com/Meduzz/modulr/lib/router"
+	"github.com/Meduzz/modulr/lib/server"
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
+	methods := authMethods()
+
+	// POLICY=<json file> loads the policy at startup
+	if path := os.Getenv("POLICY"); path != "" {
+		err := policy.LoadFile(modulr.PolicyEngine, path)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	srv := gin.Default()
+	srv.UseH2C = true // lets grpc clients talk to us without tls
+
+	// register, deregister, list & lookup, call, publish, request & health
+	endpoints, err := server.NewEndpoints(&server.Options{
+		Registry:      modulr.ServiceRegistry,
+		Proxy:         modulr.HttpProxy,
+		Events:        modulr.EventSupport,
+		Authenticator: modulr.Authenticator,
+		AuthMethods:   methods,
+	})
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	endpoints.Mount(srv)
 
-	// registers a service - naive version
-	srv.POST("/register", func(ctx *gin.Context) {
-		service := &api.DefaultService{
-			Scheme: "http",
+	// everything below changes or reveals how the proxy behaves, so only admins get to it
+	control := srv.Group("", admin(methods)...)
+
+	// replaces the policy deciding who may call & publish what - naive version
+	control.PUT("/policy", func(ctx *gin.Context) {
+		rules := &api.Policy{}
+		err := ctx.BindJSON(rules)
+
+		if err != nil {
+			return
 		}
 
-		ctx.BindJSON(service)
+		err = modulr.PolicyEngine.Load(rules)
 
-		err := modulr.ServiceRegistry.Register(service)
+		if err != nil {
+			ctx.AbortWithError(400, err)
+			return
+		}
+
+		ctx.Status(200)
+	})
+
+	control.GET("/policy", func(ctx *gin.Context) {
+		ctx.JSON(200, modulr.PolicyEngine.Policy())
+	})
+
+	// adds or replaces a route - naive version
+	control.POST("/routes", func(ctx *gin.Context) {
+		route := &api.Route{}
+		err := ctx.BindJSON(route)
 
 		if err != nil {
-			ctx.AbortWithError(500, err)
 			return
 		}
 
-		log.Printf("service named %s, of type %s, was registered\n", service.GetName(), service.GetType())
+		err = modulr.Router.Add(route)
+
+		if err != nil {
+			ctx.AbortWithError(400, err)
+			return
+		}
 
 		ctx.Status(200)
 	})
 
-	// deregisters a service - naive version
-	srv.DELETE("/deregister/:name/:id", func(ctx *gin.Context) {
-		name := ctx.Param("name")
-		id := ctx.Param("id")
+	control.GET("/routes", func(ctx *gin.Context) {
+		ctx.JSON(200, modulr.Router.Routes())
+	})
 
-		_, err := modulr.ServiceRegistry.Deregister(name, id)
+	control.DELETE("/routes/:name", func(ctx *gin.Context) {
+		err := modulr.Router.Remove(ctx.Param("name"))
 
 		if err != nil {
-			ctx.AbortWithError(500, err)
+			ctx.AbortWithError(404, err)
 			return
 		}
 
 		ctx.Status(200)
 	})
 
-	srv.Any("/call/:service/*path", func(ctx *gin.Context) {
-		name := ctx.Param("service")
+	// adds or replaces how traffic is split between versions of a service - naive version
+	control.POST("/splits", func(ctx *gin.Context) {
+		split := &api.Split{}
+		err := ctx.BindJSON(split)
 
-		handler, err := modulr.HttpProxy.ForwarderFor(name)
+		if err != nil {
+			return
+		}
+
+		err = modulr.TrafficSplitter.Set(split)
 
 		if err != nil {
-			ctx.AbortWithError(500, err)
+			ctx.AbortWithError(400, err)
 			return
 		}
 
-		handler(ctx)
+		ctx.Status(200)
 	})
 
-	srv.POST("/publish", func(ctx *gin.Context) {
-		event := &api.Event{}
-		ctx.BindJSON(event)
+	control.GET("/splits", func(ctx *gin.Context) {
+		ctx.JSON(200, modulr.TrafficSplitter.Splits())
+	})
 
-		err := modulr.EventSupport.Publish(event)
+	control.DELETE("/splits/:name", func(ctx *gin.Context) {
+		modulr.TrafficSplitter.Remove(ctx.Param("name"))
+		ctx.Status(200)
+	})
+
+	// adds or replaces the mirror of a service - naive version
+	control.POST("/mirrors", func(ctx *gin.Context) {
+		mirror := &api.Mirror{}
+		err := ctx.BindJSON(mirror)
+
+		if err != nil {
+			return
+		}
+
+		err = modulr.RequestMirror.Set(mirror)
+
+		if err != nil {
+			ctx.AbortWithError(400, err)
+			return
+		}
+
+		ctx.Status(200)
+	})
+
+	control.GET("/mirrors", func(ctx *gin.Context) {
+		ctx.JSON(200, modulr.RequestMirror.Mirrors())
+	})
+
+	control.GET("/mirrors/:name/stats", func(ctx *gin.Context) {
+		ctx.JSON(200, modulr.MirrorStats.Stats(ctx.Param("name")))
+	})
+
+	control.DELETE("/mirrors/:name", func(ctx *gin.Context) {
+		modulr.RequestMirror.Remove(ctx.Param("name"))
+		ctx.Status(200)
+	})
+
+	// starts detecting outliers among the instances of a service, or replaces how - naive version
+	control.POST("/outliers", func(ctx *gin.Context) {
+		detection := &api.OutlierDetection{}
+		err := ctx.BindJSON(detection)
+
+		if err != nil {
+			return
+		}
+
+		err = modulr.OutlierDetector.Set(detection)
 
 		if err != nil {
-			ctx.AbortWithError(500, err)
+			ctx.AbortWithError(400, err)
 			return
 		}
 
 		ctx.Status(200)
 	})
 
-	srv.Run(":8085")
+	control.GET("/outliers", func(ctx *gin.Context) {
+		ctx.JSON(200, modulr.OutlierDetector.Detections())
+	})
+
+	// lists the instances of a service that are currently ejected
+	control.GET("/outliers/:name", func(ctx *gin.Context) {
+		ctx.JSON(200, modulr.OutlierDetector.Ejected(ctx.Param("name")))
+	})
+
+	control.DELETE("/outliers/:name", func(ctx *gin.Context) {
+		modulr.OutlierDetector.Remove(ctx.Param("name"))
+		ctx.Status(200)
+	})
+
+	// starts hedging slow calls to a service, or replaces how - naive version
+	control.POST("/hedges", func(ctx *gin.Context) {
+		hedge := &api.Hedge{}
+		err := ctx.BindJSON(hedge)
+
+		if err != nil {
+			return
+		}
+
+		err = modulr.Hedger.Set(hedge)
+
+		if err != nil {
+			ctx.AbortWithError(400, err)
+			return
+		}
+
+		ctx.Status(200)
+	})
+
+	control.GET("/hedges", func(ctx *gin.Context) {
+		ctx.JSON(200, modulr.Hedger.Hedges())
+	})
+
+	control.DELETE("/hedges/:name", func(ctx *gin.Context) {
+		modulr.Hedger.Remove(ctx.Param("name"))
+		ctx.Status(200)
+	})
+
+	// declares how a service degrades when it has no instances, or replaces it - naive version
+	control.POST("/fallbacks", func(ctx *gin.Context) {
+		chain := &api.FallbackChain{}
+		err := ctx.BindJSON(chain)
+
+		if err != nil {
+			return
+		}
+
+		err = modulr.Failover.Set(chain)
+
+		if err != nil {
+			ctx.AbortWithError(400, err)
+			return
+		}
+
+		ctx.Status(200)
+	})
+
+	control.GET("/fallbacks", func(ctx *gin.Context) {
+		ctx.JSON(200, modulr.Failover.Chains())
+	})
+
+	control.DELETE("/fallbacks/:name", func(ctx *gin.Context) {
+		modulr.Failover.Remove(ctx.Param("name"))
+		ctx.Status(200)
+	})
+
+	// adds or replaces the concurrency limits of a service - naive version
+	control.POST("/concurrency", func(ctx *gin.Context) {
+		limit := &api.ConcurrencyLimit{}
+		err := ctx.BindJSON(limit)
+
+		if err != nil {
+			return
+		}
+
+		err = modulr.ConcurrencyLimiter.Set(limit)
+
+		if err != nil {
+			ctx.AbortWithError(400, err)
+			return
+		}
+
+		ctx.Status(200)
+	})
+
+	control.GET("/concurrency", func(ctx *gin.Context) {
+		ctx.JSON(200, modulr.ConcurrencyLimiter.Limits())
+	})
+
+	control.DELETE("/concurrency/:name", func(ctx *gin.Context) {
+		modulr.ConcurrencyLimiter.Remove(ctx.Param("name"))
+		ctx.Status(200)
+	})
+
+	// starts injecting faults into a service, or replaces them - naive version, meant for staging
+	control.POST("/faults", func(ctx *gin.Context) {
+		fault := &api.Fault{}
+		err := ctx.BindJSON(fault)
+
+		if err != nil {
+			return
+		}
+
+		err = modulr.FaultInjector.Set(fault)
+
+		if err != nil {
+			ctx.AbortWithError(400, err)
+			return
+		}
+
+		ctx.Status(200)
+	})
+
+	control.GET("/faults", func(ctx *gin.Context) {
+		ctx.JSON(200, modulr.FaultInjector.Faults())
+	})
+
+	control.DELETE("/faults/:name", func(ctx *gin.Context) {
+		modulr.FaultInjector.Remove(ctx.Param("name"))
+		ctx.Status(200)
+	})
+
+	// adds or replaces the rate limits of a service - naive version
+	control.POST("/limits", func(ctx *gin.Context) {
+		limit := &api.RateLimit{}
+		err := ctx.BindJSON(limit)
+
+		if err != nil {
+			return
+		}
+
+		err = modulr.RateLimiter.Set(limit)
+
+		if err != nil {
+			ctx.AbortWithError(400, err)
+			return
+		}
+
+		ctx.Status(200)
+	})
+
+	control.GET("/limits", func(ctx *gin.Context) {
+		ctx.JSON(200, modulr.RateLimiter.Limits())
+	})
+
+	control.DELETE("/limits/:name", func(ctx *gin.Context) {
+		modulr.RateLimiter.Remove(ctx.Param("name"))
+		ctx.Status(200)
+	})
+
+	// enables caching of a service, or replaces its settings - naive version
+	control.POST("/caches", func(ctx *gin.Context) {
+		settings := &api.CacheSettings{}
+		err := ctx.BindJSON(settings)
+
+		if err != nil {
+			return
+		}
+
+		err = modulr.ResponseCache.Set(settings)
+
+		if err != nil {
+			ctx.AbortWithError(400, err)
+			return
+		}
+
+		ctx.Status(200)
+	})
+
+	control.GET("/caches", func(ctx *gin.Context) {
+		ctx.JSON(200, modulr.ResponseCache.Settings())
+	})
+
+	control.DELETE("/caches/:name", func(ctx *gin.Context) {
+		modulr.ResponseCache.Remove(ctx.Param("name"))
+		ctx.Status(200)
+	})
+
+	// adds or replaces a transformation of requests to & responses from a service - naive version
+	control.POST("/transformations", func(ctx *gin.Context) {
+		transformation := &api.Transformation{}
+		err := ctx.BindJSON(transformation)
+
+		if err != nil {
+			return
+		}
+
+		err = modulr.Transformer.Set(transformation)
+
+		if err != nil {
+			ctx.AbortWithError(400, err)
+			return
+		}
+
+		ctx.Status(200)
+	})
+
+	control.GET("/transformations", func(ctx *gin.Context) {
+		ctx.JSON(200, modulr.Transformer.Transformations())
+	})
+
+	control.DELETE("/transformations/:name", func(ctx *gin.Context) {
+		modulr.Transformer.Remove(ctx.Param("name"))
+		ctx.Status(200)
+	})
+
+	// adds or replaces the upstream tls settings of a service - naive version
+	control.POST("/tls", func(ctx *gin.Context) {
+		settings := &api.TLSSettings{}
+		err := ctx.BindJSON(settings)
+
+		if err != nil {
+			return
+		}
+
+		err = modulr.UpstreamTLS.Set(settings)
+
+		if err != nil {
+			ctx.AbortWithError(400, err)
+			return
+		}
+
+		ctx.Status(200)
+	})
+
+	control.GET("/tls", func(ctx *gin.Context) {
+		ctx.JSON(200, modulr.UpstreamTLS.Settings())
+	})
+
+	control.DELETE("/tls/:name", func(ctx *gin.Context) {
+		modulr.UpstreamTLS.Remove(ctx.Param("name"))
+		ctx.Status(200)
+	})
+
+	// opens a tcp or udp port forwarding to a service - naive version
+	control.POST("/listeners", func(ctx *gin.Context) {
+		listener := &api.Listener{}
+		err := ctx.BindJSON(listener)
+
+		if err != nil {
+			return
+		}
+
+		err = modulr.Layer4Proxy.Listen(listener)
+
+		if err != nil {
+			ctx.AbortWithError(400, err)
+			return
+		}
+
+		ctx.Status(200)
+	})
+
+	control.GET("/listeners", func(ctx *gin.Context) {
+		ctx.JSON(200, modulr.Layer4Proxy.Listeners())
+	})
+
+	control.DELETE("/listeners/:name", func(ctx *gin.Context) {
+		err := modulr.Layer4Proxy.Close(ctx.Param("name"))
+
+		if err != nil {
+			ctx.AbortWithError(404, err)
+			return
+		}
+
+		ctx.Status(200)
+	})
+
+	// grpc calls go to the service named after the grpc service, everything else goes through the routing table
+	srv.NoRoute(grpc.Handler(modulr.HttpProxy), router.Handler(modulr.Router, modulr.HttpProxy))
+
+	// plain http on :8085, or whatever the config file given as the first argument says, ie tls with certificates per host
+	proxy, err := proxyServer(srv)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// health answers 503 once we're shutting down, the drain delay gives load balancers time to notice
+	// and calls in flight then get 30s to finish
+	proxy.OnShutdown(endpoints.Drain)
+
+	err = proxy.Run(30 * time.Second)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// authMethods - services that declare auth requirements can ask for jwt (JWKS=<file or url>, JWT_ISSUER=<iss>,
+// JWT_OPTIONAL_EXP=true to accept tokens that never expire),
+// apikey (API_KEYS=<json file of key -> subject>) or hmac (HMAC_KEYS=<json file of key id -> secret>) - naive version
+func authMethods() []string {
+	methods := make([]string, 0)
+
+	if source := os.Getenv("JWKS"); source != "" {
+		options := make([]auth.JWTOption, 0)
+
+		if os.Getenv("JWT_OPTIONAL_EXP") == "true" {
+			options = append(options, auth.OptionalExpiry())
+		}
+
+		method, err := auth.NewJWTMethod(source, os.Getenv("JWT_ISSUER"), options...)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		modulr.Authenticator.RegisterMethod("jwt", method)
+		methods = append(methods, "jwt")
+	}
+
+	if path := os.Getenv("API_KEYS"); path != "" {
+		keys, err := auth.LoadAPIKeys(path)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		modulr.Authenticator.RegisterMethod("apikey", auth.NewAPIKeyMethod(keys, ""))
+		methods = append(methods, "apikey")
+	}
+
+	if path := os.Getenv("HMAC_KEYS"); path != "" {
+		secrets, err := auth.LoadAPIKeys(path)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		modulr.Authenticator.RegisterMethod("hmac", auth.NewHMACMethod(secrets, 5*time.Minute))
+		methods = append(methods, "hmac")
+	}
+
+	return methods
+}
+
+// admin - callers authenticated with any of the methods, whose subject is one of ADMIN_SUBJECTS=<comma separated subjects>.
+// Without any methods only callers on the same host get through - naive version
+func admin(methods []string) []gin.HandlerFunc {
+	if len(methods) == 0 {
+		return []gin.HandlerFunc{func(ctx *gin.Context) {
+			host, _, _ := net.SplitHostPort(ctx.Request.RemoteAddr)
+			ip := net.ParseIP(host)
+
+			if ip == nil || !ip.IsLoopback() {
+				ctx.AbortWithStatus(http.StatusForbidden)
+			}
+		}}
+	}
+
+	subjects := strings.Split(os.Getenv("ADMIN_SUBJECTS"), ",")
+
+	authenticate := auth.Middleware(modulr.Authenticator, &api.AuthRequirements{Methods: methods})
+
+	return []gin.HandlerFunc{authenticate, func(ctx *gin.Context) {
+		identity := auth.IdentityFrom(ctx.Request.Context())
+
+		for _, it := range subjects {
+			if it != "" && identity != nil && identity.Subject == it {
+				return
+			}
+		}
+
+		ctx.AbortWithStatus(http.StatusForbidden)
+	}}
+}
+
+func proxyServer(handler *gin.Engine) (*server.Server, error) {
+	if len(os.Args) > 1 {
+		return server.LoadFile(os.Args[1], handler.Handler())
+	}
+
+	return server.NewServer(&server.Config{Addr: ":8085", DrainDelay: "5s"}, handler.Handler())
 }
@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"os"
+
+	"github.com/Meduzz/modulr/api"
+)
+
+type (
+	apiKeyMethod struct {
+		keys   map[string]string // key -> subject
+		header string
+	}
+)
+
+// APIKeyHeader - where api keys are read from, unless told otherwise
+const APIKeyHeader = "X-Api-Key"
+
+// NewAPIKeyMethod - authenticates static api keys, mapped to the subject they belong to.
+// Keys are read from the header, or X-Api-Key if it is empty.
+func NewAPIKeyMethod(keys map[string]string, header string) api.AuthMethod {
+	if header == "" {
+		header = APIKeyHeader
+	}
+
+	return &apiKeyMethod{
+		keys:   keys,
+		header: header,
+	}
+}
+
+// LoadAPIKeys - reads api keys from a json file, mapping keys to subjects
+func LoadAPIKeys(path string) (map[string]string, error) {
+	bs, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]string)
+	err = json.Unmarshal(bs, &keys)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+func (a *apiKeyMethod) Authenticate(req *http.Request) (*api.Identity, error) {
+	given := req.Header.Get(a.header)
+
+	if given == "" {
+		return nil, nil
+	}
+
+	subject := ""
+
+	// every key is compared, so that timing doesn't tell how close a guess was
+	for key, it := range a.keys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(given)) == 1 {
+			subject = it
+		}
+	}
+
+	if subject == "" {
+		return nil, nil
+	}
+
+	return &api.Identity{
+		Subject: subject,
+		Claims:  map[string]string{},
+	}, nil
+}
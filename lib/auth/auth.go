@@ -0,0 +1,184 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/Meduzz/modulr/api"
+)
+
+type (
+	authenticator struct {
+		methods map[string]api.AuthMethod // name -> method
+		lock    *sync.RWMutex
+	}
+
+	identityKey struct{}
+)
+
+const (
+	// HeaderPrefix - verified identities are passed on to services in headers with this prefix,
+	// headers with it are always removed from incoming requests
+	HeaderPrefix = "X-Auth-"
+	// SubjectHeader - who the caller is
+	SubjectHeader = HeaderPrefix + "Subject"
+	// MethodHeader - how the caller was authenticated
+	MethodHeader = HeaderPrefix + "Method"
+	// ClaimHeaderPrefix - followed by the name of a claim, ie X-Auth-Claim-Email
+	ClaimHeaderPrefix = HeaderPrefix + "Claim-"
+)
+
+// NewAuthenticator - creates a new authenticator without any methods
+func NewAuthenticator() api.Authenticator {
+	return &authenticator{
+		methods: make(map[string]api.AuthMethod),
+		lock:    &sync.RWMutex{},
+	}
+}
+
+// Wrap - services without requirements are called without authentication
+func (a *authenticator) Wrap(requirements *api.AuthRequirements, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		strip(req.Header)
+
+		if requirements == nil || len(requirements.Methods) == 0 {
+			handler.ServeHTTP(w, req)
+			return
+		}
+
+		identity, err := a.authenticate(req, requirements.Methods)
+
+		if err != nil {
+			log.Printf("Authenticating a call to %s threw error: %v\n", req.URL.Path, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if identity == nil {
+			if contains(requirements.Methods, "jwt") {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+			}
+
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if !meets(identity, requirements) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		forward(req.Header, identity)
+
+		handler.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), identityKey{}, identity)))
+	})
+}
+
+func (a *authenticator) RegisterMethod(name string, method api.AuthMethod) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	a.methods[name] = method
+}
+
+// IdentityFrom - fetch the identity of the caller from a request context, nil if none
+func IdentityFrom(ctx context.Context) *api.Identity {
+	identity, ok := ctx.Value(identityKey{}).(*api.Identity)
+
+	if !ok {
+		return nil
+	}
+
+	return identity
+}
+
+// authenticate - the first method that verifies the request wins, failed attempts are only logged.
+// It only errors when a method is required that was never registered.
+func (a *authenticator) authenticate(req *http.Request, methods []string) (*api.Identity, error) {
+	for _, name := range methods {
+		a.lock.RLock()
+		method, ok := a.methods[name]
+		a.lock.RUnlock()
+
+		if !ok {
+			return nil, fmt.Errorf("no auth method named %s", name)
+		}
+
+		identity, err := method.Authenticate(req)
+
+		if err != nil {
+			log.Printf("Authenticating %s %s with %s threw error: %v\n", req.Method, req.URL.Path, name, err)
+			continue
+		}
+
+		if identity != nil {
+			identity.Method = name
+			return identity, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func meets(identity *api.Identity, requirements *api.AuthRequirements) bool {
+	if requirements.Audience != "" && !contains(identity.Audience, requirements.Audience) {
+		return false
+	}
+
+	for claim, value := range requirements.Claims {
+		if identity.Claims[claim] != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// strip - callers must not be able to pass as someone else
+func strip(header http.Header) {
+	for key := range header {
+		if strings.HasPrefix(key, HeaderPrefix) {
+			header.Del(key)
+		}
+	}
+}
+
+func forward(header http.Header, identity *api.Identity) {
+	header.Set(SubjectHeader, identity.Subject)
+	header.Set(MethodHeader, identity.Method)
+
+	for claim, value := range identity.Claims {
+		name := headerName(claim)
+
+		if name != "" {
+			header.Set(ClaimHeaderPrefix+name, value)
+		}
+	}
+}
+
+// headerName - claims with characters that don't belong in a header name are skipped
+func headerName(claim string) string {
+	name := strings.ReplaceAll(claim, "_", "-")
+
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-') {
+			return ""
+		}
+	}
+
+	return name
+}
+
+func contains(list []string, it string) bool {
+	for _, item := range list {
+		if item == it {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Meduzz/modulr/api"
+)
+
+func TestAuthenticator(t *testing.T) {
+	subject := NewAuthenticator()
+	subject.RegisterMethod("apikey", NewAPIKeyMethod(map[string]string{"secret-key": "alice"}, ""))
+	subject.RegisterMethod("hmac", NewHMACMethod(map[string]string{"bob": "shared"}, time.Minute))
+
+	engine := func(requirements *api.AuthRequirements) http.Handler {
+		return subject.Wrap(requirements, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			body, _ := io.ReadAll(req.Body)
+			identity := IdentityFrom(req.Context())
+			subject := ""
+
+			if identity != nil {
+				subject = identity.Subject
+			}
+
+			fmt.Fprintf(w, "%s|%s|%s|%s", req.Header.Get(SubjectHeader), req.Header.Get(MethodHeader), subject, string(body))
+		}))
+	}
+
+	call := func(handler http.Handler, req *http.Request) *httptest.ResponseRecorder {
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+
+		return res
+	}
+
+	t.Run("services without requirements", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/call/test/", nil)
+		req.Header.Set(SubjectHeader, "mallory")
+
+		res := call(engine(nil), req)
+
+		if res.Code != 200 {
+			t.Errorf("expected 200 but got %d", res.Code)
+		}
+
+		if res.Body.String() != "|||" {
+			t.Errorf("expected the spoofed identity to be removed but got %s", res.Body.String())
+		}
+	})
+
+	protected := engine(&api.AuthRequirements{Methods: []string{"apikey", "hmac"}})
+
+	t.Run("without credentials", func(t *testing.T) {
+		res := call(protected, httptest.NewRequest("GET", "/call/test/", nil))
+
+		if res.Code != 401 {
+			t.Errorf("expected 401 but got %d", res.Code)
+		}
+	})
+
+	t.Run("api key", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/call/test/", nil)
+		req.Header.Set(APIKeyHeader, "secret-key")
+
+		res := call(protected, req)
+
+		if res.Body.String() != "alice|apikey|alice|" {
+			t.Errorf("unexpected body %s", res.Body.String())
+		}
+
+		req = httptest.NewRequest("GET", "/call/test/", nil)
+		req.Header.Set(APIKeyHeader, "guess")
+
+		if call(protected, req).Code != 401 {
+			t.Error("expected an unknown key to be rejected")
+		}
+	})
+
+	t.Run("hmac", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/call/test/things?a=b", strings.NewReader("payload"))
+		Sign(req, "bob", "shared")
+
+		res := call(protected, req)
+
+		if res.Body.String() != "bob|hmac|bob|payload" {
+			t.Errorf("unexpected body %s", res.Body.String())
+		}
+
+		tampered := httptest.NewRequest("POST", "/call/test/things?a=b", strings.NewReader("payload"))
+		Sign(tampered, "bob", "shared")
+		tampered.Body = io.NopCloser(bytes.NewReader([]byte("other payload")))
+
+		if call(protected, tampered).Code != 401 {
+			t.Error("expected a tampered body to be rejected")
+		}
+
+		stale := httptest.NewRequest("GET", "/call/test/", nil)
+		Sign(stale, "bob", "shared")
+		stale.Header.Set(DateHeader, time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat))
+
+		if call(protected, stale).Code != 401 {
+			t.Error("expected an old signature to be rejected")
+		}
+
+		wrong := httptest.NewRequest("GET", "/call/test/", nil)
+		Sign(wrong, "bob", "not shared")
+
+		if call(protected, wrong).Code != 401 {
+			t.Error("expected a signature with the wrong secret to be rejected")
+		}
+
+		oversized := httptest.NewRequest("POST", "/call/test/", nil)
+		Sign(oversized, "bob", "shared")
+		oversized.Body = io.NopCloser(bytes.NewReader(make([]byte, MaxSignedBody+1)))
+
+		if call(protected, oversized).Code != 401 {
+			t.Error("expected a body over the limit to be rejected")
+		}
+	})
+
+	t.Run("claims are required", func(t *testing.T) {
+		strict := engine(&api.AuthRequirements{Methods: []string{"apikey"}, Claims: map[string]string{"role": "admin"}})
+
+		req := httptest.NewRequest("GET", "/call/test/", nil)
+		req.Header.Set(APIKeyHeader, "secret-key")
+
+		if call(strict, req).Code != 403 {
+			t.Error("expected a caller without the claim to be forbidden")
+		}
+	})
+
+	t.Run("unknown method", func(t *testing.T) {
+		res := call(engine(&api.AuthRequirements{Methods: []string{"kerberos"}}), httptest.NewRequest("GET", "/call/test/", nil))
+
+		if res.Code != 500 {
+			t.Errorf("expected 500 but got %d", res.Code)
+		}
+	})
+}
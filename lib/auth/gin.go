@@ -0,0 +1,26 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/Meduzz/modulr/api"
+	"github.com/gin-gonic/gin"
+)
+
+// Middleware - the gin twin of Authenticator.Wrap, for gin routes of our own like the endpoints.
+// The rest of the chain runs with the request the authenticator passed on, carrying the identity.
+func Middleware(authenticator api.Authenticator, requirements *api.AuthRequirements) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		passed := false
+
+		authenticator.Wrap(requirements, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			passed = true
+			ctx.Request = req
+			ctx.Next()
+		})).ServeHTTP(ctx.Writer, ctx.Request)
+
+		if !passed {
+			ctx.Abort()
+		}
+	}
+}
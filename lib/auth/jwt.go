@@ -0,0 +1,538 @@
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Meduzz/modulr/api"
+)
+
+type (
+	jwtMethod struct {
+		source      string
+		issuer      string
+		optionalExp bool                        // tokens without exp are accepted
+		keys        map[string]crypto.PublicKey // kid -> key
+		loaded      time.Time                   // when the keys were fetched, or the modification time of the file
+		checked     time.Time                   // when we last looked for new keys
+		lock        *sync.Mutex
+	}
+
+	// JWTOption - configures the jwt method
+	JWTOption func(*jwtMethod)
+
+	jwks struct {
+		Keys []*jwk `json:"keys"`
+	}
+
+	jwk struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		Crv string `json:"crv"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+		X   string `json:"x"`
+		Y   string `json:"y"`
+	}
+
+	jwtHeader struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+)
+
+const (
+	// keys are looked for again after this long, or when a token is signed with an unknown key
+	refreshInterval = 10 * time.Minute
+	// but never more often than this
+	minRefreshInterval = 30 * time.Second
+	// clock skew allowed when checking exp & nbf
+	leeway = time.Minute
+)
+
+// the curve each ecdsa algorithm signs with
+var curves = map[string]string{
+	"ES256": "P-256",
+	"ES384": "P-384",
+	"ES512": "P-521",
+}
+
+// NewJWTMethod - authenticates bearer tokens signed by the keys in a JWKS, read from a file or fetched from a http(s) url.
+// Tokens must be issued by the issuer, unless it is empty, and must expire unless OptionalExpiry is given.
+func NewJWTMethod(source, issuer string, options ...JWTOption) (api.AuthMethod, error) {
+	j := &jwtMethod{
+		source: source,
+		issuer: issuer,
+		keys:   make(map[string]crypto.PublicKey),
+		lock:   &sync.Mutex{},
+	}
+
+	for _, option := range options {
+		option(j)
+	}
+
+	j.checked = time.Now()
+	err := j.refresh(true)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return j, nil
+}
+
+// OptionalExpiry - accept tokens without exp, they're valid for as long as their key is
+func OptionalExpiry() JWTOption {
+	return func(j *jwtMethod) {
+		j.optionalExp = true
+	}
+}
+
+func (j *jwtMethod) Authenticate(req *http.Request) (*api.Identity, error) {
+	header := req.Header.Get("Authorization")
+
+	if !strings.HasPrefix(header, "Bearer ") {
+		return nil, nil
+	}
+
+	parts := strings.Split(strings.TrimPrefix(header, "Bearer "), ".")
+
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed token")
+	}
+
+	head := &jwtHeader{}
+	err := decodeSegment(parts[0], head)
+
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := j.key(head.Kid)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = verify(head.Alg, key, []byte(parts[0]+"."+parts[1]), signature)
+
+	if err != nil {
+		return nil, err
+	}
+
+	claims := make(map[string]interface{})
+	err = decodeSegment(parts[1], &claims)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return j.identity(claims)
+}
+
+// identity - check the registered claims and flatten the rest
+func (j *jwtMethod) identity(claims map[string]interface{}) (*api.Identity, error) {
+	now := time.Now()
+
+	exp, ok, err := numericDate(claims, "exp")
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok && !j.optionalExp {
+		return nil, fmt.Errorf("token does not expire")
+	}
+
+	if ok && now.Add(-leeway).After(exp) {
+		return nil, fmt.Errorf("token has expired")
+	}
+
+	nbf, ok, err := numericDate(claims, "nbf")
+
+	if err != nil {
+		return nil, err
+	}
+
+	if ok && now.Add(leeway).Before(nbf) {
+		return nil, fmt.Errorf("token is not valid yet")
+	}
+
+	if j.issuer != "" && claims["iss"] != j.issuer {
+		return nil, fmt.Errorf("token was issued by %v", claims["iss"])
+	}
+
+	identity := &api.Identity{
+		Audience: make([]string, 0),
+		Claims:   make(map[string]string),
+	}
+
+	switch aud := claims["aud"].(type) {
+	case string:
+		identity.Audience = append(identity.Audience, aud)
+	case []interface{}:
+		for _, it := range aud {
+			if s, ok := it.(string); ok {
+				identity.Audience = append(identity.Audience, s)
+			}
+		}
+	}
+
+	for name, value := range claims {
+		switch name {
+		case "exp", "nbf", "iat", "aud":
+			continue
+		}
+
+		identity.Claims[name] = flatten(value)
+	}
+
+	identity.Subject = identity.Claims["sub"]
+
+	return identity, nil
+}
+
+// numericDate - a claim that's a time in seconds, false when the token doesn't have it. Anything but a number is an error.
+func numericDate(claims map[string]interface{}, name string) (time.Time, bool, error) {
+	value, ok := claims[name]
+
+	if !ok {
+		return time.Time{}, false, nil
+	}
+
+	number, ok := value.(json.Number)
+
+	if !ok {
+		return time.Time{}, false, fmt.Errorf("claim %s is not a number", name)
+	}
+
+	seconds, err := number.Float64()
+
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("claim %s is not a number", name)
+	}
+
+	return time.Unix(int64(seconds), 0), true, nil
+}
+
+// key - find the key by its id, looking for new keys when it's unknown. Tokens without kid work with a single key.
+// Keys are looked for outside the lock, by the first caller that finds it's time to, the others go on with the keys at hand.
+func (j *jwtMethod) key(kid string) (crypto.PublicKey, error) {
+	j.lock.Lock()
+	key, ok := j.find(kid)
+	due := time.Since(j.checked) > refreshInterval || (!ok && time.Since(j.checked) > minRefreshInterval)
+
+	if due {
+		j.checked = time.Now()
+	}
+
+	j.lock.Unlock()
+
+	if due {
+		j.refresh(false)
+
+		j.lock.Lock()
+		key, ok = j.find(kid)
+		j.lock.Unlock()
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("no key with kid %s", kid)
+	}
+
+	return key, nil
+}
+
+func (j *jwtMethod) find(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(j.keys) == 1 {
+		for _, key := range j.keys {
+			return key, true
+		}
+	}
+
+	key, ok := j.keys[kid]
+
+	return key, ok
+}
+
+// refresh - load the keys again, files are only read when they changed. Failures keep the old keys.
+func (j *jwtMethod) refresh(initial bool) error {
+	j.lock.Lock()
+	loaded := j.loaded
+	j.lock.Unlock()
+
+	var bs []byte
+	var err error
+
+	if strings.HasPrefix(j.source, "http://") || strings.HasPrefix(j.source, "https://") {
+		bs, err = fetch(j.source)
+	} else {
+		var info os.FileInfo
+		info, err = os.Stat(j.source)
+
+		if err == nil && !initial && !info.ModTime().After(loaded) {
+			return nil
+		}
+
+		if err == nil {
+			loaded = info.ModTime()
+			bs, err = os.ReadFile(j.source)
+		}
+	}
+
+	if err == nil {
+		var keys map[string]crypto.PublicKey
+		keys, err = parseJWKS(bs)
+
+		if err == nil {
+			j.lock.Lock()
+			j.keys = keys
+			j.loaded = loaded
+			j.lock.Unlock()
+
+			return nil
+		}
+	}
+
+	if !initial {
+		log.Printf("Refreshing keys from %s threw error: %v\n", j.source, err)
+	}
+
+	return err
+}
+
+func fetch(url string) ([]byte, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	res, err := client.Get(url)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s returned %d", url, res.StatusCode)
+	}
+
+	return io.ReadAll(res.Body)
+}
+
+func parseJWKS(bs []byte) (map[string]crypto.PublicKey, error) {
+	set := &jwks{}
+	err := json.Unmarshal(bs, set)
+
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+
+	// keys we can't verify with, like symmetric ones, are skipped
+	for _, it := range set.Keys {
+		key, err := it.publicKey()
+
+		if err == nil {
+			keys[it.Kid] = key
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no usable keys in the JWKS")
+	}
+
+	return keys, nil
+}
+
+func (k *jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+
+		if err != nil {
+			return nil, err
+		}
+
+		// ed25519.Verify panics on keys of any other size
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key")
+		}
+
+		return ed25519.PublicKey(x), nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+}
+
+// verify - the algorithm must fit the key, so that a token can't pick a weaker check
+func verify(alg string, key crypto.PublicKey, signed, signature []byte) error {
+	if len(alg) < 5 {
+		return fmt.Errorf("unsupported algorithm %s", alg)
+	}
+
+	var hash crypto.Hash
+
+	switch alg[len(alg)-3:] {
+	case "256":
+		hash = crypto.SHA256
+	case "384":
+		hash = crypto.SHA384
+	case "512":
+		hash = crypto.SHA512
+	}
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if hash == 0 {
+			break
+		}
+
+		h := hash.New()
+		h.Write(signed)
+
+		switch alg[:2] {
+		case "RS":
+			return rsa.VerifyPKCS1v15(k, hash, h.Sum(nil), signature)
+		case "PS":
+			return rsa.VerifyPSS(k, hash, h.Sum(nil), signature, nil)
+		}
+	case *ecdsa.PublicKey:
+		if curves[alg] != k.Curve.Params().Name {
+			break
+		}
+
+		size := (k.Curve.Params().BitSize + 7) / 8
+
+		if len(signature) != 2*size {
+			return fmt.Errorf("invalid signature")
+		}
+
+		h := hash.New()
+		h.Write(signed)
+
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+
+		if !ecdsa.Verify(k, h.Sum(nil), r, s) {
+			return fmt.Errorf("invalid signature")
+		}
+
+		return nil
+	case ed25519.PublicKey:
+		if alg != "EdDSA" {
+			break
+		}
+
+		if !ed25519.Verify(k, signed, signature) {
+			return fmt.Errorf("invalid signature")
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("algorithm %s does not fit the key", alg)
+}
+
+func decodeSegment(segment string, it interface{}) error {
+	bs, err := base64.RawURLEncoding.DecodeString(segment)
+
+	if err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(bs))
+	decoder.UseNumber()
+
+	return decoder.Decode(it)
+}
+
+// flatten - claims are passed on as strings, lists are comma separated and objects are json
+func flatten(value interface{}) string {
+	switch it := value.(type) {
+	case string:
+		return it
+	case json.Number:
+		return it.String()
+	case bool:
+		return strconv.FormatBool(it)
+	case []interface{}:
+		items := make([]string, 0, len(it))
+
+		for _, item := range it {
+			items = append(items, flatten(item))
+		}
+
+		return strings.Join(items, ",")
+	}
+
+	bs, _ := json.Marshal(value)
+
+	return string(bs)
+}
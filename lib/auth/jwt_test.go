@@ -0,0 +1,366 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Meduzz/modulr/api"
+)
+
+func TestJWT(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	edPublic, edKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	file := filepath.Join(t.TempDir(), "jwks.json")
+	os.WriteFile(file, keySet(map[string]crypto.PublicKey{"rsa": &rsaKey.PublicKey, "ec": &ecKey.PublicKey, "ed": edPublic, "short": edPublic[:16]}), 0600)
+
+	subject, err := NewJWTMethod(file, "https://issuer")
+
+	if err != nil {
+		t.Fatalf("There was an unexpected error: %v", err)
+	}
+
+	claims := func(extra map[string]interface{}) map[string]interface{} {
+		it := map[string]interface{}{
+			"sub":   "carol",
+			"iss":   "https://issuer",
+			"aud":   []string{"orders", "billing"},
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"email": "carol@example.com",
+			"roles": []string{"admin", "user"},
+		}
+
+		for key, value := range extra {
+			it[key] = value
+		}
+
+		return it
+	}
+
+	authenticate := func(token string) (*api.Identity, error) {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		return subject.Authenticate(req)
+	}
+
+	t.Run("valid tokens", func(t *testing.T) {
+		tokens := map[string]string{
+			"RS256": sign(t, "RS256", "rsa", rsaKey, claims(nil)),
+			"PS256": sign(t, "PS256", "rsa", rsaKey, claims(nil)),
+			"ES256": sign(t, "ES256", "ec", ecKey, claims(nil)),
+			"EdDSA": sign(t, "EdDSA", "ed", edKey, claims(nil)),
+		}
+
+		for alg, token := range tokens {
+			identity, err := authenticate(token)
+
+			if err != nil {
+				t.Errorf("There was an unexpected error with %s: %v", alg, err)
+				continue
+			}
+
+			if identity.Subject != "carol" {
+				t.Errorf("expected carol but got %s", identity.Subject)
+			}
+
+			if identity.Claims["email"] != "carol@example.com" || identity.Claims["roles"] != "admin,user" {
+				t.Errorf("unexpected claims %v", identity.Claims)
+			}
+
+			if len(identity.Audience) != 2 || identity.Audience[1] != "billing" {
+				t.Errorf("unexpected audience %v", identity.Audience)
+			}
+		}
+	})
+
+	t.Run("invalid tokens", func(t *testing.T) {
+		other, _ := rsa.GenerateKey(rand.Reader, 2048)
+		forever := claims(nil)
+		delete(forever, "exp")
+
+		tokens := map[string]string{
+			"expired":        sign(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"exp": time.Now().Add(-time.Hour).Unix()})),
+			"not yet valid":  sign(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"nbf": time.Now().Add(time.Hour).Unix()})),
+			"exp as a text":  sign(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"exp": "tomorrow"})),
+			"nbf as a text":  sign(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"nbf": "2000-01-01"})),
+			"other issuer":   sign(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"iss": "https://evil"})),
+			"other key":      sign(t, "RS256", "rsa", other, claims(nil)),
+			"unknown kid":    sign(t, "RS256", "nope", rsaKey, claims(nil)),
+			"alg mismatch":   sign(t, "ES256", "rsa", ecKey, claims(nil)),
+			"curve mismatch": sign(t, "ES384", "ec", ecKey, claims(nil)),
+			"never expiring": sign(t, "RS256", "rsa", rsaKey, forever),
+			"alg none":       unsigned(claims(nil)),
+			"malformed key":  sign(t, "EdDSA", "short", edKey, claims(nil)),
+			"not even a jwt": "hello",
+		}
+
+		for name, token := range tokens {
+			_, err := authenticate(token)
+
+			if err == nil {
+				t.Errorf("expected an error for a token that's %s", name)
+			}
+		}
+	})
+
+	t.Run("expiry can be optional", func(t *testing.T) {
+		lenient, err := NewJWTMethod(file, "https://issuer", OptionalExpiry())
+
+		if err != nil {
+			t.Fatalf("There was an unexpected error: %v", err)
+		}
+
+		forever := claims(nil)
+		delete(forever, "exp")
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Authorization", "Bearer "+sign(t, "RS256", "rsa", rsaKey, forever))
+
+		_, err = lenient.Authenticate(req)
+
+		if err != nil {
+			t.Errorf("There was an unexpected error: %v", err)
+		}
+	})
+
+	t.Run("without a token", func(t *testing.T) {
+		identity, err := subject.Authenticate(httptest.NewRequest("GET", "/", nil))
+
+		if identity != nil || err != nil {
+			t.Error("expected neither an identity nor an error")
+		}
+	})
+
+	t.Run("audience is required", func(t *testing.T) {
+		authenticator := NewAuthenticator()
+		authenticator.RegisterMethod("jwt", subject)
+
+		engine := http.NewServeMux()
+		engine.Handle("/orders", authenticator.Wrap(&api.AuthRequirements{Methods: []string{"jwt"}, Audience: "orders"}, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Write([]byte(req.Header.Get(ClaimHeaderPrefix + "Email")))
+		})))
+		engine.Handle("/shipping", authenticator.Wrap(&api.AuthRequirements{Methods: []string{"jwt"}, Audience: "shipping"}, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(200)
+		})))
+
+		token := sign(t, "RS256", "rsa", rsaKey, claims(nil))
+
+		req := httptest.NewRequest("GET", "/orders", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		res := httptest.NewRecorder()
+		engine.ServeHTTP(res, req)
+
+		if res.Code != 200 || res.Body.String() != "carol@example.com" {
+			t.Errorf("expected the email claim to be forwarded but got %d %s", res.Code, res.Body.String())
+		}
+
+		req = httptest.NewRequest("GET", "/shipping", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		res = httptest.NewRecorder()
+		engine.ServeHTTP(res, req)
+
+		if res.Code != 403 {
+			t.Errorf("expected 403 but got %d", res.Code)
+		}
+
+		res = httptest.NewRecorder()
+		engine.ServeHTTP(res, httptest.NewRequest("GET", "/orders", nil))
+
+		if res.Code != 401 || res.Header().Get("WWW-Authenticate") != "Bearer" {
+			t.Errorf("expected a bearer challenge but got %d", res.Code)
+		}
+	})
+}
+
+func TestJWKSFromURL(t *testing.T) {
+	first, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	second, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	lock := &sync.Mutex{}
+	keys := map[string]crypto.PublicKey{"first": &first.PublicKey}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		w.Write(keySet(keys))
+	}))
+	defer server.Close()
+
+	subject, err := NewJWTMethod(server.URL, "")
+
+	if err != nil {
+		t.Fatalf("There was an unexpected error: %v", err)
+	}
+
+	authenticate := func(token string) error {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		_, err := subject.Authenticate(req)
+
+		return err
+	}
+
+	err = authenticate(sign(t, "ES256", "first", first, map[string]interface{}{"sub": "dave", "exp": time.Now().Add(time.Hour).Unix()}))
+
+	if err != nil {
+		t.Errorf("There was an unexpected error: %v", err)
+	}
+
+	// the keys are rotated, a token with the new kid makes us look again
+	lock.Lock()
+	keys = map[string]crypto.PublicKey{"second": &second.PublicKey}
+	lock.Unlock()
+
+	subject.(*jwtMethod).checked = time.Now().Add(-time.Hour)
+
+	err = authenticate(sign(t, "ES256", "second", second, map[string]interface{}{"sub": "dave", "exp": time.Now().Add(time.Hour).Unix()}))
+
+	if err != nil {
+		t.Errorf("There was an unexpected error: %v", err)
+	}
+}
+
+func TestJWKSFetchDoesNotStall(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	fetching := make(chan struct{})
+	release := make(chan struct{})
+	calls := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		calls++
+
+		// the first fetch is the one at startup, the second one hangs until we're done
+		if calls > 1 {
+			close(fetching)
+			<-release
+		}
+
+		w.Write(keySet(map[string]crypto.PublicKey{"known": &key.PublicKey}))
+	}))
+	defer server.Close()
+	defer close(release)
+
+	subject, err := NewJWTMethod(server.URL, "")
+
+	if err != nil {
+		t.Fatalf("There was an unexpected error: %v", err)
+	}
+
+	authenticate := func(kid string) error {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Authorization", "Bearer "+sign(t, "ES256", kid, key, map[string]interface{}{"sub": "erin", "exp": time.Now().Add(time.Hour).Unix()}))
+		_, err := subject.Authenticate(req)
+
+		return err
+	}
+
+	subject.(*jwtMethod).checked = time.Now().Add(-time.Minute)
+
+	go authenticate("random")
+	<-fetching
+
+	done := make(chan error)
+
+	go func() {
+		done <- authenticate("known")
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("There was an unexpected error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("expected a token with a known kid to be verified while the keys are fetched")
+	}
+}
+
+func sign(t *testing.T, alg, kid string, key crypto.Signer, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	var signature []byte
+	var err error
+
+	hasher := crypto.SHA256
+
+	switch alg[len(alg)-3:] {
+	case "384":
+		hasher = crypto.SHA384
+	case "512":
+		hasher = crypto.SHA512
+	}
+
+	h := hasher.New()
+	h.Write([]byte(signed))
+	hash := h.Sum(nil)
+
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		if alg == "PS256" {
+			signature, err = rsa.SignPSS(rand.Reader, k, hasher, hash, nil)
+		} else {
+			signature, err = rsa.SignPKCS1v15(rand.Reader, k, hasher, hash)
+		}
+	case *ecdsa.PrivateKey:
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, k, hash)
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	case ed25519.PrivateKey:
+		signature = ed25519.Sign(k, []byte(signed))
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func unsigned(claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "none"})
+	payload, _ := json.Marshal(claims)
+
+	return base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload) + "."
+}
+
+func keySet(keys map[string]crypto.PublicKey) []byte {
+	set := &jwks{Keys: make([]*jwk, 0)}
+
+	for kid, key := range keys {
+		switch k := key.(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, &jwk{Kty: "RSA", Kid: kid, N: encode(k.N.Bytes()), E: encode(big.NewInt(int64(k.E)).Bytes())})
+		case *ecdsa.PublicKey:
+			set.Keys = append(set.Keys, &jwk{Kty: "EC", Kid: kid, Crv: "P-256", X: encode(k.X.FillBytes(make([]byte, 32))), Y: encode(k.Y.FillBytes(make([]byte, 32)))})
+		case ed25519.PublicKey:
+			set.Keys = append(set.Keys, &jwk{Kty: "OKP", Kid: kid, Crv: "Ed25519", X: encode(k)})
+		}
+	}
+
+	bs, _ := json.Marshal(set)
+
+	return bs
+}
+
+func encode(bs []byte) string {
+	return base64.RawURLEncoding.EncodeToString(bs)
+}
@@ -0,0 +1,525 @@
+package cache
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Meduzz/modulr/api"
+	"github.com/Meduzz/modulr/lib/auth"
+	"github.com/Meduzz/modulr/lib/router"
+)
+
+type (
+	responseCache struct {
+		settings map[string]*api.CacheSettings // service name -> settings
+		backend  api.CacheBackend
+		lock     *sync.RWMutex
+	}
+)
+
+const (
+	// StatusHeader - tells the caller how the cache answered: HIT, MISS or REVALIDATED
+	StatusHeader = "X-Cache"
+
+	// bodies larger than this are not stored, unless the settings says otherwise
+	defaultMaxEntrySize = 1 << 20
+)
+
+// statuses that may be stored, given that the service says for how long
+var storableStatus = map[int]bool{
+	200: true,
+	203: true,
+	204: true,
+	300: true,
+	301: true,
+	308: true,
+	404: true,
+	410: true,
+}
+
+// headers that only concern one connection and are never stored
+var hopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+	StatusHeader,
+}
+
+// NewResponseCache - creates a new response cache without any services, it needs a backend before it caches anything.
+// What's cached for a service is dropped when all of its instances deregister.
+func NewResponseCache(registry api.ServiceRegistry) api.ResponseCache {
+	c := &responseCache{
+		settings: make(map[string]*api.CacheSettings),
+		lock:     &sync.RWMutex{},
+	}
+
+	registry.Plugin(c)
+
+	return c
+}
+
+// Wrap - backend errors are logged and treated like nothing was cached
+func (c *responseCache) Wrap(name string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		c.lock.RLock()
+		settings, ok := c.settings[name]
+		backend := c.backend
+		c.lock.RUnlock()
+
+		if !ok || backend == nil || !cacheable(req) {
+			handler.ServeHTTP(w, req)
+			return
+		}
+
+		key := keyOf(req, name)
+		entry := lookup(backend, name, key, req)
+		requested := directives(req.Header.Get("Cache-Control"))
+		_, noCache := requested["no-cache"]
+
+		if requested["max-age"] == "0" {
+			noCache = true
+		}
+
+		if entry != nil && !noCache && time.Now().Before(entry.Expires) {
+			serve(w, req, entry, "HIT")
+			return
+		}
+
+		// the entry is checked with the service, unless the caller brought conditions of its own
+		revalidating := entry != nil && validated(entry) && !conditional(req)
+
+		if revalidating {
+			if etag := entry.Header.Get("ETag"); etag != "" {
+				req.Header.Set("If-None-Match", etag)
+			}
+
+			if modified := entry.Header.Get("Last-Modified"); modified != "" {
+				req.Header.Set("If-Modified-Since", modified)
+			}
+		}
+
+		limit := settings.MaxEntrySize
+
+		if limit == 0 {
+			limit = defaultMaxEntrySize
+		}
+
+		before := w.Header().Clone()
+		w.Header().Set(StatusHeader, "MISS")
+
+		rec := &recorder{
+			ResponseWriter: w,
+			revalidating:   revalidating,
+			limit:          limit,
+		}
+
+		handler.ServeHTTP(rec, req)
+
+		if revalidating {
+			req.Header.Del("If-None-Match")
+			req.Header.Del("If-Modified-Since")
+		}
+
+		if rec.notModified {
+			refreshed := refresh(entry, w.Header())
+			reset(w.Header(), before)
+
+			if refreshed != nil {
+				store(backend, name, key, req, refreshed)
+				entry = refreshed
+			}
+
+			serve(w, req, entry, "REVALIDATED")
+			return
+		}
+
+		if req.Method != http.MethodGet || rec.overflow || !storableStatus[rec.status] {
+			return
+		}
+
+		stored := response(w, req, rec)
+
+		if stored != nil {
+			store(backend, name, key, req, stored)
+		}
+	})
+}
+
+func (c *responseCache) Set(settings *api.CacheSettings) error {
+	if settings.Service == "" {
+		return fmt.Errorf("cache settings are missing a service")
+	}
+
+	if settings.MaxEntrySize < 0 {
+		return fmt.Errorf("cache settings for %s has a negative max entry size", settings.Service)
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.settings[settings.Service] = settings
+
+	return nil
+}
+
+func (c *responseCache) Remove(name string) {
+	c.lock.Lock()
+	delete(c.settings, name)
+	c.lock.Unlock()
+
+	c.purge(name)
+}
+
+func (c *responseCache) Settings() []*api.CacheSettings {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	settings := make([]*api.CacheSettings, 0, len(c.settings))
+
+	for _, it := range c.settings {
+		settings = append(settings, it)
+	}
+
+	sort.Slice(settings, func(i, j int) bool {
+		return settings[i].Service < settings[j].Service
+	})
+
+	return settings
+}
+
+func (c *responseCache) SetBackend(backend api.CacheBackend) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.backend = backend
+}
+
+func (c *responseCache) RegisterService(service api.Service) error {
+	return nil
+}
+
+// DeregisterService - nothing is left to answer for the service, so neither should the cache
+func (c *responseCache) DeregisterService(service api.Service) error {
+	c.purge(service.GetName())
+
+	return nil
+}
+
+func (c *responseCache) RegisterInstance(service api.Service) error {
+	return nil
+}
+
+func (c *responseCache) DeregisterInstance(service api.Service) error {
+	return nil
+}
+
+func (c *responseCache) purge(name string) {
+	c.lock.RLock()
+	backend := c.backend
+	c.lock.RUnlock()
+
+	if backend == nil {
+		return
+	}
+
+	err := backend.Purge(name)
+
+	if err != nil {
+		log.Printf("Purging the cache of %s threw error: %v\n", name, err)
+	}
+}
+
+// cacheable - only GET & HEAD, never upgrades and never when the caller says no-store
+func cacheable(req *http.Request) bool {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	}
+
+	if req.Header.Get("Upgrade") != "" {
+		return false
+	}
+
+	_, noStore := directives(req.Header.Get("Cache-Control"))["no-store"]
+
+	return !noStore
+}
+
+func keyOf(req *http.Request, name string) string {
+	return fmt.Sprintf("%s?%s", router.Path(req, name), req.URL.RawQuery)
+}
+
+// variantOf - the key of a response that varies by request headers
+func variantOf(key string, vary []string, req *http.Request) string {
+	values := make([]string, 0, len(vary))
+
+	for _, header := range vary {
+		values = append(values, fmt.Sprintf("%s=%s", header, strings.Join(req.Header.Values(header), ",")))
+	}
+
+	return key + "\n" + strings.Join(values, "\n")
+}
+
+// lookup - responses that vary are found through the entry pointing to the variants
+func lookup(backend api.CacheBackend, name, key string, req *http.Request) *api.CachedResponse {
+	entry, err := backend.Get(name, key)
+
+	if err == nil && entry != nil && entry.Status == 0 {
+		entry, err = backend.Get(name, variantOf(key, entry.Vary, req))
+	}
+
+	if err != nil {
+		log.Printf("Fetching %s from the cache of %s threw error: %v\n", key, name, err)
+		return nil
+	}
+
+	return entry
+}
+
+func store(backend api.CacheBackend, name, key string, req *http.Request, entry *api.CachedResponse) {
+	var err error
+
+	if len(entry.Vary) > 0 {
+		err = backend.Set(name, key, &api.CachedResponse{Vary: entry.Vary, Stored: entry.Stored, Expires: entry.Expires})
+
+		if err == nil {
+			err = backend.Set(name, variantOf(key, entry.Vary, req), entry)
+		}
+	} else {
+		err = backend.Set(name, key, entry)
+	}
+
+	if err != nil {
+		log.Printf("Storing %s in the cache of %s threw error: %v\n", key, name, err)
+	}
+}
+
+// response - turn what the service answered into an entry, nil when it may not be stored
+func response(w http.ResponseWriter, req *http.Request, rec *recorder) *api.CachedResponse {
+	header := w.Header()
+	control := directives(header.Get("Cache-Control"))
+
+	if _, ok := control["no-store"]; ok {
+		return nil
+	}
+
+	if _, ok := control["private"]; ok {
+		return nil
+	}
+
+	if header.Get("Set-Cookie") != "" {
+		return nil
+	}
+
+	// responses to authenticated callers are only shared when the service says so
+	if req.Header.Get("Authorization") != "" || auth.IdentityFrom(req.Context()) != nil {
+		_, public := control["public"]
+		_, shared := control["s-maxage"]
+
+		if !public && !shared {
+			return nil
+		}
+	}
+
+	vary := make([]string, 0)
+
+	for _, value := range header.Values("Vary") {
+		for _, it := range strings.Split(value, ",") {
+			it = http.CanonicalHeaderKey(strings.TrimSpace(it))
+
+			if it == "*" {
+				return nil
+			}
+
+			if it != "" {
+				vary = append(vary, it)
+			}
+		}
+	}
+
+	sort.Strings(vary)
+
+	entry := &api.CachedResponse{
+		Status: rec.status,
+		Header: header.Clone(),
+		Body:   rec.body,
+		Vary:   vary,
+		Stored: time.Now(),
+	}
+
+	for _, it := range hopHeaders {
+		entry.Header.Del(it)
+	}
+
+	lifetime, ok := freshness(header)
+
+	if !ok && !validated(entry) {
+		return nil
+	}
+
+	entry.Expires = entry.Stored.Add(lifetime)
+
+	return entry
+}
+
+// refresh - a 304 from the service updates how long the entry is fresh, nil when it may no longer be stored
+func refresh(entry *api.CachedResponse, header http.Header) *api.CachedResponse {
+	refreshed := &api.CachedResponse{
+		Status: entry.Status,
+		Header: entry.Header.Clone(),
+		Body:   entry.Body,
+		Vary:   entry.Vary,
+		Stored: time.Now(),
+	}
+
+	for _, it := range []string{"Cache-Control", "Expires", "Date", "ETag", "Last-Modified"} {
+		if value := header.Get(it); value != "" {
+			refreshed.Header.Set(it, value)
+		}
+	}
+
+	control := directives(refreshed.Header.Get("Cache-Control"))
+
+	if _, ok := control["no-store"]; ok {
+		return nil
+	}
+
+	lifetime, _ := freshness(refreshed.Header)
+	refreshed.Expires = refreshed.Stored.Add(lifetime)
+
+	return refreshed
+}
+
+// freshness - for how long a response is fresh, and if the service said anything about it at all.
+// no-cache means it has to be revalidated every time.
+func freshness(header http.Header) (time.Duration, bool) {
+	control := directives(header.Get("Cache-Control"))
+
+	if _, ok := control["no-cache"]; ok {
+		return 0, true
+	}
+
+	for _, it := range []string{"s-maxage", "max-age"} {
+		value, ok := control[it]
+
+		if !ok {
+			continue
+		}
+
+		seconds, err := strconv.Atoi(value)
+
+		if err != nil || seconds < 0 {
+			return 0, true
+		}
+
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if value := header.Get("Expires"); value != "" {
+		expires, err := http.ParseTime(value)
+
+		if err != nil {
+			return 0, true
+		}
+
+		date, err := http.ParseTime(header.Get("Date"))
+
+		if err != nil {
+			date = time.Now()
+		}
+
+		if expires.Before(date) {
+			return 0, true
+		}
+
+		return expires.Sub(date), true
+	}
+
+	return 0, false
+}
+
+func validated(entry *api.CachedResponse) bool {
+	return entry.Header.Get("ETag") != "" || entry.Header.Get("Last-Modified") != ""
+}
+
+func conditional(req *http.Request) bool {
+	return req.Header.Get("If-None-Match") != "" || req.Header.Get("If-Modified-Since") != ""
+}
+
+// serve - answer from the cache, with a 304 when the caller already has it
+func serve(w http.ResponseWriter, req *http.Request, entry *api.CachedResponse, status string) {
+	header := w.Header()
+
+	for key, values := range entry.Header {
+		header[key] = append([]string(nil), values...)
+	}
+
+	header.Set(StatusHeader, status)
+	header.Set("Age", strconv.Itoa(int(time.Since(entry.Stored).Seconds())))
+
+	if matches(req.Header.Get("If-None-Match"), entry.Header.Get("ETag")) {
+		header.Del("Content-Length")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	header.Set("Content-Length", strconv.Itoa(len(entry.Body)))
+	w.WriteHeader(entry.Status)
+
+	if req.Method != http.MethodHead {
+		w.Write(entry.Body)
+	}
+}
+
+// matches - weak comparison of If-None-Match against an etag
+func matches(condition, etag string) bool {
+	if condition == "" || etag == "" {
+		return false
+	}
+
+	for _, it := range strings.Split(condition, ",") {
+		it = strings.TrimSpace(it)
+
+		if it == "*" || strings.TrimPrefix(it, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// reset - put the headers back the way they were before the service answered
+func reset(header, before http.Header) {
+	for key := range header {
+		delete(header, key)
+	}
+
+	for key, values := range before {
+		header[key] = values
+	}
+}
+
+// directives - parse Cache-Control, directives without a value map to an empty string
+func directives(header string) map[string]string {
+	parsed := make(map[string]string)
+
+	for _, it := range strings.Split(header, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(it), "=")
+
+		if name != "" {
+			parsed[strings.ToLower(name)] = strings.Trim(value, "\"")
+		}
+	}
+
+	return parsed
+}
@@ -0,0 +1,286 @@
+package cache
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Meduzz/modulr/api"
+)
+
+type (
+	mapBackend struct {
+		entries map[string]*api.CachedResponse
+		lock    *sync.Mutex
+	}
+
+	fakeRegistry struct {
+		api.ServiceRegistry
+		plugins []api.Lifecycle
+	}
+)
+
+func TestResponseCache(t *testing.T) {
+	registry := &fakeRegistry{}
+	backend := &mapBackend{entries: make(map[string]*api.CachedResponse), lock: &sync.Mutex{}}
+	subject := NewResponseCache(registry)
+
+	calls := 0
+	var handler http.HandlerFunc
+
+	engine := subject.Wrap("test", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		calls++
+		handler(w, req)
+	}))
+
+	call := func(method, path string, headers ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+
+		res := httptest.NewRecorder()
+		engine.ServeHTTP(res, req)
+
+		return res
+	}
+
+	answer := func(status int, body string, headers ...string) http.HandlerFunc {
+		return func(w http.ResponseWriter, req *http.Request) {
+			for i := 0; i+1 < len(headers); i += 2 {
+				w.Header().Set(headers[i], headers[i+1])
+			}
+
+			w.WriteHeader(status)
+			w.Write([]byte(body))
+		}
+	}
+
+	t.Run("services without caching", func(t *testing.T) {
+		subject.SetBackend(backend)
+		handler = answer(200, "hello", "Cache-Control", "max-age=60")
+		calls = 0
+
+		call("GET", "/call/test/off")
+		call("GET", "/call/test/off")
+
+		if calls != 2 {
+			t.Errorf("expected 2 calls but got %d", calls)
+		}
+	})
+
+	subject.Set(&api.CacheSettings{Service: "test", MaxEntrySize: 10})
+
+	t.Run("fresh responses", func(t *testing.T) {
+		handler = answer(200, "hello", "Cache-Control", "max-age=60")
+		calls = 0
+
+		first := call("GET", "/call/test/fresh")
+		second := call("GET", "/call/test/fresh")
+		head := call("HEAD", "/call/test/fresh")
+
+		if calls != 1 {
+			t.Errorf("expected 1 call but got %d", calls)
+		}
+
+		if first.Header().Get(StatusHeader) != "MISS" || second.Header().Get(StatusHeader) != "HIT" {
+			t.Errorf("expected a MISS and a HIT but got %s and %s", first.Header().Get(StatusHeader), second.Header().Get(StatusHeader))
+		}
+
+		if second.Body.String() != "hello" || second.Header().Get("Age") == "" {
+			t.Errorf("unexpected cached response %s", second.Body.String())
+		}
+
+		if head.Code != 200 || head.Body.Len() != 0 || head.Header().Get(StatusHeader) != "HIT" {
+			t.Errorf("expected HEAD to be answered from the cache without body")
+		}
+
+		if call("GET", "/call/test/fresh?other=query").Header().Get(StatusHeader) != "MISS" {
+			t.Error("expected another query to miss")
+		}
+	})
+
+	t.Run("responses that are not stored", func(t *testing.T) {
+		cases := map[string]http.HandlerFunc{
+			"no-store":          answer(200, "hello", "Cache-Control", "no-store"),
+			"private":           answer(200, "hello", "Cache-Control", "private, max-age=60"),
+			"cookies":           answer(200, "hello", "Cache-Control", "max-age=60", "Set-Cookie", "a=b"),
+			"vary on anything":  answer(200, "hello", "Cache-Control", "max-age=60", "Vary", "*"),
+			"without freshness": answer(200, "hello"),
+			"errors":            answer(500, "oops", "Cache-Control", "max-age=60"),
+			"too large":         answer(200, "hello there world", "Cache-Control", "max-age=60"),
+		}
+
+		for name, it := range cases {
+			handler = it
+			calls = 0
+			path := "/call/test/" + strings.ReplaceAll(name, " ", "-")
+
+			call("GET", path)
+			res := call("GET", path)
+
+			if calls != 2 {
+				t.Errorf("expected %s to not be cached", name)
+			}
+
+			if res.Body.String() == "" {
+				t.Errorf("expected %s to still reach the caller", name)
+			}
+		}
+	})
+
+	t.Run("revalidation", func(t *testing.T) {
+		handler = func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("ETag", `"v1"`)
+
+			if req.Header.Get("If-None-Match") == `"v1"` {
+				w.WriteHeader(304)
+				return
+			}
+
+			w.Write([]byte("hello"))
+		}
+		calls = 0
+
+		call("GET", "/call/test/etag")
+		res := call("GET", "/call/test/etag")
+
+		if calls != 2 {
+			t.Errorf("expected 2 calls but got %d", calls)
+		}
+
+		if res.Code != 200 || res.Body.String() != "hello" || res.Header().Get(StatusHeader) != "REVALIDATED" {
+			t.Errorf("expected the cached body but got %d %s %s", res.Code, res.Body.String(), res.Header().Get(StatusHeader))
+		}
+
+		res = call("GET", "/call/test/etag", "If-None-Match", `"v1"`)
+
+		if res.Code != 304 {
+			t.Errorf("expected the callers condition to be passed on, but got %d", res.Code)
+		}
+	})
+
+	t.Run("callers conditions on fresh responses", func(t *testing.T) {
+		handler = answer(200, "hello", "Cache-Control", "max-age=60", "ETag", `W/"v2"`)
+		calls = 0
+
+		call("GET", "/call/test/conditional")
+		res := call("GET", "/call/test/conditional", "If-None-Match", `W/"v2"`)
+
+		if calls != 1 || res.Code != 304 {
+			t.Errorf("expected 304 from the cache, but got %d after %d calls", res.Code, calls)
+		}
+	})
+
+	t.Run("callers asking for fresh responses", func(t *testing.T) {
+		handler = answer(200, "hello", "Cache-Control", "max-age=60")
+		calls = 0
+
+		call("GET", "/call/test/nocache")
+		call("GET", "/call/test/nocache", "Cache-Control", "no-cache")
+		call("GET", "/call/test/nocache", "Cache-Control", "no-store")
+
+		if calls != 3 {
+			t.Errorf("expected 3 calls but got %d", calls)
+		}
+	})
+
+	t.Run("vary", func(t *testing.T) {
+		handler = func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Header().Set("Vary", "Accept-Language")
+			w.Write([]byte(req.Header.Get("Accept-Language")))
+		}
+		calls = 0
+
+		call("GET", "/call/test/vary", "Accept-Language", "sv")
+		call("GET", "/call/test/vary", "Accept-Language", "en")
+		sv := call("GET", "/call/test/vary", "Accept-Language", "sv")
+		en := call("GET", "/call/test/vary", "Accept-Language", "en")
+
+		if calls != 2 {
+			t.Errorf("expected 2 calls but got %d", calls)
+		}
+
+		if sv.Body.String() != "sv" || en.Body.String() != "en" {
+			t.Errorf("expected the variants to be kept apart, got %s & %s", sv.Body.String(), en.Body.String())
+		}
+	})
+
+	t.Run("authenticated callers", func(t *testing.T) {
+		handler = answer(200, "secret", "Cache-Control", "max-age=60")
+		calls = 0
+
+		call("GET", "/call/test/auth", "Authorization", "Bearer a")
+		call("GET", "/call/test/auth", "Authorization", "Bearer b")
+
+		if calls != 2 {
+			t.Errorf("expected 2 calls but got %d", calls)
+		}
+
+		handler = answer(200, "public", "Cache-Control", "public, max-age=60")
+		calls = 0
+
+		call("GET", "/call/test/public", "Authorization", "Bearer a")
+		call("GET", "/call/test/public", "Authorization", "Bearer b")
+
+		if calls != 1 {
+			t.Errorf("expected 1 call but got %d", calls)
+		}
+	})
+
+	t.Run("services that deregister", func(t *testing.T) {
+		handler = answer(200, "hello", "Cache-Control", "max-age=60")
+		calls = 0
+
+		call("GET", "/call/test/gone")
+
+		for _, it := range registry.plugins {
+			it.DeregisterService(&api.DefaultService{Name: "test"})
+		}
+
+		call("GET", "/call/test/gone")
+
+		if calls != 2 {
+			t.Errorf("expected 2 calls but got %d", calls)
+		}
+	})
+}
+
+func (m *mapBackend) Get(service, key string) (*api.CachedResponse, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.entries[service+" "+key], nil
+}
+
+func (m *mapBackend) Set(service, key string, entry *api.CachedResponse) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.entries[service+" "+key] = entry
+
+	return nil
+}
+
+func (m *mapBackend) Purge(service string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for key := range m.entries {
+		if strings.HasPrefix(key, fmt.Sprintf("%s ", service)) {
+			delete(m.entries, key)
+		}
+	}
+
+	return nil
+}
+
+func (f *fakeRegistry) Plugin(plugin api.Lifecycle) {
+	f.plugins = append(f.plugins, plugin)
+}
@@ -0,0 +1,79 @@
+package cache
+
+import (
+	"net/http"
+)
+
+type (
+	// recorder - passes the response on to the caller while keeping a copy of it,
+	// except for a 304 to a revalidation we started, that's answered from the cache instead
+	recorder struct {
+		http.ResponseWriter
+		revalidating bool
+		notModified  bool
+		status       int
+		body         []byte
+		limit        int64
+		overflow     bool
+	}
+)
+
+func (r *recorder) WriteHeader(code int) {
+	if r.status != 0 {
+		return
+	}
+
+	r.status = code
+
+	if r.revalidating && code == 304 {
+		r.notModified = true
+		return
+	}
+
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *recorder) Write(bs []byte) (int, error) {
+	if r.status == 0 {
+		r.WriteHeader(200)
+	}
+
+	if r.notModified {
+		return len(bs), nil
+	}
+
+	r.keep(bs)
+
+	return r.ResponseWriter.Write(bs)
+}
+
+func (r *recorder) Flush() {
+	if r.notModified {
+		return
+	}
+
+	flusher, ok := r.ResponseWriter.(http.Flusher)
+
+	if ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap - for http.ResponseController
+func (r *recorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+func (r *recorder) keep(bs []byte) {
+	if r.overflow {
+		return
+	}
+
+	if int64(len(r.body)+len(bs)) > r.limit {
+		r.overflow = true
+		r.body = nil
+		return
+	}
+
+	r.body = append(r.body, bs...)
+}
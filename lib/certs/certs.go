@@ -0,0 +1,167 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+type (
+	// KeyPair - a certificate & key on disk, reloaded when either file changes
+	KeyPair struct {
+		cert     string
+		key      string
+		loaded   *tls.Certificate
+		modified time.Time
+		lock     *sync.Mutex
+	}
+
+	// Pool - a bundle of pem encoded certificates on disk, reloaded when the file changes
+	Pool struct {
+		path     string
+		loaded   *x509.CertPool
+		modified time.Time
+		lock     *sync.Mutex
+	}
+)
+
+// LoadKeyPair - loads a certificate & key, failing if they can't be read
+func LoadKeyPair(cert, key string) (*KeyPair, error) {
+	k := &KeyPair{
+		cert: cert,
+		key:  key,
+		lock: &sync.Mutex{},
+	}
+
+	_, err := k.Certificate()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
+
+// Certificate - the current certificate, if reloading a changed file fails the previous one is kept
+func (k *KeyPair) Certificate() (*tls.Certificate, error) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	modified, err := lastModified(k.cert, k.key)
+
+	if err != nil {
+		if k.loaded != nil {
+			log.Printf("Checking %s for changes threw error: %v\n", k.cert, err)
+			return k.loaded, nil
+		}
+
+		return nil, err
+	}
+
+	if k.loaded != nil && !modified.After(k.modified) {
+		return k.loaded, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(k.cert, k.key)
+
+	if err == nil {
+		// the leaf is used to pick certificates by server name
+		cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	}
+
+	if err != nil {
+		if k.loaded != nil {
+			log.Printf("Reloading %s threw error: %v\n", k.cert, err)
+			return k.loaded, nil
+		}
+
+		return nil, err
+	}
+
+	k.loaded = &cert
+	k.modified = modified
+
+	return k.loaded, nil
+}
+
+// LoadPool - loads a bundle of certificates, failing if it can't be read or is empty
+func LoadPool(path string) (*Pool, error) {
+	p := &Pool{
+		path: path,
+		lock: &sync.Mutex{},
+	}
+
+	_, err := p.Pool()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// Pool - the current pool, if reloading a changed file fails the previous one is kept
+func (p *Pool) Pool() (*x509.CertPool, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	modified, err := lastModified(p.path)
+
+	if err != nil {
+		if p.loaded != nil {
+			log.Printf("Checking %s for changes threw error: %v\n", p.path, err)
+			return p.loaded, nil
+		}
+
+		return nil, err
+	}
+
+	if p.loaded != nil && !modified.After(p.modified) {
+		return p.loaded, nil
+	}
+
+	bs, err := os.ReadFile(p.path)
+
+	if err == nil {
+		pool := x509.NewCertPool()
+
+		if pool.AppendCertsFromPEM(bs) {
+			p.loaded = pool
+			p.modified = modified
+
+			return p.loaded, nil
+		}
+
+		err = fmt.Errorf("no certificates found in %s", p.path)
+	}
+
+	if p.loaded != nil {
+		log.Printf("Reloading %s threw error: %v\n", p.path, err)
+		return p.loaded, nil
+	}
+
+	return nil, err
+}
+
+// lastModified - the latest modification time of the files
+func lastModified(paths ...string) (time.Time, error) {
+	latest := time.Time{}
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+
+		if err != nil {
+			return latest, err
+		}
+
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+
+	return latest, nil
+}
@@ -0,0 +1,153 @@
+package concurrency
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+type (
+	// bulkhead - a limit of calls at once, with a queue of calls waiting for their turn in order
+	bulkhead struct {
+		inFlight int
+		limit    float64
+		max      float64
+		queue    *list.List // of *waiter
+		maxQueue int
+		adaptive bool
+		lowest   time.Duration // lowest latency seen in the current window
+		window   time.Time     // when the current window started
+		lock     *sync.Mutex
+	}
+
+	waiter struct {
+		ready   chan struct{}
+		granted bool
+	}
+)
+
+const (
+	// latencies above this many times the lowest latency counts as overload
+	tolerance = 2.0
+	// on overload the limit is multiplied by this
+	backoff = 0.9
+	// the lowest latency is forgotten this often, so that it follows changes in the service
+	windowLength = time.Minute
+)
+
+func newBulkhead(max, maxQueue int, adaptive bool) *bulkhead {
+	return &bulkhead{
+		limit:    float64(max),
+		max:      float64(max),
+		queue:    list.New(),
+		maxQueue: maxQueue,
+		adaptive: adaptive,
+		window:   time.Now(),
+		lock:     &sync.Mutex{},
+	}
+}
+
+// acquire - take a slot, waiting in the queue for at most timeout. Returns false when full or the wait is over.
+func (b *bulkhead) acquire(ctx context.Context, timeout time.Duration) bool {
+	b.lock.Lock()
+
+	if b.inFlight < b.current() {
+		b.inFlight++
+		b.lock.Unlock()
+
+		return true
+	}
+
+	if b.queue.Len() >= b.maxQueue {
+		b.lock.Unlock()
+		return false
+	}
+
+	w := &waiter{ready: make(chan struct{})}
+	element := b.queue.PushBack(w)
+	b.lock.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-w.ready:
+		return true
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	// the slot might have been handed over while we gave up
+	if w.granted {
+		b.inFlight--
+		b.handOver()
+
+		return false
+	}
+
+	b.queue.Remove(element)
+
+	return false
+}
+
+// release - give back a slot, with how the call went so that adaptive limits can adjust
+func (b *bulkhead) release(latency time.Duration, failed bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.inFlight--
+
+	if b.adaptive {
+		b.adjust(latency, failed)
+	}
+
+	b.handOver()
+}
+
+// handOver - let waiting calls in while there's room
+func (b *bulkhead) handOver() {
+	for b.queue.Len() > 0 && b.inFlight < b.current() {
+		w := b.queue.Remove(b.queue.Front()).(*waiter)
+		w.granted = true
+		b.inFlight++
+		close(w.ready)
+	}
+}
+
+// adjust - AIMD, the limit shrinks on errors & latencies well above the lowest seen, and grows by one per full round otherwise
+func (b *bulkhead) adjust(latency time.Duration, failed bool) {
+	now := time.Now()
+
+	if now.Sub(b.window) > windowLength {
+		b.window = now
+		b.lowest = 0
+	}
+
+	if !failed && (b.lowest == 0 || latency < b.lowest) {
+		b.lowest = latency
+	}
+
+	if failed || float64(latency) > float64(b.lowest)*tolerance {
+		b.limit = b.limit * backoff
+
+		if b.limit < 1 {
+			b.limit = 1
+		}
+
+		return
+	}
+
+	b.limit += 1 / b.limit
+
+	if b.limit > b.max {
+		b.limit = b.max
+	}
+}
+
+func (b *bulkhead) current() int {
+	return int(b.limit)
+}
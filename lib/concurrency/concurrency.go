@@ -0,0 +1,198 @@
+package concurrency
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Meduzz/modulr/api"
+	"github.com/Meduzz/modulr/lib/response"
+)
+
+type (
+	concurrencyLimiter struct {
+		limits map[string]*limited // service name -> limits
+		lock   *sync.RWMutex
+	}
+
+	limited struct {
+		limit     *api.ConcurrencyLimit
+		timeout   time.Duration
+		service   *bulkhead
+		instances map[string]*bulkhead // instance id -> bulkhead
+		lock      *sync.Mutex
+	}
+)
+
+// how long calls wait in the queue, unless the limit says otherwise
+const defaultQueueTimeout = time.Second
+
+// NewConcurrencyLimiter - creates a new concurrency limiter without any limits
+func NewConcurrencyLimiter(registry api.ServiceRegistry) api.ConcurrencyLimiter {
+	c := &concurrencyLimiter{
+		limits: make(map[string]*limited),
+		lock:   &sync.RWMutex{},
+	}
+
+	registry.Plugin(c)
+
+	return c
+}
+
+func (c *concurrencyLimiter) Wrap(name string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		c.lock.RLock()
+		it, ok := c.limits[name]
+		c.lock.RUnlock()
+
+		if !ok || it.service == nil {
+			handler.ServeHTTP(w, req)
+			return
+		}
+
+		guard(w, req, it.service, it.timeout, handler)
+	})
+}
+
+func (c *concurrencyLimiter) WrapInstance(service api.Service, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		c.lock.RLock()
+		it, ok := c.limits[service.GetName()]
+		c.lock.RUnlock()
+
+		if !ok || it.limit.MaxInFlightPerInstance == 0 {
+			handler.ServeHTTP(w, req)
+			return
+		}
+
+		guard(w, req, it.instance(service.GetID()), it.timeout, handler)
+	})
+}
+
+func (c *concurrencyLimiter) Set(limit *api.ConcurrencyLimit) error {
+	if limit.Service == "" {
+		return fmt.Errorf("concurrency limit is missing a service")
+	}
+
+	if limit.MaxInFlight < 0 || limit.MaxInFlightPerInstance < 0 || limit.MaxQueue < 0 {
+		return fmt.Errorf("concurrency limit for %s can't be negative", limit.Service)
+	}
+
+	it := &limited{
+		limit:     limit,
+		timeout:   defaultQueueTimeout,
+		instances: make(map[string]*bulkhead),
+		lock:      &sync.Mutex{},
+	}
+
+	if limit.QueueTimeout != "" {
+		timeout, err := time.ParseDuration(limit.QueueTimeout)
+
+		if err != nil {
+			return fmt.Errorf("concurrency limit for %s has an invalid queue timeout: %w", limit.Service, err)
+		}
+
+		it.timeout = timeout
+	}
+
+	if limit.MaxInFlight > 0 {
+		it.service = newBulkhead(limit.MaxInFlight, limit.MaxQueue, limit.Adaptive)
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.limits[limit.Service] = it
+
+	return nil
+}
+
+func (c *concurrencyLimiter) Remove(name string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	delete(c.limits, name)
+}
+
+func (c *concurrencyLimiter) Limits() []*api.ConcurrencyLimit {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	limits := make([]*api.ConcurrencyLimit, 0, len(c.limits))
+
+	for _, it := range c.limits {
+		limits = append(limits, it.limit)
+	}
+
+	sort.Slice(limits, func(i, j int) bool {
+		return limits[i].Service < limits[j].Service
+	})
+
+	return limits
+}
+
+func (c *concurrencyLimiter) RegisterService(service api.Service) error {
+	return nil
+}
+
+func (c *concurrencyLimiter) DeregisterService(service api.Service) error {
+	return nil
+}
+
+func (c *concurrencyLimiter) RegisterInstance(service api.Service) error {
+	return nil
+}
+
+// DeregisterInstance - forget the bulkhead of the instance, calls in flight release into the forgotten one
+func (c *concurrencyLimiter) DeregisterInstance(service api.Service) error {
+	c.lock.RLock()
+	it, ok := c.limits[service.GetName()]
+	c.lock.RUnlock()
+
+	if !ok {
+		return nil
+	}
+
+	it.lock.Lock()
+	defer it.lock.Unlock()
+
+	delete(it.instances, service.GetID())
+
+	return nil
+}
+
+func (l *limited) instance(id string) *bulkhead {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	it, ok := l.instances[id]
+
+	if !ok {
+		it = newBulkhead(l.limit.MaxInFlightPerInstance, l.limit.MaxQueue, l.limit.Adaptive)
+		l.instances[id] = it
+	}
+
+	return it
+}
+
+// guard - call the handler with a slot of the bulkhead, 5xx answers count as failures
+func guard(w http.ResponseWriter, req *http.Request, b *bulkhead, timeout time.Duration, handler http.Handler) {
+	if !b.acquire(req.Context(), timeout) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	start := time.Now()
+	failed := true
+
+	defer func() {
+		b.release(time.Since(start), failed)
+	}()
+
+	writer := response.NewWriter(w)
+	handler.ServeHTTP(writer, req)
+
+	failed = writer.Status() >= 500
+}
@@ -0,0 +1,206 @@
+package concurrency
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Meduzz/modulr/api"
+)
+
+type (
+	fakeRegistry struct {
+		api.ServiceRegistry
+	}
+)
+
+func TestConcurrencyLimiter(t *testing.T) {
+	subject := NewConcurrencyLimiter(&fakeRegistry{})
+	first := &api.DefaultService{ID: "1", Name: "test"}
+	second := &api.DefaultService{ID: "2", Name: "test"}
+
+	entered := make(chan bool, 10)
+	release := make(chan bool)
+
+	blocking := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		entered <- true
+		<-release
+		w.WriteHeader(200)
+	})
+
+	engine := http.NewServeMux()
+	engine.Handle("/service", subject.Wrap("test", blocking))
+	engine.Handle("/first", subject.WrapInstance(first, blocking))
+	engine.Handle("/second", subject.WrapInstance(second, blocking))
+
+	// call - starts a call and returns where its status ends up
+	call := func(path string) chan int {
+		result := make(chan int, 1)
+
+		go func() {
+			res := httptest.NewRecorder()
+			engine.ServeHTTP(res, httptest.NewRequest("GET", path, nil))
+			result <- res.Code
+		}()
+
+		return result
+	}
+
+	t.Run("without limits", func(t *testing.T) {
+		a := call("/service")
+		b := call("/service")
+		<-entered
+		<-entered
+		release <- true
+		release <- true
+
+		if <-a != 200 || <-b != 200 {
+			t.Error("expected both calls to pass")
+		}
+	})
+
+	t.Run("full without queue", func(t *testing.T) {
+		subject.Set(&api.ConcurrencyLimit{Service: "test", MaxInFlight: 1})
+
+		a := call("/service")
+		<-entered
+
+		if code := <-call("/service"); code != 503 {
+			t.Errorf("expected 503 but got %d", code)
+		}
+
+		release <- true
+
+		if <-a != 200 {
+			t.Error("expected the first call to pass")
+		}
+	})
+
+	t.Run("queued", func(t *testing.T) {
+		subject.Set(&api.ConcurrencyLimit{Service: "test", MaxInFlight: 1, MaxQueue: 1, QueueTimeout: "5s"})
+
+		a := call("/service")
+		<-entered
+		b := call("/service")
+		time.Sleep(50 * time.Millisecond)
+
+		if code := <-call("/service"); code != 503 {
+			t.Errorf("expected 503 when the queue is full but got %d", code)
+		}
+
+		release <- true
+		<-entered
+		release <- true
+
+		if <-a != 200 || <-b != 200 {
+			t.Error("expected the queued call to pass")
+		}
+	})
+
+	t.Run("queue timeout", func(t *testing.T) {
+		subject.Set(&api.ConcurrencyLimit{Service: "test", MaxInFlight: 1, MaxQueue: 1, QueueTimeout: "50ms"})
+
+		a := call("/service")
+		<-entered
+
+		if code := <-call("/service"); code != 503 {
+			t.Errorf("expected 503 after waiting but got %d", code)
+		}
+
+		release <- true
+		<-a
+	})
+
+	t.Run("per instance", func(t *testing.T) {
+		subject.Set(&api.ConcurrencyLimit{Service: "test", MaxInFlightPerInstance: 1})
+
+		a := call("/first")
+		<-entered
+		b := call("/second")
+		<-entered
+
+		if code := <-call("/first"); code != 503 {
+			t.Errorf("expected 503 but got %d", code)
+		}
+
+		release <- true
+		release <- true
+
+		if <-a != 200 || <-b != 200 {
+			t.Error("expected one call per instance to pass")
+		}
+	})
+
+	t.Run("invalid limits", func(t *testing.T) {
+		if subject.Set(&api.ConcurrencyLimit{Service: "test", MaxInFlight: -1}) == nil {
+			t.Error("expected an error")
+		}
+
+		if subject.Set(&api.ConcurrencyLimit{Service: "test", QueueTimeout: "a while"}) == nil {
+			t.Error("expected an error")
+		}
+	})
+}
+
+func TestAdaptive(t *testing.T) {
+	subject := newBulkhead(10, 0, true)
+
+	for i := 0; i < 50; i++ {
+		subject.acquire(context.Background(), time.Second)
+		subject.release(10*time.Millisecond, true)
+	}
+
+	if subject.current() != 1 {
+		t.Errorf("expected failures to shrink the limit to 1, but it was %d", subject.current())
+	}
+
+	for i := 0; i < 200; i++ {
+		subject.acquire(context.Background(), time.Second)
+		subject.release(10*time.Millisecond, false)
+	}
+
+	if subject.current() != 10 {
+		t.Errorf("expected successes to grow the limit back to 10, but it was %d", subject.current())
+	}
+
+	subject.acquire(context.Background(), time.Second)
+	subject.release(time.Second, false)
+
+	if subject.current() != 9 {
+		t.Errorf("expected a slow call to shrink the limit, but it was %d", subject.current())
+	}
+}
+
+func TestHandOver(t *testing.T) {
+	subject := newBulkhead(1, 10, false)
+	subject.acquire(context.Background(), time.Second)
+
+	wg := &sync.WaitGroup{}
+	passed := make(chan bool, 10)
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			if subject.acquire(context.Background(), 5*time.Second) {
+				passed <- true
+				subject.release(time.Millisecond, false)
+			}
+		}()
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	subject.release(time.Millisecond, false)
+	wg.Wait()
+
+	if len(passed) != 10 || subject.inFlight != 0 {
+		t.Errorf("expected all waiting calls to pass one by one, %d did with %d in flight", len(passed), subject.inFlight)
+	}
+}
+
+func (f *fakeRegistry) Plugin(api.Lifecycle) {}
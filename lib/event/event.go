@@ -13,6 +13,8 @@ type (
 		deliveryAdapters map[string]api.EventDeliveryAdapter
 		register         api.ServiceRegistry
 		lb               api.LoadBalancer
+		policies         api.PolicyEngine
+		faults           api.FaultInjector
 	}
 )
 
@@ -73,10 +75,27 @@ func (s *subscriptionRegistry) SetEventAdapter(adapter api.EventAdapter) {
 }
 
 func (s *subscriptionRegistry) Publish(event *api.Event) error {
+	if s.policies != nil {
+		err := s.policies.AuthorizePublish(event.Publisher, event.Topic)
+
+		if err != nil {
+			return err
+		}
+	}
+
 	return s.adapter.Publish(event.Topic, event.Routing, event.Body)
 }
 
+// Request - a request is a publish that waits for a reply, so it's held to the same policy
 func (s *subscriptionRegistry) Request(event *api.Event, maxWait string) ([]byte, error) {
+	if s.policies != nil {
+		err := s.policies.AuthorizePublish(event.Publisher, event.Topic)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return s.adapter.Request(event.Topic, event.Routing, event.Body, maxWait)
 }
 
@@ -84,6 +103,14 @@ func (s *subscriptionRegistry) SetLoadBalancer(lb api.LoadBalancer) {
 	s.lb = lb
 }
 
+func (s *subscriptionRegistry) SetPolicyEngine(policies api.PolicyEngine) {
+	s.policies = policies
+}
+
+func (s *subscriptionRegistry) SetFaultInjector(faults api.FaultInjector) {
+	s.faults = faults
+}
+
 func (s *subscriptionRegistry) eventHandler(name string, sub *api.Subscription) func([]byte) {
 	return func(body []byte) {
 		services, err := s.register.Lookup(name)
@@ -101,7 +128,7 @@ func (s *subscriptionRegistry) eventHandler(name string, sub *api.Subscription)
 			return
 		}
 
-		err = s.deliveryAdapters[service.GetType()].Deliver(service, sub, body)
+		err = s.deliver(name, service, sub, body)
 
 		if err != nil {
 			// TODO do something smarter with errors
@@ -111,3 +138,16 @@ func (s *subscriptionRegistry) eventHandler(name string, sub *api.Subscription)
 		}
 	}
 }
+
+// deliver - injected faults fail the delivery before it's attempted
+func (s *subscriptionRegistry) deliver(name string, service api.Service, sub *api.Subscription, body []byte) error {
+	if s.faults != nil {
+		err := s.faults.Delivery(name)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.deliveryAdapters[service.GetType()].Deliver(service, sub, body)
+}
@@ -1,12 +1,14 @@
 package event
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"testing"
 	"time"
 
 	"github.com/Meduzz/modulr/api"
+	"github.com/Meduzz/modulr/lib/policy"
 	"github.com/Meduzz/modulr/lib/registry"
 )
 
@@ -177,6 +179,48 @@ func TestHappyUnsubscribeHappySubscribe(t *testing.T) {
 	}
 }
 
+func TestPublishDeniedByPolicy(t *testing.T) {
+	policies := policy.NewPolicyEngine()
+	policies.Load(&api.Policy{
+		DefaultDeny: true,
+		Rules:       []*api.PolicyRule{{Name: "orders", Effect: policy.Allow, Subjects: []string{"orders"}, Topics: []string{"orders"}}},
+	})
+
+	eventSupport.SetPolicyEngine(policies)
+	defer eventSupport.SetPolicyEngine(nil)
+
+	err := eventSupport.Publish(&api.Event{Topic: "test", Routing: "test", Body: []byte("{}"), Publisher: &api.Identity{Subject: "orders"}})
+
+	if !errors.Is(err, policy.ErrDenied) {
+		t.Errorf("expected the publish to be denied but got %v", err)
+	}
+
+	if len(logg) > 0 {
+		t.Error("log is not empty")
+	}
+}
+
+func TestRequestDeniedByPolicy(t *testing.T) {
+	policies := policy.NewPolicyEngine()
+	policies.Load(&api.Policy{
+		DefaultDeny: true,
+		Rules:       []*api.PolicyRule{{Name: "orders", Effect: policy.Allow, Subjects: []string{"orders"}, Topics: []string{"orders"}}},
+	})
+
+	eventSupport.SetPolicyEngine(policies)
+	defer eventSupport.SetPolicyEngine(nil)
+
+	_, err := eventSupport.Request(&api.Event{Topic: "test", Routing: "test", Body: []byte("{}"), Publisher: &api.Identity{Subject: "orders"}}, "1s")
+
+	if !errors.Is(err, policy.ErrDenied) {
+		t.Errorf("expected the request to be denied but got %v", err)
+	}
+
+	if len(logg) > 0 {
+		t.Error("log is not empty")
+	}
+}
+
 func (e *ea) Subscribe(topic, routing, group string, handler func([]byte)) error {
 	if !e.AllowSubscribe {
 		return fmt.Errorf("subscribe")
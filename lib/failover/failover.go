@@ -0,0 +1,304 @@
+package failover
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Meduzz/modulr/api"
+	"github.com/Meduzz/modulr/lib/auth"
+	"github.com/Meduzz/modulr/lib/response"
+	"github.com/Meduzz/modulr/lib/router"
+)
+
+type (
+	failover struct {
+		registry api.ServiceRegistry
+		proxy    api.Proxy
+		chains   map[string]*api.FallbackChain // service name -> chain
+		lastGood map[string]*store             // service name -> last good responses
+		lock     *sync.RWMutex
+	}
+
+	// store - the last good responses of a service by url, the oldest is dropped when it's full
+	store struct {
+		responses map[string]*api.CachedResponse
+		order     []string
+		lock      *sync.Mutex
+	}
+
+	// recorder - passes the response on while keeping a copy of the body
+	recorder struct {
+		*response.Writer
+		body     []byte
+		overflow bool
+	}
+)
+
+const (
+	// Header - tells which fallback answered: service:<name>, static or last-good
+	Header = "X-Fallback"
+
+	// last good responses kept per service
+	maxEntries = 1000
+	// bodies larger than this are not kept
+	maxBody = 1024 * 1024
+)
+
+// NewFailover - creates a new failover without any chains, forwarding to fallback services through the proxy
+func NewFailover(registry api.ServiceRegistry, proxy api.Proxy) api.Failover {
+	return &failover{
+		registry: registry,
+		proxy:    proxy,
+		chains:   make(map[string]*api.FallbackChain),
+		lastGood: make(map[string]*store),
+		lock:     &sync.RWMutex{},
+	}
+}
+
+func (f *failover) Wrap(name string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		f.lock.RLock()
+		store, ok := f.lastGood[name]
+		f.lock.RUnlock()
+
+		if !ok || req.Method != http.MethodGet {
+			handler.ServeHTTP(w, req)
+			return
+		}
+
+		rec := &recorder{Writer: response.NewWriter(w)}
+
+		handler.ServeHTTP(rec, req)
+
+		if good(req, rec) {
+			store.put(req.URL.RequestURI(), &api.CachedResponse{
+				Status: rec.Status(),
+				Header: rec.Header().Clone(),
+				Body:   rec.body,
+				Stored: time.Now(),
+			})
+		}
+	})
+}
+
+func (f *failover) Fallback(name string) http.Handler {
+	f.lock.RLock()
+	chain, ok := f.chains[name]
+	store := f.lastGood[name]
+	f.lock.RUnlock()
+
+	if !ok {
+		return nil
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		for _, step := range chain.Steps {
+			if f.answer(w, req, name, step, store) {
+				return
+			}
+		}
+
+		log.Printf("Every fallback of %s failed to answer %s %s\n", name, req.Method, req.URL.Path)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+}
+
+func (f *failover) Set(chain *api.FallbackChain) error {
+	if chain.Service == "" {
+		return fmt.Errorf("fallback chain is missing a service")
+	}
+
+	if len(chain.Steps) == 0 {
+		return fmt.Errorf("fallback chain of %s has no steps", chain.Service)
+	}
+
+	lastGood := false
+
+	for i, step := range chain.Steps {
+		set := 0
+
+		if step.Service != "" {
+			set++
+		}
+
+		if step.Static != nil {
+			set++
+		}
+
+		if step.LastGood {
+			set++
+			lastGood = true
+		}
+
+		if set != 1 {
+			return fmt.Errorf("step %d in the fallback chain of %s must set exactly one fallback", i, chain.Service)
+		}
+
+		if step.Service == chain.Service {
+			return fmt.Errorf("service %s can not fall back to itself", chain.Service)
+		}
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.chains[chain.Service] = chain
+
+	_, ok := f.lastGood[chain.Service]
+
+	if lastGood && !ok {
+		f.lastGood[chain.Service] = &store{
+			responses: make(map[string]*api.CachedResponse),
+			order:     make([]string, 0),
+			lock:      &sync.Mutex{},
+		}
+	} else if !lastGood {
+		delete(f.lastGood, chain.Service)
+	}
+
+	return nil
+}
+
+func (f *failover) Remove(name string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	delete(f.chains, name)
+	delete(f.lastGood, name)
+}
+
+func (f *failover) Chains() []*api.FallbackChain {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	chains := make([]*api.FallbackChain, 0, len(f.chains))
+
+	for _, it := range f.chains {
+		chains = append(chains, it)
+	}
+
+	sort.Slice(chains, func(i, j int) bool {
+		return chains[i].Service < chains[j].Service
+	})
+
+	return chains
+}
+
+// answer - try one step, false when it could not answer
+func (f *failover) answer(w http.ResponseWriter, req *http.Request, name string, step *api.FallbackStep, store *store) bool {
+	switch {
+	case step.Service != "":
+		// only services with instances, so that their own chains are never followed
+		services, err := f.registry.Lookup(step.Service)
+
+		if err != nil || len(services) == 0 {
+			return false
+		}
+
+		req = router.WithMatch(req, &api.Match{
+			Route: &api.Route{Name: "fallback", Service: step.Service},
+			Path:  router.Path(req, name),
+		})
+
+		w.Header().Set(Header, "service:"+step.Service)
+		f.proxy.HandlerFor(step.Service).ServeHTTP(w, req)
+	case step.Static != nil:
+		status := step.Static.Status
+
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		for key, value := range step.Static.Headers {
+			w.Header().Set(key, value)
+		}
+
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		}
+
+		w.Header().Set(Header, "static")
+		w.WriteHeader(status)
+		w.Write([]byte(step.Static.Body))
+	case step.LastGood:
+		if store == nil || req.Method != http.MethodGet {
+			return false
+		}
+
+		res := store.get(req.URL.RequestURI())
+
+		if res == nil {
+			return false
+		}
+
+		for key, values := range res.Header {
+			w.Header()[key] = values
+		}
+
+		w.Header().Set(Header, "last-good")
+		w.Header().Set("Age", fmt.Sprintf("%d", int(time.Since(res.Stored).Seconds())))
+		w.WriteHeader(res.Status)
+		w.Write(res.Body)
+	default:
+		return false
+	}
+
+	return true
+}
+
+// good - only complete 200s that anyone may see are kept
+func good(req *http.Request, rec *recorder) bool {
+	if rec.Status() != http.StatusOK || rec.overflow {
+		return false
+	}
+
+	header := rec.Header()
+	control := strings.ToLower(header.Get("Cache-Control"))
+
+	if strings.Contains(control, "no-store") || strings.Contains(control, "private") || header.Get("Set-Cookie") != "" {
+		return false
+	}
+
+	return req.Header.Get("Authorization") == "" && auth.IdentityFrom(req.Context()) == nil
+}
+
+func (s *store) put(key string, res *api.CachedResponse) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.responses[key]; !ok {
+		s.order = append(s.order, key)
+	}
+
+	s.responses[key] = res
+
+	if len(s.order) > maxEntries {
+		delete(s.responses, s.order[0])
+		s.order = s.order[1:]
+	}
+}
+
+func (s *store) get(key string) *api.CachedResponse {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.responses[key]
+}
+
+func (r *recorder) Write(bs []byte) (int, error) {
+	if !r.overflow {
+		if len(r.body)+len(bs) > maxBody {
+			r.overflow = true
+			r.body = nil
+		} else {
+			r.body = append(r.body, bs...)
+		}
+	}
+
+	return r.Writer.Write(bs)
+}
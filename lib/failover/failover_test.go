@@ -0,0 +1,143 @@
+package failover
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Meduzz/modulr/api"
+	"github.com/Meduzz/modulr/lib/router"
+)
+
+type (
+	fakeRegistry struct {
+		api.ServiceRegistry
+		services map[string][]api.Service
+	}
+
+	fakeProxy struct {
+		api.Proxy
+	}
+)
+
+func TestFailover(t *testing.T) {
+	registry := &fakeRegistry{services: map[string][]api.Service{
+		"backup": {&api.DefaultService{ID: "1", Name: "backup"}},
+	}}
+
+	subject := NewFailover(registry, &fakeProxy{})
+
+	call := func(handler http.Handler, path string, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+
+		for key, value := range header {
+			req.Header.Set(key, value)
+		}
+
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+
+		return res
+	}
+
+	t.Run("without a chain", func(t *testing.T) {
+		if subject.Fallback("test") != nil {
+			t.Error("expected no fallback")
+		}
+	})
+
+	t.Run("another service", func(t *testing.T) {
+		err := subject.Set(&api.FallbackChain{Service: "test", Steps: []*api.FallbackStep{
+			{Service: "empty"},
+			{Service: "backup"},
+		}})
+
+		if err != nil {
+			t.Errorf("There was an unexpected error: %v", err)
+		}
+
+		res := call(subject.Fallback("test"), "/call/test/things", nil)
+
+		if res.Body.String() != "backup /things" || res.Header().Get(Header) != "service:backup" {
+			t.Errorf("expected the backup service to answer but got %s", res.Body.String())
+		}
+	})
+
+	t.Run("static response", func(t *testing.T) {
+		subject.Set(&api.FallbackChain{Service: "test", Steps: []*api.FallbackStep{
+			{Service: "empty"},
+			{Static: &api.StaticResponse{Status: 503, Headers: map[string]string{"Retry-After": "30"}, Body: "down for maintenance"}},
+		}})
+
+		res := call(subject.Fallback("test"), "/call/test/", nil)
+
+		if res.Code != 503 || res.Body.String() != "down for maintenance" || res.Header().Get("Retry-After") != "30" {
+			t.Errorf("expected the static response but got %d %s", res.Code, res.Body.String())
+		}
+	})
+
+	t.Run("last good response", func(t *testing.T) {
+		subject.Set(&api.FallbackChain{Service: "test", Steps: []*api.FallbackStep{{LastGood: true}}})
+
+		served := 0
+		handler := subject.Wrap("test", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			served++
+			w.Header().Set("Content-Type", "text/plain")
+			fmt.Fprintf(w, "good %d", served)
+		}))
+
+		call(handler, "/call/test/things?a=b", nil)
+		call(handler, "/call/test/things?a=b", map[string]string{"Authorization": "Bearer secret"})
+
+		res := call(subject.Fallback("test"), "/call/test/things?a=b", nil)
+
+		if res.Code != 200 || res.Body.String() != "good 1" || res.Header().Get(Header) != "last-good" {
+			t.Errorf("expected the last good response but got %d %s", res.Code, res.Body.String())
+		}
+
+		if res.Header().Get("Content-Type") != "text/plain" {
+			t.Error("expected the headers of the last good response")
+		}
+
+		res = call(subject.Fallback("test"), "/call/test/other", nil)
+
+		if res.Code != 503 {
+			t.Errorf("expected 503 without a last good response but got %d", res.Code)
+		}
+	})
+
+	t.Run("invalid chains", func(t *testing.T) {
+		invalid := []*api.FallbackChain{
+			{Steps: []*api.FallbackStep{{LastGood: true}}},
+			{Service: "test"},
+			{Service: "test", Steps: []*api.FallbackStep{{}}},
+			{Service: "test", Steps: []*api.FallbackStep{{Service: "backup", LastGood: true}}},
+			{Service: "test", Steps: []*api.FallbackStep{{Service: "test"}}},
+		}
+
+		for _, it := range invalid {
+			if subject.Set(it) == nil {
+				t.Errorf("expected an error for %v", it)
+			}
+		}
+	})
+
+	t.Run("removed chains", func(t *testing.T) {
+		subject.Remove("test")
+
+		if subject.Fallback("test") != nil {
+			t.Error("expected the chain to be gone")
+		}
+	})
+}
+
+func (f *fakeRegistry) Lookup(name string) ([]api.Service, error) {
+	return f.services[name], nil
+}
+
+func (f *fakeProxy) HandlerFor(name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprintf(w, "%s %s", name, router.Path(req, name))
+	})
+}
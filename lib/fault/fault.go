@@ -0,0 +1,226 @@
+package fault
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Meduzz/modulr/api"
+)
+
+type (
+	faultInjector struct {
+		faults map[string]*compiled // service name -> faults
+		lock   *sync.RWMutex
+	}
+
+	compiled struct {
+		fault         *api.Fault
+		delay         time.Duration
+		deliveryDelay time.Duration
+	}
+)
+
+// Header - set on calls that had a fault injected, so that they can be told apart from real failures
+const Header = "X-Fault-Injected"
+
+// ErrInjected - returned, wrapped, for deliveries that were failed on purpose
+var ErrInjected = errors.New("injected fault")
+
+// NewFaultInjector - creates a new fault injector without any faults
+func NewFaultInjector() api.FaultInjector {
+	return &faultInjector{
+		faults: make(map[string]*compiled),
+		lock:   &sync.RWMutex{},
+	}
+}
+
+func (f *faultInjector) Wrap(name string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		f.lock.RLock()
+		it, ok := f.faults[name]
+		f.lock.RUnlock()
+
+		if !ok {
+			handler.ServeHTTP(w, req)
+			return
+		}
+
+		if it.fault.Delay != nil && hit(it.fault.Delay.Percent) {
+			w.Header().Set(Header, "delay")
+
+			if !sleep(req.Context().Done(), it.delay) {
+				return
+			}
+		}
+
+		if it.fault.Abort != nil && hit(it.fault.Abort.Percent) {
+			status := it.fault.Abort.Status
+
+			if status == 0 {
+				status = http.StatusServiceUnavailable
+			}
+
+			w.Header().Set(Header, "abort")
+			w.WriteHeader(status)
+			return
+		}
+
+		if it.fault.Reset != nil && hit(it.fault.Reset.Percent) {
+			reset(w)
+			return
+		}
+
+		handler.ServeHTTP(w, req)
+	})
+}
+
+func (f *faultInjector) Delivery(name string) error {
+	f.lock.RLock()
+	it, ok := f.faults[name]
+	f.lock.RUnlock()
+
+	if !ok {
+		return nil
+	}
+
+	if it.fault.DeliveryDelay != nil && hit(it.fault.DeliveryDelay.Percent) {
+		time.Sleep(it.deliveryDelay)
+	}
+
+	if it.fault.DeliveryFailure != nil && hit(it.fault.DeliveryFailure.Percent) {
+		return fmt.Errorf("%w: delivery to %s", ErrInjected, name)
+	}
+
+	return nil
+}
+
+func (f *faultInjector) Set(fault *api.Fault) error {
+	if fault.Service == "" {
+		return fmt.Errorf("fault is missing a service")
+	}
+
+	it := &compiled{fault: fault}
+	percents := make([]float64, 0)
+	var err error
+
+	if fault.Delay != nil {
+		it.delay, err = time.ParseDuration(fault.Delay.Duration)
+
+		if err != nil {
+			return fmt.Errorf("fault for %s has an invalid delay: %w", fault.Service, err)
+		}
+
+		percents = append(percents, fault.Delay.Percent)
+	}
+
+	if fault.DeliveryDelay != nil {
+		it.deliveryDelay, err = time.ParseDuration(fault.DeliveryDelay.Duration)
+
+		if err != nil {
+			return fmt.Errorf("fault for %s has an invalid delivery delay: %w", fault.Service, err)
+		}
+
+		percents = append(percents, fault.DeliveryDelay.Percent)
+	}
+
+	if fault.Abort != nil {
+		if fault.Abort.Status != 0 && (fault.Abort.Status < 100 || fault.Abort.Status > 599) {
+			return fmt.Errorf("fault for %s has an invalid status %d", fault.Service, fault.Abort.Status)
+		}
+
+		percents = append(percents, fault.Abort.Percent)
+	}
+
+	if fault.Reset != nil {
+		percents = append(percents, fault.Reset.Percent)
+	}
+
+	if fault.DeliveryFailure != nil {
+		percents = append(percents, fault.DeliveryFailure.Percent)
+	}
+
+	for _, percent := range percents {
+		if percent < 0 || percent > 100 {
+			return fmt.Errorf("fault percent must be between 0 and 100, was %f", percent)
+		}
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.faults[fault.Service] = it
+
+	log.Printf("Injecting faults into %s\n", fault.Service)
+
+	return nil
+}
+
+func (f *faultInjector) Remove(name string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if _, ok := f.faults[name]; ok {
+		log.Printf("No longer injecting faults into %s\n", name)
+	}
+
+	delete(f.faults, name)
+}
+
+func (f *faultInjector) Faults() []*api.Fault {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	faults := make([]*api.Fault, 0, len(f.faults))
+
+	for _, it := range f.faults {
+		faults = append(faults, it.fault)
+	}
+
+	sort.Slice(faults, func(i, j int) bool {
+		return faults[i].Service < faults[j].Service
+	})
+
+	return faults
+}
+
+func hit(percent float64) bool {
+	return rand.Float64()*100 < percent
+}
+
+// sleep - returns false if the caller gave up while waiting
+func sleep(done <-chan struct{}, delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-done:
+		return false
+	}
+}
+
+// reset - close the connection without answering, with a tcp reset when possible.
+// Connections that can't be taken over, like http/2 streams, are answered with 502 instead.
+func reset(w http.ResponseWriter) {
+	conn, _, err := http.NewResponseController(w).Hijack()
+
+	if err != nil {
+		w.Header().Set(Header, "reset")
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.SetLinger(0)
+	}
+
+	conn.Close()
+}
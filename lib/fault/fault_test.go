@@ -0,0 +1,156 @@
+package fault
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Meduzz/modulr/api"
+)
+
+func TestFaultInjector(t *testing.T) {
+	subject := NewFaultInjector()
+
+	server := httptest.NewServer(subject.Wrap("test", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("hello"))
+	})))
+	defer server.Close()
+
+	t.Run("without faults", func(t *testing.T) {
+		res, err := http.Get(server.URL + "/call/test/")
+
+		if err != nil {
+			t.Fatalf("There was an unexpected error: %v", err)
+		}
+
+		res.Body.Close()
+
+		if res.StatusCode != 200 || res.Header.Get(Header) != "" {
+			t.Errorf("expected 200 without faults but got %d", res.StatusCode)
+		}
+	})
+
+	t.Run("delays", func(t *testing.T) {
+		subject.Set(&api.Fault{Service: "test", Delay: &api.FaultDelay{Percent: 100, Duration: "100ms"}})
+		start := time.Now()
+
+		res, err := http.Get(server.URL + "/call/test/")
+
+		if err != nil {
+			t.Fatalf("There was an unexpected error: %v", err)
+		}
+
+		res.Body.Close()
+
+		if time.Since(start) < 100*time.Millisecond {
+			t.Error("expected the call to be delayed")
+		}
+
+		if res.StatusCode != 200 || res.Header.Get(Header) != "delay" {
+			t.Errorf("expected a delayed 200 but got %d", res.StatusCode)
+		}
+	})
+
+	t.Run("aborts", func(t *testing.T) {
+		subject.Set(&api.Fault{Service: "test", Abort: &api.FaultAbort{Percent: 100, Status: 418}})
+
+		res, err := http.Get(server.URL + "/call/test/")
+
+		if err != nil {
+			t.Fatalf("There was an unexpected error: %v", err)
+		}
+
+		res.Body.Close()
+
+		if res.StatusCode != 418 || res.Header.Get(Header) != "abort" {
+			t.Errorf("expected 418 but got %d", res.StatusCode)
+		}
+	})
+
+	t.Run("resets", func(t *testing.T) {
+		subject.Set(&api.Fault{Service: "test", Reset: &api.FaultPercent{Percent: 100}})
+
+		_, err := http.Get(server.URL + "/call/test/")
+
+		if err == nil {
+			t.Error("expected the connection to be reset")
+		}
+	})
+
+	t.Run("none of the calls", func(t *testing.T) {
+		subject.Set(&api.Fault{Service: "test", Abort: &api.FaultAbort{Percent: 0}})
+
+		res, err := http.Get(server.URL + "/call/test/")
+
+		if err != nil {
+			t.Fatalf("There was an unexpected error: %v", err)
+		}
+
+		res.Body.Close()
+
+		if res.StatusCode != 200 {
+			t.Errorf("expected 200 but got %d", res.StatusCode)
+		}
+	})
+
+	t.Run("removed faults", func(t *testing.T) {
+		subject.Set(&api.Fault{Service: "test", Abort: &api.FaultAbort{Percent: 100}})
+		subject.Remove("test")
+
+		res, err := http.Get(server.URL + "/call/test/")
+
+		if err != nil {
+			t.Fatalf("There was an unexpected error: %v", err)
+		}
+
+		res.Body.Close()
+
+		if res.StatusCode != 200 || len(subject.Faults()) != 0 {
+			t.Errorf("expected 200 but got %d", res.StatusCode)
+		}
+	})
+}
+
+func TestDelivery(t *testing.T) {
+	subject := NewFaultInjector()
+
+	if subject.Delivery("test") != nil {
+		t.Error("expected deliveries without faults to pass")
+	}
+
+	subject.Set(&api.Fault{
+		Service:         "test",
+		DeliveryDelay:   &api.FaultDelay{Percent: 100, Duration: "50ms"},
+		DeliveryFailure: &api.FaultPercent{Percent: 100},
+	})
+
+	start := time.Now()
+	err := subject.Delivery("test")
+
+	if !errors.Is(err, ErrInjected) {
+		t.Errorf("expected an injected failure but got %v", err)
+	}
+
+	if time.Since(start) < 50*time.Millisecond {
+		t.Error("expected the delivery to be delayed")
+	}
+}
+
+func TestInvalidFaults(t *testing.T) {
+	subject := NewFaultInjector()
+
+	faults := map[string]*api.Fault{
+		"without service":  {Abort: &api.FaultAbort{Percent: 10}},
+		"invalid duration": {Service: "test", Delay: &api.FaultDelay{Percent: 10, Duration: "soon"}},
+		"invalid percent":  {Service: "test", Reset: &api.FaultPercent{Percent: 110}},
+		"invalid status":   {Service: "test", Abort: &api.FaultAbort{Percent: 10, Status: 1000}},
+	}
+
+	for name, it := range faults {
+		if subject.Set(it) == nil {
+			t.Errorf("expected an error for a fault %s", name)
+		}
+	}
+}
@@ -0,0 +1,580 @@
+package hedge
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Meduzz/modulr/api"
+	"github.com/Meduzz/modulr/lib/router"
+	"github.com/vulcand/oxy/forward"
+)
+
+type (
+	hedger struct {
+		registry api.ServiceRegistry
+		hedges   map[string]*hedging // service name -> hedging
+		lock     *sync.RWMutex
+	}
+
+	hedging struct {
+		hedge     *api.Hedge
+		methods   map[string]bool
+		delay     time.Duration
+		latencies []time.Duration // the most recent calls, oldest overwritten first
+		next      int
+		lock      *sync.Mutex
+	}
+
+	// attempt - one of the calls of a hedged request, every attempt of a request shares tried
+	attempt struct {
+		handler http.Handler
+		tried   *tried
+	}
+
+	tried struct {
+		instances map[string]bool // instance id -> tried
+		lock      *sync.Mutex
+	}
+
+	// response - response writer that keeps the response of an attempt, until it's too big or flushed.
+	// Then the attempt takes the writer of the request and streams the rest, unless another attempt already has.
+	response struct {
+		header    http.Header
+		status    int
+		body      bytes.Buffer
+		max       int64
+		race      *race
+		streaming bool
+		streamed  time.Time // when the attempt took the writer
+	}
+
+	// race - the attempts of a request racing for its writer
+	race struct {
+		writer  http.ResponseWriter
+		owner   *response      // the attempt that got the writer, nil until one does
+		streams chan *response // the attempt that took the writer while it was still running
+		lock    *sync.Mutex
+	}
+
+	result struct {
+		response *response
+		latency  time.Duration
+		aborted  bool // the attempt panicked, like the reverse proxy does when copying the upstream body fails
+	}
+
+	readCloser struct {
+		io.Reader
+		io.Closer
+	}
+
+	attemptKey struct{}
+)
+
+const (
+	defaultPercentile = 95.0
+	defaultDelay      = 100 * time.Millisecond
+	defaultMaxBody    = int64(1024 * 1024)
+
+	// latencies kept per service
+	samples = 200
+	// latencies needed before the percentile replaces the configured delay
+	minSamples = 20
+)
+
+// errLost - the attempt is still writing, but another attempt got the writer
+var errLost = errors.New("another attempt answered")
+
+var (
+	defaultMethods = []string{http.MethodGet, http.MethodHead}
+	idempotent     = map[string]bool{
+		http.MethodGet:     true,
+		http.MethodHead:    true,
+		http.MethodOptions: true,
+		http.MethodTrace:   true,
+		http.MethodPut:     true,
+		http.MethodDelete:  true,
+	}
+)
+
+// NewHedger - creates a new hedger without any hedges, services with a single instance are never hedged
+func NewHedger(registry api.ServiceRegistry) api.Hedger {
+	return &hedger{
+		registry: registry,
+		hedges:   make(map[string]*hedging),
+		lock:     &sync.RWMutex{},
+	}
+}
+
+// Wrap - hedged calls are buffered, the response of the winner is written once it's complete.
+// Responses that are flushed or outgrow MaxBody are streamed instead, by the first attempt to get there.
+// A failing attempt only wins when there's no other attempt left to wait for.
+func (h *hedger) Wrap(name string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		it, ok := h.hedging(name)
+
+		if !ok || !it.applies(req) || !h.siblings(name) {
+			handler.ServeHTTP(w, req)
+			return
+		}
+
+		body, ok := buffer(req, it.maxBody())
+
+		if !ok {
+			handler.ServeHTTP(w, req)
+			return
+		}
+
+		shared := &tried{
+			instances: make(map[string]bool),
+			lock:      &sync.Mutex{},
+		}
+
+		race := &race{
+			writer:  w,
+			streams: make(chan *response, 1),
+			lock:    &sync.Mutex{},
+		}
+
+		results := make(chan *result, 2)
+		cancels := []context.CancelFunc{h.start(req, body, &attempt{handler, shared}, race, it.maxBody(), results)}
+		pending := 1
+
+		timer := time.NewTimer(it.current())
+		defer timer.Stop()
+
+		// the losers are cancelled, their responses go nowhere
+		defer func() {
+			for _, cancel := range cancels {
+				cancel()
+			}
+		}()
+
+		var streaming *response
+
+		for {
+			select {
+			case <-timer.C:
+				if streaming != nil {
+					continue
+				}
+
+				cancels = append(cancels, h.start(req, body, &attempt{handler, shared}, race, it.maxBody(), results))
+				pending++
+			case res := <-race.streams:
+				// the others can stop, but the writer is in use until the streaming attempt is done
+				streaming = res
+
+				for _, cancel := range cancels {
+					cancel()
+				}
+			case res := <-results:
+				pending--
+
+				if streaming != nil && res.response != streaming {
+					continue
+				}
+
+				if res.response.streaming {
+					it.record(res.latency)
+
+					// part of the response is out already, abort it on the serving goroutine like the attempt would have
+					if res.aborted {
+						panic(http.ErrAbortHandler)
+					}
+
+					return
+				}
+
+				if res.response.status >= http.StatusInternalServerError && pending > 0 {
+					continue
+				}
+
+				if !res.response.claim() {
+					// another attempt took the writer, and will tell us on streams
+					continue
+				}
+
+				it.record(res.latency)
+				res.response.writeTo(w)
+
+				return
+			}
+		}
+	})
+}
+
+func (h *hedger) WrapInstance(service api.Service, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		it, ok := req.Context().Value(attemptKey{}).(*attempt)
+
+		if ok {
+			it.tried.lock.Lock()
+			it.tried.instances[service.GetID()] = true
+			it.tried.lock.Unlock()
+		}
+
+		handler.ServeHTTP(w, req)
+	})
+}
+
+func (h *hedger) Filter(req *http.Request, pool []api.Service) []api.Service {
+	it, ok := req.Context().Value(attemptKey{}).(*attempt)
+
+	if !ok {
+		return pool
+	}
+
+	it.tried.lock.Lock()
+	defer it.tried.lock.Unlock()
+
+	untried := make([]api.Service, 0, len(pool))
+
+	for _, service := range pool {
+		if !it.tried.instances[service.GetID()] {
+			untried = append(untried, service)
+		}
+	}
+
+	if len(untried) == 0 {
+		return pool
+	}
+
+	return untried
+}
+
+func (h *hedger) Set(hedge *api.Hedge) error {
+	if hedge.Service == "" {
+		return fmt.Errorf("hedge is missing a service")
+	}
+
+	if hedge.Percentile < 0 || hedge.Percentile > 100 {
+		return fmt.Errorf("hedge percentile must be between 0 and 100, was %f", hedge.Percentile)
+	}
+
+	it := &hedging{
+		hedge:     hedge,
+		methods:   make(map[string]bool),
+		delay:     defaultDelay,
+		latencies: make([]time.Duration, 0, samples),
+		lock:      &sync.Mutex{},
+	}
+
+	methods := hedge.Methods
+
+	if len(methods) == 0 {
+		methods = defaultMethods
+	}
+
+	for _, method := range methods {
+		method = strings.ToUpper(method)
+
+		if !idempotent[method] {
+			return fmt.Errorf("hedge for %s can't hedge %s, it's not idempotent", hedge.Service, method)
+		}
+
+		it.methods[method] = true
+	}
+
+	if hedge.Delay != "" {
+		delay, err := time.ParseDuration(hedge.Delay)
+
+		if err != nil {
+			return err
+		}
+
+		it.delay = delay
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.hedges[hedge.Service] = it
+
+	return nil
+}
+
+func (h *hedger) Remove(name string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	delete(h.hedges, name)
+}
+
+func (h *hedger) Hedges() []*api.Hedge {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+
+	hedges := make([]*api.Hedge, 0, len(h.hedges))
+
+	for _, it := range h.hedges {
+		hedges = append(hedges, it.hedge)
+	}
+
+	sort.Slice(hedges, func(i, j int) bool {
+		return hedges[i].Service < hedges[j].Service
+	})
+
+	return hedges
+}
+
+func (h *hedger) hedging(name string) (*hedging, bool) {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+
+	it, ok := h.hedges[name]
+
+	return it, ok
+}
+
+// siblings - there must be another instance to hedge to
+func (h *hedger) siblings(name string) bool {
+	services, err := h.registry.Lookup(name)
+
+	return err == nil && len(services) > 1
+}
+
+// start - run an attempt with its own copy of the request and a context of its own to cancel
+func (h *hedger) start(req *http.Request, body []byte, it *attempt, race *race, max int64, results chan *result) context.CancelFunc {
+	ctx, cancel := context.WithCancel(req.Context())
+	clone := req.Clone(context.WithValue(ctx, attemptKey{}, it))
+
+	if body != nil {
+		clone.Body = io.NopCloser(bytes.NewReader(body))
+		clone.ContentLength = int64(len(body))
+	} else {
+		clone.Body = http.NoBody
+	}
+
+	go func() {
+		writer := &response{header: make(http.Header), max: max, race: race}
+		start := time.Now()
+
+		aborted := serve(it.handler, writer, clone)
+
+		// streams are timed to their first byte, so that long downloads don't push the delay up
+		latency := time.Since(start)
+
+		if writer.streaming {
+			latency = writer.streamed.Sub(start)
+		}
+
+		results <- &result{writer, latency, aborted}
+	}()
+
+	return cancel
+}
+
+// serve - attempts run on goroutines of their own, where a panic would take the proxy down. A panicking attempt fails with 502 instead.
+func serve(handler http.Handler, writer *response, req *http.Request) (aborted bool) {
+	defer func() {
+		it := recover()
+
+		if it == nil {
+			return
+		}
+
+		if it != http.ErrAbortHandler {
+			log.Printf("Running a hedged attempt threw error: %v\n", it)
+		}
+
+		aborted = true
+
+		if !writer.streaming {
+			writer.header = make(http.Header)
+			writer.status = http.StatusBadGateway
+			writer.body.Reset()
+		}
+	}()
+
+	handler.ServeHTTP(writer, req)
+
+	return false
+}
+
+// applies - websockets are never hedged
+func (h *hedging) applies(req *http.Request) bool {
+	if !h.methods[req.Method] || forward.IsWebsocketRequest(req) {
+		return false
+	}
+
+	if len(h.hedge.Routes) == 0 {
+		return true
+	}
+
+	match := router.MatchFrom(req.Context())
+
+	if match == nil {
+		return false
+	}
+
+	for _, it := range h.hedge.Routes {
+		if it == match.Route.Name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (h *hedging) maxBody() int64 {
+	if h.hedge.MaxBody > 0 {
+		return h.hedge.MaxBody
+	}
+
+	return defaultMaxBody
+}
+
+// current - the percentile of recent calls, or the configured delay until there are enough of them
+func (h *hedging) current() time.Duration {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if len(h.latencies) < minSamples {
+		return h.delay
+	}
+
+	percentile := h.hedge.Percentile
+
+	if percentile == 0 {
+		percentile = defaultPercentile
+	}
+
+	sorted := make([]time.Duration, len(h.latencies))
+	copy(sorted, h.latencies)
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+
+	index := int(math.Ceil(percentile/100*float64(len(sorted)))) - 1
+
+	if index < 0 {
+		index = 0
+	}
+
+	return sorted[index]
+}
+
+func (h *hedging) record(latency time.Duration) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if len(h.latencies) < samples {
+		h.latencies = append(h.latencies, latency)
+		return
+	}
+
+	h.latencies[h.next] = latency
+	h.next = (h.next + 1) % samples
+}
+
+// buffer - read the body so it can be sent twice, false if the body was too big
+func buffer(req *http.Request, max int64) ([]byte, bool) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, true
+	}
+
+	body, err := io.ReadAll(io.LimitReader(req.Body, max+1))
+
+	if err != nil || int64(len(body)) > max {
+		// hand the handler whatever we read followed by the rest of the body
+		req.Body = readCloser{io.MultiReader(bytes.NewReader(body), req.Body), req.Body}
+		return nil, false
+	}
+
+	req.Body.Close()
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	return body, true
+}
+
+func (r *response) Header() http.Header {
+	return r.header
+}
+
+func (r *response) Write(bs []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+
+	if r.streaming {
+		return r.race.writer.Write(bs)
+	}
+
+	if int64(r.body.Len()+len(bs)) <= r.max {
+		return r.body.Write(bs)
+	}
+
+	if !r.stream() {
+		return 0, errLost
+	}
+
+	return r.race.writer.Write(bs)
+}
+
+func (r *response) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+}
+
+// Flush - whoever flushes wants the response to arrive as it's written, like server sent events
+func (r *response) Flush() {
+	if r.streaming || r.stream() {
+		flusher, ok := r.race.writer.(http.Flusher)
+
+		if ok {
+			flusher.Flush()
+		}
+	}
+}
+
+// claim - take the writer, false when another attempt already has
+func (r *response) claim() bool {
+	r.race.lock.Lock()
+	defer r.race.lock.Unlock()
+
+	if r.race.owner == nil {
+		r.race.owner = r
+	}
+
+	return r.race.owner == r
+}
+
+// stream - take the writer and write what's been kept so far, the rest is written as it comes
+func (r *response) stream() bool {
+	if !r.claim() {
+		return false
+	}
+
+	r.streaming = true
+	r.streamed = time.Now()
+	r.writeTo(r.race.writer)
+	r.body.Reset()
+	r.race.streams <- r
+
+	return true
+}
+
+func (r *response) writeTo(writer http.ResponseWriter) {
+	for key, values := range r.header {
+		writer.Header()[key] = values
+	}
+
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+
+	writer.WriteHeader(r.status)
+	writer.Write(r.body.Bytes())
+}
@@ -0,0 +1,263 @@
+package hedge
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Meduzz/modulr/api"
+)
+
+type (
+	fakeRegistry struct {
+		api.ServiceRegistry
+		services []api.Service
+	}
+)
+
+func TestHedger(t *testing.T) {
+	slow := &api.DefaultService{ID: "slow", Name: "test"}
+	fast := &api.DefaultService{ID: "fast", Name: "test"}
+	pool := []api.Service{slow, fast}
+
+	subject := NewHedger(&fakeRegistry{services: pool})
+	cancelled := int32(0)
+	calls := int32(0)
+
+	// the base handler of the proxy, picking the first instance left in the pool
+	engine := subject.Wrap("test", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		service := subject.Filter(req, pool)[0]
+
+		subject.WrapInstance(service, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			atomic.AddInt32(&calls, 1)
+
+			if service.GetID() == "fast" {
+				w.Write([]byte("fast"))
+				return
+			}
+
+			select {
+			case <-time.After(300 * time.Millisecond):
+				w.Write([]byte("slow"))
+			case <-req.Context().Done():
+				atomic.AddInt32(&cancelled, 1)
+			}
+		})).ServeHTTP(w, req)
+	}))
+
+	call := func(method string) *httptest.ResponseRecorder {
+		res := httptest.NewRecorder()
+		engine.ServeHTTP(res, httptest.NewRequest(method, "/call/test/", strings.NewReader("body")))
+
+		return res
+	}
+
+	t.Run("without a hedge", func(t *testing.T) {
+		start := time.Now()
+		res := call("GET")
+
+		if res.Body.String() != "slow" || time.Since(start) < 300*time.Millisecond {
+			t.Errorf("expected to wait for the slow instance but got %s", res.Body.String())
+		}
+	})
+
+	err := subject.Set(&api.Hedge{Service: "test", Delay: "20ms"})
+
+	if err != nil {
+		t.Errorf("There was an unexpected error: %v", err)
+	}
+
+	t.Run("slow calls are hedged", func(t *testing.T) {
+		atomic.StoreInt32(&calls, 0)
+		start := time.Now()
+		res := call("GET")
+
+		if res.Code != 200 || res.Body.String() != "fast" {
+			t.Errorf("expected the fast instance to answer but got %d %s", res.Code, res.Body.String())
+		}
+
+		if time.Since(start) > 200*time.Millisecond {
+			t.Error("expected the hedge to answer long before the slow instance")
+		}
+
+		if atomic.LoadInt32(&calls) != 2 {
+			t.Errorf("expected 2 calls but got %d", calls)
+		}
+
+		time.Sleep(20 * time.Millisecond)
+
+		if atomic.LoadInt32(&cancelled) != 1 {
+			t.Error("expected the slow call to be cancelled")
+		}
+	})
+
+	t.Run("only idempotent methods", func(t *testing.T) {
+		atomic.StoreInt32(&calls, 0)
+		res := call("POST")
+
+		if res.Body.String() != "slow" || atomic.LoadInt32(&calls) != 1 {
+			t.Errorf("expected POST to not be hedged but got %s", res.Body.String())
+		}
+
+		err := subject.Set(&api.Hedge{Service: "test", Methods: []string{"POST"}})
+
+		if err == nil {
+			t.Error("expected POST to be refused")
+		}
+	})
+
+	t.Run("single instances are not hedged", func(t *testing.T) {
+		single := NewHedger(&fakeRegistry{services: []api.Service{slow}})
+		single.Set(&api.Hedge{Service: "test", Delay: "1ms"})
+
+		runs := 0
+		handler := single.Wrap("test", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			runs++
+			w.WriteHeader(200)
+		}))
+
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/call/test/", nil))
+
+		if runs != 1 {
+			t.Errorf("expected a single run but got %d", runs)
+		}
+	})
+
+	t.Run("delay follows the percentile", func(t *testing.T) {
+		it := &hedging{hedge: &api.Hedge{Percentile: 90}, delay: time.Second, lock: &sync.Mutex{}}
+
+		if it.current() != time.Second {
+			t.Error("expected the configured delay without enough calls")
+		}
+
+		for i := 1; i <= 100; i++ {
+			it.record(time.Duration(i) * time.Millisecond)
+		}
+
+		if it.current() != 90*time.Millisecond {
+			t.Errorf("expected 90ms but got %s", it.current())
+		}
+	})
+}
+
+func (f *fakeRegistry) Lookup(string) ([]api.Service, error) {
+	return f.services, nil
+}
+
+func TestHedgedResponses(t *testing.T) {
+	slow := &api.DefaultService{ID: "slow", Name: "test"}
+	fast := &api.DefaultService{ID: "fast", Name: "test"}
+	pool := []api.Service{slow, fast}
+
+	subject := NewHedger(&fakeRegistry{services: pool})
+	subject.Set(&api.Hedge{Service: "test", Delay: "20ms", MaxBody: 8})
+
+	// how the fast instance answers, the slow one answers slow after 100ms
+	var answer http.HandlerFunc
+
+	engine := subject.Wrap("test", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		service := subject.Filter(req, pool)[0]
+
+		subject.WrapInstance(service, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if service.GetID() == "fast" {
+				answer(w, req)
+				return
+			}
+
+			select {
+			case <-time.After(100 * time.Millisecond):
+				w.Write([]byte("slow"))
+			case <-req.Context().Done():
+			}
+		})).ServeHTTP(w, req)
+	}))
+
+	call := func() *httptest.ResponseRecorder {
+		res := httptest.NewRecorder()
+		engine.ServeHTTP(res, httptest.NewRequest("GET", "/call/test/", nil))
+
+		return res
+	}
+
+	t.Run("failures wait for the other attempt", func(t *testing.T) {
+		answer = func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(503)
+			w.Write([]byte("fast"))
+		}
+
+		res := call()
+
+		if res.Code != 200 || res.Body.String() != "slow" {
+			t.Errorf("expected the slow success to win but got %d %s", res.Code, res.Body.String())
+		}
+	})
+
+	t.Run("panicking attempts fail like any other", func(t *testing.T) {
+		answer = func(w http.ResponseWriter, req *http.Request) {
+			panic(http.ErrAbortHandler)
+		}
+
+		res := call()
+
+		if res.Code != 200 || res.Body.String() != "slow" {
+			t.Errorf("expected the slow success to win but got %d %s", res.Code, res.Body.String())
+		}
+	})
+
+	t.Run("large responses are streamed", func(t *testing.T) {
+		answer = func(w http.ResponseWriter, req *http.Request) {
+			w.Write([]byte("larger than max body"))
+		}
+
+		res := call()
+
+		if res.Code != 200 || res.Body.String() != "larger than max body" {
+			t.Errorf("expected the whole fast response but got %d %s", res.Code, res.Body.String())
+		}
+	})
+
+	t.Run("flushed responses arrive as they're written", func(t *testing.T) {
+		proceed := make(chan struct{})
+
+		answer = func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("data: 1\n\n"))
+			w.(http.Flusher).Flush()
+
+			select {
+			case <-proceed:
+			case <-time.After(time.Second):
+			}
+
+			w.Write([]byte("data: 2\n\n"))
+		}
+
+		server := httptest.NewServer(engine)
+		defer server.Close()
+
+		res, err := http.Get(server.URL + "/call/test/")
+
+		if err != nil {
+			t.Fatalf("There was an unexpected error: %v", err)
+		}
+
+		defer res.Body.Close()
+
+		start := time.Now()
+		line, err := bufio.NewReader(res.Body).ReadString('\n')
+		close(proceed)
+
+		if err != nil || line != "data: 1\n" {
+			t.Errorf("expected the first event but got %s %v", line, err)
+		}
+
+		if time.Since(start) > 500*time.Millisecond {
+			t.Error("expected the first event before the handler was done")
+		}
+	})
+}
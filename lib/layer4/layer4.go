@@ -0,0 +1,359 @@
+package layer4
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Meduzz/modulr/api"
+)
+
+type (
+	layer4 struct {
+		registry  api.ServiceRegistry
+		lb        api.LoadBalancer
+		listeners map[string]*listener      // listener name -> listener
+		reserved  map[string]bool           // names of listeners that are being bound
+		conns     map[string]map[*conn]bool // service name & id -> open connections
+		lock      *sync.Mutex
+	}
+
+	listener struct {
+		config *api.Listener
+		tcp    net.Listener
+		udp    net.PacketConn
+		drain  time.Duration
+		idle   time.Duration
+	}
+
+	// conn - a tcp connection or udp session to an instance
+	conn struct {
+		listener string
+		instance string
+		closer   func()
+	}
+)
+
+const (
+	defaultDrainTimeout = 30 * time.Second
+	defaultIdleTimeout  = time.Minute
+	dialTimeout         = 5 * time.Second
+)
+
+// NewLayer4Proxy - creates a new tcp & udp proxy, that drains connections of deregistered instances
+func NewLayer4Proxy(registry api.ServiceRegistry) api.Layer4Proxy {
+	l := &layer4{
+		registry:  registry,
+		listeners: make(map[string]*listener),
+		reserved:  make(map[string]bool),
+		conns:     make(map[string]map[*conn]bool),
+		lock:      &sync.Mutex{},
+	}
+
+	registry.Plugin(l)
+
+	return l
+}
+
+func (l *layer4) Listen(config *api.Listener) error {
+	if config.Name == "" || config.Service == "" || config.Address == "" {
+		return fmt.Errorf("listener needs a name, a service and an address")
+	}
+
+	it := &listener{
+		config: config,
+		drain:  defaultDrainTimeout,
+		idle:   defaultIdleTimeout,
+	}
+
+	var err error
+
+	if config.DrainTimeout != "" {
+		it.drain, err = time.ParseDuration(config.DrainTimeout)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if config.IdleTimeout != "" {
+		it.idle, err = time.ParseDuration(config.IdleTimeout)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	// the name is taken before binding, so that two listeners with the same name can't both bind
+	l.lock.Lock()
+	_, exists := l.listeners[config.Name]
+
+	if exists || l.reserved[config.Name] {
+		l.lock.Unlock()
+		return fmt.Errorf("there's already a listener named %s", config.Name)
+	}
+
+	l.reserved[config.Name] = true
+	l.lock.Unlock()
+
+	err = it.bind()
+
+	l.lock.Lock()
+	delete(l.reserved, config.Name)
+
+	if err == nil {
+		l.listeners[config.Name] = it
+	}
+
+	l.lock.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	if it.tcp != nil {
+		go l.acceptTcp(it)
+	} else {
+		go l.serveUdp(it)
+	}
+
+	return nil
+}
+
+// bind - start listening on the address of the listener
+func (it *listener) bind() error {
+	var err error
+
+	switch it.config.Protocol {
+	case "tcp", "":
+		it.tcp, err = net.Listen("tcp", it.config.Address)
+	case "udp":
+		it.udp, err = net.ListenPacket("udp", it.config.Address)
+	default:
+		return fmt.Errorf("unknown protocol %s", it.config.Protocol)
+	}
+
+	return err
+}
+
+func (l *layer4) Close(name string) error {
+	l.lock.Lock()
+	it, ok := l.listeners[name]
+	delete(l.listeners, name)
+
+	closers := make([]func(), 0)
+
+	for _, conns := range l.conns {
+		for c := range conns {
+			if c.listener == name {
+				closers = append(closers, c.closer)
+			}
+		}
+	}
+	l.lock.Unlock()
+
+	if !ok {
+		return fmt.Errorf("no listener named %s", name)
+	}
+
+	var err error
+
+	if it.tcp != nil {
+		err = it.tcp.Close()
+	} else {
+		err = it.udp.Close()
+	}
+
+	for _, closer := range closers {
+		closer()
+	}
+
+	return err
+}
+
+func (l *layer4) Listeners() []*api.Listener {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	listeners := make([]*api.Listener, 0, len(l.listeners))
+
+	for _, it := range l.listeners {
+		listeners = append(listeners, it.config)
+	}
+
+	sort.Slice(listeners, func(i, j int) bool {
+		return listeners[i].Name < listeners[j].Name
+	})
+
+	return listeners
+}
+
+func (l *layer4) SetLoadBalancer(lb api.LoadBalancer) {
+	l.lb = lb
+}
+
+func (l *layer4) RegisterService(service api.Service) error {
+	return nil
+}
+
+func (l *layer4) DeregisterService(service api.Service) error {
+	return nil
+}
+
+func (l *layer4) RegisterInstance(service api.Service) error {
+	return nil
+}
+
+// DeregisterInstance - new connections wont go to the instance anymore, existing ones are closed once their drain timeout is up
+func (l *layer4) DeregisterInstance(service api.Service) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	for c := range l.conns[instanceKey(service)] {
+		drain := defaultDrainTimeout
+		it, ok := l.listeners[c.listener]
+
+		if ok {
+			drain = it.drain
+		}
+
+		time.AfterFunc(drain, c.closer)
+	}
+
+	return nil
+}
+
+// pick - find the instance to send a new connection to
+func (l *layer4) pick(name string) (api.Service, error) {
+	services, err := l.registry.Lookup(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	service := l.lb.Next(services)
+
+	if service == nil {
+		return nil, fmt.Errorf("no instances of %s", name)
+	}
+
+	return service, nil
+}
+
+func (l *layer4) track(c *conn) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	conns, ok := l.conns[c.instance]
+
+	if !ok {
+		conns = make(map[*conn]bool)
+		l.conns[c.instance] = conns
+	}
+
+	conns[c] = true
+}
+
+func (l *layer4) untrack(c *conn) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	conns, ok := l.conns[c.instance]
+
+	if !ok {
+		return
+	}
+
+	delete(conns, c)
+
+	if len(conns) == 0 {
+		delete(l.conns, c.instance)
+	}
+}
+
+func (l *layer4) acceptTcp(it *listener) {
+	for {
+		client, err := it.tcp.Accept()
+
+		if err != nil {
+			// the listener was closed
+			return
+		}
+
+		go l.serveTcp(it, client)
+	}
+}
+
+func (l *layer4) serveTcp(it *listener, client net.Conn) {
+	defer client.Close()
+
+	service, err := l.pick(it.config.Service)
+
+	if err != nil {
+		log.Printf("Picking an instance for listener %s threw error: %v\n", it.config.Name, err)
+		return
+	}
+
+	upstream, err := net.DialTimeout("tcp", address(service), dialTimeout)
+
+	if err != nil {
+		log.Printf("Dialing %s for listener %s threw error: %v\n", address(service), it.config.Name, err)
+		return
+	}
+
+	defer upstream.Close()
+
+	c := &conn{
+		listener: it.config.Name,
+		instance: instanceKey(service),
+		closer: func() {
+			client.Close()
+			upstream.Close()
+		},
+	}
+
+	l.track(c)
+	defer l.untrack(c)
+
+	splice(client, upstream)
+}
+
+// splice - copy both ways until both sides are done
+func splice(client, upstream net.Conn) {
+	wg := &sync.WaitGroup{}
+	wg.Add(2)
+
+	pipe := func(dst, src net.Conn) {
+		defer wg.Done()
+
+		io.Copy(dst, src)
+
+		// let the other side know we're done writing, but keep reading
+		if tcp, ok := dst.(*net.TCPConn); ok {
+			tcp.CloseWrite()
+		} else {
+			dst.Close()
+		}
+	}
+
+	go pipe(upstream, client)
+	go pipe(client, upstream)
+
+	wg.Wait()
+}
+
+func address(service api.Service) string {
+	if service.GetPort() != 0 {
+		return fmt.Sprintf("%s:%d", service.GetAddress(), service.GetPort())
+	}
+
+	return service.GetAddress()
+}
+
+func instanceKey(service api.Service) string {
+	return fmt.Sprintf("%s.%s", service.GetName(), service.GetID())
+}
@@ -0,0 +1,357 @@
+package layer4
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Meduzz/modulr/api"
+)
+
+type (
+	fakeRegistry struct {
+		services []api.Service
+		lock     *sync.Mutex
+	}
+
+	firstLoadBalancer struct{}
+)
+
+func TestTcp(t *testing.T) {
+	upstream := echoTcp(t)
+	service := &api.DefaultService{ID: "1", Name: "echo", Address: "127.0.0.1", Port: port(upstream.Addr())}
+	registry := &fakeRegistry{[]api.Service{service}, &sync.Mutex{}}
+
+	subject := NewLayer4Proxy(registry)
+	subject.SetLoadBalancer(&firstLoadBalancer{})
+
+	err := subject.Listen(&api.Listener{Name: "echo", Protocol: "tcp", Address: "127.0.0.1:0", Service: "echo", DrainTimeout: "100ms"})
+
+	if err != nil {
+		t.Fatalf("There was an unexpected error: %v", err)
+	}
+
+	defer subject.Close("echo")
+
+	address := subject.(*layer4).listeners["echo"].tcp.Addr().String()
+
+	t.Run("connections are spliced", func(t *testing.T) {
+		conn, err := net.Dial("tcp", address)
+
+		if err != nil {
+			t.Fatalf("There was an unexpected error: %v", err)
+		}
+
+		defer conn.Close()
+
+		if roundtrip(t, conn, "hello") != "hello" {
+			t.Error("the echo did not match")
+		}
+	})
+
+	t.Run("connections are drained", func(t *testing.T) {
+		conn, err := net.Dial("tcp", address)
+
+		if err != nil {
+			t.Fatalf("There was an unexpected error: %v", err)
+		}
+
+		defer conn.Close()
+
+		// make sure the connection is up before the instance goes away
+		roundtrip(t, conn, "before")
+		subject.DeregisterInstance(service)
+
+		if roundtrip(t, conn, "during") != "during" {
+			t.Error("the connection was not allowed to drain")
+		}
+
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		_, err = conn.Read(make([]byte, 1))
+
+		if err != io.EOF {
+			t.Errorf("expected the connection to be closed, but got %v", err)
+		}
+	})
+
+	t.Run("no instances", func(t *testing.T) {
+		registry.lock.Lock()
+		registry.services = []api.Service{}
+		registry.lock.Unlock()
+
+		conn, err := net.Dial("tcp", address)
+
+		if err != nil {
+			t.Fatalf("There was an unexpected error: %v", err)
+		}
+
+		defer conn.Close()
+
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		_, err = conn.Read(make([]byte, 1))
+
+		if err != io.EOF {
+			t.Errorf("expected the connection to be closed, but got %v", err)
+		}
+	})
+}
+
+func TestUdp(t *testing.T) {
+	upstream := echoUdp(t)
+	service := &api.DefaultService{ID: "1", Name: "echo", Address: "127.0.0.1", Port: port(upstream.LocalAddr())}
+	registry := &fakeRegistry{[]api.Service{service}, &sync.Mutex{}}
+
+	subject := NewLayer4Proxy(registry)
+	subject.SetLoadBalancer(&firstLoadBalancer{})
+
+	err := subject.Listen(&api.Listener{Name: "echo", Protocol: "udp", Address: "127.0.0.1:0", Service: "echo", IdleTimeout: "100ms"})
+
+	if err != nil {
+		t.Fatalf("There was an unexpected error: %v", err)
+	}
+
+	defer subject.Close("echo")
+
+	address := subject.(*layer4).listeners["echo"].udp.LocalAddr().String()
+
+	t.Run("datagrams are relayed", func(t *testing.T) {
+		conn, err := net.Dial("udp", address)
+
+		if err != nil {
+			t.Fatalf("There was an unexpected error: %v", err)
+		}
+
+		defer conn.Close()
+
+		conn.Write([]byte("hello"))
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		buffer := make([]byte, 16)
+		n, err := conn.Read(buffer)
+
+		if err != nil {
+			t.Fatalf("There was an unexpected error: %v", err)
+		}
+
+		if string(buffer[:n]) != "hello" {
+			t.Errorf("expected hello but got %s", string(buffer[:n]))
+		}
+	})
+
+	t.Run("idle sessions are dropped", func(t *testing.T) {
+		time.Sleep(300 * time.Millisecond)
+
+		l := subject.(*layer4)
+		l.lock.Lock()
+		open := len(l.conns)
+		l.lock.Unlock()
+
+		if open != 0 {
+			t.Errorf("expected no open sessions but there were %d", open)
+		}
+	})
+}
+
+func TestListen(t *testing.T) {
+	subject := NewLayer4Proxy(&fakeRegistry{lock: &sync.Mutex{}})
+
+	t.Run("invalid listeners", func(t *testing.T) {
+		err := subject.Listen(&api.Listener{Name: "test", Address: "127.0.0.1:0"})
+
+		if err == nil {
+			t.Error("expected an error")
+		}
+
+		err = subject.Listen(&api.Listener{Name: "test", Protocol: "sctp", Address: "127.0.0.1:0", Service: "test"})
+
+		if err == nil {
+			t.Error("expected an error")
+		}
+	})
+
+	t.Run("a name is only bound once", func(t *testing.T) {
+		errs := make(chan error, 10)
+
+		for i := 0; i < 10; i++ {
+			go func() {
+				errs <- subject.Listen(&api.Listener{Name: "racing", Address: "127.0.0.1:0", Service: "test"})
+			}()
+		}
+
+		bound := 0
+
+		for i := 0; i < 10; i++ {
+			if <-errs == nil {
+				bound++
+			}
+		}
+
+		if bound != 1 {
+			t.Errorf("expected 1 listener to be bound but got %d", bound)
+		}
+
+		subject.Close("racing")
+	})
+
+	t.Run("a failed bind frees the name", func(t *testing.T) {
+		taken, err := net.Listen("tcp", "127.0.0.1:0")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer taken.Close()
+
+		err = subject.Listen(&api.Listener{Name: "retry", Address: taken.Addr().String(), Service: "test"})
+
+		if err == nil {
+			t.Error("expected an error")
+		}
+
+		err = subject.Listen(&api.Listener{Name: "retry", Address: "127.0.0.1:0", Service: "test"})
+
+		if err != nil {
+			t.Errorf("There was an unexpected error: %v", err)
+		}
+
+		subject.Close("retry")
+	})
+
+	t.Run("listeners are listed and closed", func(t *testing.T) {
+		err := subject.Listen(&api.Listener{Name: "test", Address: "127.0.0.1:0", Service: "test"})
+
+		if err != nil {
+			t.Errorf("There was an unexpected error: %v", err)
+		}
+
+		err = subject.Listen(&api.Listener{Name: "test", Address: "127.0.0.1:0", Service: "test"})
+
+		if err == nil {
+			t.Error("expected an error")
+		}
+
+		if len(subject.Listeners()) != 1 {
+			t.Errorf("expected 1 listener but got %d", len(subject.Listeners()))
+		}
+
+		err = subject.Close("test")
+
+		if err != nil {
+			t.Errorf("There was an unexpected error: %v", err)
+		}
+
+		if len(subject.Listeners()) != 0 {
+			t.Error("the listener was not removed")
+		}
+	})
+}
+
+func roundtrip(t *testing.T, conn net.Conn, text string) string {
+	_, err := conn.Write([]byte(text + "\n"))
+
+	if err != nil {
+		t.Fatalf("There was an unexpected error: %v", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+
+	if err != nil {
+		t.Fatalf("There was an unexpected error: %v", err)
+	}
+
+	return line[:len(line)-1]
+}
+
+func echoTcp(t *testing.T) net.Listener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	return listener
+}
+
+func echoUdp(t *testing.T) net.PacketConn {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buffer := make([]byte, 1024)
+
+		for {
+			n, addr, err := conn.ReadFrom(buffer)
+
+			if err != nil {
+				return
+			}
+
+			conn.WriteTo(buffer[:n], addr)
+		}
+	}()
+
+	return conn
+}
+
+func port(addr net.Addr) int {
+	_, p, _ := net.SplitHostPort(addr.String())
+	port, _ := net.LookupPort("tcp", p)
+
+	return port
+}
+
+func (f *fakeRegistry) Register(api.Service) error {
+	return nil
+}
+
+func (f *fakeRegistry) Deregister(string, string) (api.Service, error) {
+	return nil, nil
+}
+
+func (f *fakeRegistry) Lookup(string) ([]api.Service, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return f.services, nil
+}
+
+func (f *fakeRegistry) Plugin(api.Lifecycle) {}
+
+func (f *fakeRegistry) Start() error {
+	return nil
+}
+
+func (f *fakeRegistry) SetStorage(api.RegistryStorage) {}
+
+func (f *firstLoadBalancer) Next(pool []api.Service) api.Service {
+	if len(pool) == 0 {
+		return nil
+	}
+
+	return pool[0]
+}
@@ -0,0 +1,148 @@
+package layer4
+
+import (
+	"errors"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+type (
+	// session - the datagrams of a single client, going to a single instance
+	session struct {
+		upstream net.Conn
+		last     time.Time
+		lock     *sync.Mutex
+	}
+)
+
+const maxDatagram = 64 * 1024
+
+func (l *layer4) serveUdp(it *listener) {
+	sessions := make(map[string]*session)
+	lock := &sync.Mutex{}
+	buffer := make([]byte, maxDatagram)
+
+	for {
+		n, client, err := it.udp.ReadFrom(buffer)
+
+		if err != nil {
+			// the listener was closed
+			return
+		}
+
+		lock.Lock()
+		s, ok := sessions[client.String()]
+
+		if !ok {
+			s, err = l.open(it, client, func() {
+				lock.Lock()
+				delete(sessions, client.String())
+				lock.Unlock()
+			})
+
+			if err != nil {
+				lock.Unlock()
+				log.Printf("Opening a udp session for listener %s threw error: %v\n", it.config.Name, err)
+				continue
+			}
+
+			sessions[client.String()] = s
+		}
+		lock.Unlock()
+
+		s.touch()
+		_, err = s.upstream.Write(buffer[:n])
+
+		if err != nil {
+			log.Printf("Writing to %s for listener %s threw error: %v\n", s.upstream.RemoteAddr(), it.config.Name, err)
+		}
+	}
+}
+
+// open - pick an instance for the client, and start relaying its replies
+func (l *layer4) open(it *listener, client net.Addr, done func()) (*session, error) {
+	service, err := l.pick(it.config.Service)
+
+	if err != nil {
+		return nil, err
+	}
+
+	upstream, err := net.DialTimeout("udp", address(service), dialTimeout)
+
+	if err != nil {
+		return nil, err
+	}
+
+	s := &session{
+		upstream: upstream,
+		last:     time.Now(),
+		lock:     &sync.Mutex{},
+	}
+
+	c := &conn{
+		listener: it.config.Name,
+		instance: instanceKey(service),
+		closer: func() {
+			upstream.Close()
+		},
+	}
+
+	l.track(c)
+
+	go func() {
+		defer done()
+		defer l.untrack(c)
+		defer upstream.Close()
+
+		s.relay(it, client)
+	}()
+
+	return s, nil
+}
+
+// relay - send replies back to the client until the session goes idle or is closed
+func (s *session) relay(it *listener, client net.Addr) {
+	buffer := make([]byte, maxDatagram)
+
+	for {
+		s.upstream.SetReadDeadline(time.Now().Add(it.idle))
+		n, err := s.upstream.Read(buffer)
+
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			if s.idle() < it.idle {
+				// the client has been talking, keep the session around
+				continue
+			}
+
+			return
+		}
+
+		if err != nil {
+			return
+		}
+
+		s.touch()
+		_, err = it.udp.WriteTo(buffer[:n], client)
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (s *session) touch() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.last = time.Now()
+}
+
+func (s *session) idle() time.Duration {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return time.Since(s.last)
+}
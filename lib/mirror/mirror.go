@@ -0,0 +1,288 @@
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Meduzz/modulr/api"
+	"github.com/Meduzz/modulr/lib/response"
+	"github.com/Meduzz/modulr/lib/router"
+	"github.com/vulcand/oxy/forward"
+)
+
+type (
+	requestMirror struct {
+		mirrors  map[string]*api.Mirror // service name -> mirror
+		lock     *sync.RWMutex
+		proxy    api.Proxy
+		recorder api.MirrorRecorder
+	}
+
+	// discarder - response writer that only keeps the status of the shadow response
+	discarder struct {
+		header http.Header
+		status int
+	}
+
+	// readCloser - reads from one place and closes another
+	readCloser struct {
+		io.Reader
+		io.Closer
+	}
+
+	shadowKey struct{}
+)
+
+const (
+	defaultMaxBody = int64(1024 * 1024)
+	defaultTimeout = 30 * time.Second
+)
+
+// NewRequestMirror - creates a new request mirror that sends shadow requests through the proxy and results to the recorder
+func NewRequestMirror(proxy api.Proxy, recorder api.MirrorRecorder) api.RequestMirror {
+	return &requestMirror{
+		mirrors:  make(map[string]*api.Mirror),
+		lock:     &sync.RWMutex{},
+		proxy:    proxy,
+		recorder: recorder,
+	}
+}
+
+func (m *requestMirror) Wrap(name string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		m.lock.RLock()
+		mirror, ok := m.mirrors[name]
+		m.lock.RUnlock()
+
+		if !ok || !m.sampled(req, mirror) {
+			handler.ServeHTTP(w, req)
+			return
+		}
+
+		body, ok := buffer(req, mirror.MaxBody)
+
+		if !ok {
+			handler.ServeHTTP(w, req)
+			return
+		}
+
+		shadow := m.shadowRequest(req, mirror, body)
+		primary := make(chan *api.MirrorResult, 1)
+
+		go m.mirror(shadow, mirror, primary)
+
+		writer := response.NewWriter(w)
+		start := time.Now()
+
+		// the shadow waits for the primary result, it's handed over even when the primary panics
+		defer func() {
+			it := recover()
+			result := &api.MirrorResult{
+				Service: mirror.Service,
+				Shadow:  mirror.Shadow,
+				Method:  req.Method,
+				Path:    req.URL.Path,
+				Status:  writer.Status(),
+				Latency: time.Since(start),
+			}
+
+			if it != nil {
+				result.Status = http.StatusInternalServerError
+			}
+
+			primary <- result
+
+			if it != nil {
+				panic(it)
+			}
+		}()
+
+		handler.ServeHTTP(writer, req)
+	})
+}
+
+func (m *requestMirror) Set(mirror *api.Mirror) error {
+	if mirror.Service == "" || mirror.Shadow == "" {
+		return fmt.Errorf("mirror needs both a service and a shadow")
+	}
+
+	if mirror.Service == mirror.Shadow {
+		return fmt.Errorf("service %s can not mirror itself", mirror.Service)
+	}
+
+	if mirror.Percent < 0 || mirror.Percent > 100 {
+		return fmt.Errorf("mirror percent must be between 0 and 100, was %f", mirror.Percent)
+	}
+
+	if mirror.Timeout != "" {
+		timeout, err := time.ParseDuration(mirror.Timeout)
+
+		if err != nil {
+			return err
+		}
+
+		if timeout <= 0 {
+			return fmt.Errorf("mirror timeout must be positive, was %s", mirror.Timeout)
+		}
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.mirrors[mirror.Service] = mirror
+
+	return nil
+}
+
+func (m *requestMirror) Remove(name string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	delete(m.mirrors, name)
+}
+
+func (m *requestMirror) Mirrors() []*api.Mirror {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	mirrors := make([]*api.Mirror, 0, len(m.mirrors))
+
+	for _, it := range m.mirrors {
+		mirrors = append(mirrors, it)
+	}
+
+	sort.Slice(mirrors, func(i, j int) bool {
+		return mirrors[i].Service < mirrors[j].Service
+	})
+
+	return mirrors
+}
+
+// sampled - shadow requests and websockets are never mirrored
+func (m *requestMirror) sampled(req *http.Request, mirror *api.Mirror) bool {
+	if req.Context().Value(shadowKey{}) != nil || forward.IsWebsocketRequest(req) {
+		return false
+	}
+
+	return rand.Float64()*100 < mirror.Percent
+}
+
+// shadowRequest - copy the request with its own body and a context that outlives the primary request
+func (m *requestMirror) shadowRequest(req *http.Request, mirror *api.Mirror, body []byte) *http.Request {
+	ctx := context.WithValue(context.Background(), shadowKey{}, mirror)
+	shadow := req.Clone(ctx)
+
+	if body != nil {
+		shadow.Body = io.NopCloser(bytes.NewReader(body))
+		shadow.ContentLength = int64(len(body))
+	} else {
+		shadow.Body = http.NoBody
+	}
+
+	return router.WithMatch(shadow, &api.Match{
+		Route: &api.Route{Name: "mirror", Service: mirror.Shadow},
+		Path:  router.Path(req, mirror.Service),
+	})
+}
+
+// mirror - run the shadow request and record it next to the primary result once both are done
+func (m *requestMirror) mirror(req *http.Request, mirror *api.Mirror, primary chan *api.MirrorResult) {
+	timeout := defaultTimeout
+
+	if mirror.Timeout != "" {
+		it, err := time.ParseDuration(mirror.Timeout)
+
+		if err == nil && it > 0 {
+			timeout = it
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), timeout)
+	defer cancel()
+
+	writer := &discarder{header: make(http.Header)}
+	start := time.Now()
+
+	m.serve(mirror, writer, req.WithContext(ctx))
+
+	latency := time.Since(start)
+	result := <-primary
+	result.ShadowStatus = writer.status
+	result.ShadowLatency = latency
+	result.ShadowError = ctx.Err()
+
+	if m.recorder != nil {
+		m.recorder.Record(result)
+	}
+}
+
+// serve - the shadow runs on a goroutine of its own, where a panic would take the proxy down. A panicking shadow answers 502 instead.
+func (m *requestMirror) serve(mirror *api.Mirror, writer *discarder, req *http.Request) {
+	defer func() {
+		it := recover()
+
+		if it == nil {
+			return
+		}
+
+		if it != http.ErrAbortHandler {
+			log.Printf("Mirroring %s to %s threw error: %v\n", req.URL.Path, mirror.Shadow, it)
+		}
+
+		writer.status = http.StatusBadGateway
+	}()
+
+	m.proxy.HandlerFor(mirror.Shadow).ServeHTTP(writer, req)
+}
+
+// buffer - read the body so it can be sent twice, false if the body was too big
+func buffer(req *http.Request, max int64) ([]byte, bool) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, true
+	}
+
+	if max <= 0 {
+		max = defaultMaxBody
+	}
+
+	body, err := io.ReadAll(io.LimitReader(req.Body, max+1))
+
+	if err != nil || int64(len(body)) > max {
+		// hand the primary whatever we read followed by the rest of the body
+		req.Body = readCloser{io.MultiReader(bytes.NewReader(body), req.Body), req.Body}
+		return nil, false
+	}
+
+	req.Body.Close()
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	return body, true
+}
+
+func (d *discarder) Header() http.Header {
+	return d.header
+}
+
+func (d *discarder) Write(bs []byte) (int, error) {
+	if d.status == 0 {
+		d.status = http.StatusOK
+	}
+
+	return len(bs), nil
+}
+
+func (d *discarder) WriteHeader(status int) {
+	if d.status == 0 {
+		d.status = status
+	}
+}
+
+func (d *discarder) Flush() {}
@@ -0,0 +1,188 @@
+package mirror
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Meduzz/modulr/api"
+)
+
+type (
+	fakeProxy struct {
+		api.Proxy
+		bodies chan string
+	}
+
+	recorder struct {
+		results chan *api.MirrorResult
+	}
+)
+
+func TestMirror(t *testing.T) {
+	proxy := &fakeProxy{bodies: make(chan string, 10)}
+	results := &recorder{make(chan *api.MirrorResult, 10)}
+	subject := NewRequestMirror(proxy, results)
+
+	primary := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		bs, _ := io.ReadAll(req.Body)
+		proxy.bodies <- "primary " + string(bs)
+		w.WriteHeader(200)
+	})
+
+	handler := subject.Wrap("test", primary)
+
+	t.Run("without mirror", func(t *testing.T) {
+		serve(handler, "hello")
+
+		if <-proxy.bodies != "primary hello" {
+			t.Error("primary did not get the body")
+		}
+
+		if len(results.results) > 0 {
+			t.Error("request was mirrored")
+		}
+	})
+
+	t.Run("invalid mirror", func(t *testing.T) {
+		err := subject.Set(&api.Mirror{Service: "test", Shadow: "test", Percent: 100})
+
+		if err == nil {
+			t.Error("expected an error")
+		}
+
+		err = subject.Set(&api.Mirror{Service: "test", Shadow: "shadow", Percent: 101})
+
+		if err == nil {
+			t.Error("expected an error")
+		}
+
+		err = subject.Set(&api.Mirror{Service: "test", Shadow: "shadow", Percent: 100, Timeout: "0s"})
+
+		if err == nil {
+			t.Error("expected an error")
+		}
+	})
+
+	err := subject.Set(&api.Mirror{Service: "test", Shadow: "shadow", Percent: 100})
+
+	if err != nil {
+		t.Errorf("There was an unexpected error: %v", err)
+	}
+
+	t.Run("with mirror", func(t *testing.T) {
+		start := time.Now()
+		serve(handler, "hello")
+
+		if time.Since(start) > 100*time.Millisecond {
+			t.Error("the primary was slowed down by the shadow")
+		}
+
+		bodies := []string{<-proxy.bodies, <-proxy.bodies}
+
+		if !contains(bodies, "primary hello") || !contains(bodies, "shadow hello") {
+			t.Errorf("both did not get the body, got: %v", bodies)
+		}
+
+		result := <-results.results
+
+		if result.Status != 200 || result.ShadowStatus != 500 {
+			t.Errorf("expected 200 & 500 but got %d & %d", result.Status, result.ShadowStatus)
+		}
+
+		if result.ShadowLatency < 200*time.Millisecond {
+			t.Errorf("expected shadow latency to be recorded but was %s", result.ShadowLatency)
+		}
+	})
+
+	t.Run("too big body", func(t *testing.T) {
+		subject.Set(&api.Mirror{Service: "test", Shadow: "shadow", Percent: 100, MaxBody: 2})
+		serve(handler, "hello")
+
+		if <-proxy.bodies != "primary hello" {
+			t.Error("primary did not get the whole body")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+
+		if len(results.results) > 0 {
+			t.Error("request was mirrored")
+		}
+	})
+
+	t.Run("panicking shadows", func(t *testing.T) {
+		subject.Set(&api.Mirror{Service: "test", Shadow: "broken", Percent: 100})
+		serve(handler, "hello")
+		<-proxy.bodies
+
+		result := <-results.results
+
+		if result.Status != 200 || result.ShadowStatus != 502 {
+			t.Errorf("expected 200 & 502 but got %d & %d", result.Status, result.ShadowStatus)
+		}
+	})
+
+	t.Run("panicking primaries", func(t *testing.T) {
+		subject.Set(&api.Mirror{Service: "test", Shadow: "shadow", Percent: 100})
+
+		func() {
+			defer func() { recover() }()
+			serve(subject.Wrap("test", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) { panic("boom") })), "hello")
+		}()
+
+		<-proxy.bodies
+
+		select {
+		case result := <-results.results:
+			if result.Status != 500 || result.ShadowStatus != 500 {
+				t.Errorf("expected 500 & 500 but got %d & %d", result.Status, result.ShadowStatus)
+			}
+		case <-time.After(time.Second):
+			t.Error("the shadow never got the primary result")
+		}
+	})
+
+	t.Run("stats", func(t *testing.T) {
+		stats := NewStatsRecorder()
+		stats.Record(&api.MirrorResult{Service: "test", Status: 200, ShadowStatus: 500})
+		stats.Record(&api.MirrorResult{Service: "test", Status: 200, ShadowStatus: 200})
+
+		it := stats.Stats("test")
+
+		if it.Requests != 2 || it.StatusMismatches != 1 {
+			t.Errorf("expected 2 requests & 1 mismatch but got %d & %d", it.Requests, it.StatusMismatches)
+		}
+	})
+}
+
+func serve(handler http.Handler, body string) {
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/call/test/echo", strings.NewReader(body)))
+}
+
+func contains(list []string, it string) bool {
+	for _, item := range list {
+		if item == it {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (f *fakeProxy) HandlerFor(name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if name == "broken" {
+			panic(http.ErrAbortHandler)
+		}
+
+		time.Sleep(200 * time.Millisecond)
+		bs, _ := io.ReadAll(req.Body)
+		f.bodies <- name + " " + string(bs)
+		w.WriteHeader(500)
+	})
+}
+
+func (r *recorder) Record(result *api.MirrorResult) { r.results <- result }
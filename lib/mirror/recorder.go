@@ -0,0 +1,72 @@
+package mirror
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Meduzz/modulr/api"
+)
+
+type (
+	// StatsRecorder - keeps running totals of mirrored requests per service and logs mismatches
+	StatsRecorder struct {
+		stats map[string]*Stats // service name -> stats
+		lock  *sync.Mutex
+	}
+
+	// Stats - totals of the mirrored requests of a service
+	Stats struct {
+		Requests         int64         `json:"requests"`         // number of mirrored requests
+		StatusMismatches int64         `json:"statusMismatches"` // requests where the shadow status differed
+		ShadowErrors     int64         `json:"shadowErrors"`     // requests where the shadow failed or timed out
+		Latency          time.Duration `json:"latency"`          // total latency of the primary
+		ShadowLatency    time.Duration `json:"shadowLatency"`    // total latency of the shadow
+	}
+)
+
+// NewStatsRecorder - creates a new in memory recorder
+func NewStatsRecorder() *StatsRecorder {
+	return &StatsRecorder{
+		stats: make(map[string]*Stats),
+		lock:  &sync.Mutex{},
+	}
+}
+
+func (s *StatsRecorder) Record(result *api.MirrorResult) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	stats, ok := s.stats[result.Service]
+
+	if !ok {
+		stats = &Stats{}
+		s.stats[result.Service] = stats
+	}
+
+	stats.Requests++
+	stats.Latency += result.Latency
+	stats.ShadowLatency += result.ShadowLatency
+
+	if result.ShadowError != nil {
+		stats.ShadowErrors++
+		log.Printf("Mirroring %s %s to %s threw error: %v\n", result.Method, result.Path, result.Shadow, result.ShadowError)
+	} else if result.Status != result.ShadowStatus {
+		stats.StatusMismatches++
+		log.Printf("Mirroring %s %s to %s returned %d, expected %d\n", result.Method, result.Path, result.Shadow, result.ShadowStatus, result.Status)
+	}
+}
+
+// Stats - a copy of the totals of a service
+func (s *StatsRecorder) Stats(name string) Stats {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	stats, ok := s.stats[name]
+
+	if !ok {
+		return Stats{}
+	}
+
+	return *stats
+}
@@ -0,0 +1,418 @@
+package outlier
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Meduzz/modulr/api"
+	"github.com/Meduzz/modulr/lib/response"
+)
+
+type (
+	outlierDetector struct {
+		registry   api.ServiceRegistry
+		detections map[string]*detecting // service name -> detection
+		lock       *sync.RWMutex
+	}
+
+	detecting struct {
+		detection *api.OutlierDetection
+		base      time.Duration
+		max       time.Duration
+		instances map[string]*instance // instance id -> stats
+		lock      *sync.Mutex
+	}
+
+	instance struct {
+		errors        int           // 5xx in a row
+		gatewayErrors int           // 502, 503 & 504 in a row
+		latency       time.Duration // moving average
+		requests      int           // since it was last let back
+		ejections     int           // in a row
+		ejectedUntil  time.Time
+		returned      time.Time // when it was last let back
+	}
+)
+
+const (
+	defaultMinRequests        = 10
+	defaultBaseEjectionTime   = 30 * time.Second
+	defaultMaxEjectionTime    = 5 * time.Minute
+	defaultMaxEjectionPercent = 10
+
+	// weight of the latest call in the moving average of latencies
+	smoothing = 0.1
+	// latency outliers are only judged among at least this many instances
+	minSiblings = 3
+)
+
+// NewOutlierDetector - creates a new outlier detector without any detections
+func NewOutlierDetector(registry api.ServiceRegistry) api.OutlierDetector {
+	o := &outlierDetector{
+		registry:   registry,
+		detections: make(map[string]*detecting),
+		lock:       &sync.RWMutex{},
+	}
+
+	registry.Plugin(o)
+
+	return o
+}
+
+func (o *outlierDetector) Filter(pool []api.Service) []api.Service {
+	if len(pool) == 0 {
+		return pool
+	}
+
+	it, ok := o.detection(pool[0].GetName())
+
+	if !ok {
+		return pool
+	}
+
+	it.lock.Lock()
+	defer it.lock.Unlock()
+
+	now := time.Now()
+	healthy := make([]api.Service, 0, len(pool))
+
+	for _, service := range pool {
+		stats, ok := it.instances[service.GetID()]
+
+		if !ok || !stats.ejected(now) {
+			healthy = append(healthy, service)
+		}
+	}
+
+	if len(healthy) == 0 {
+		return pool
+	}
+
+	return healthy
+}
+
+func (o *outlierDetector) WrapInstance(service api.Service, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		it, ok := o.detection(service.GetName())
+
+		if !ok {
+			handler.ServeHTTP(w, req)
+			return
+		}
+
+		writer := response.NewWriter(w)
+		start := time.Now()
+		handler.ServeHTTP(writer, req)
+
+		o.observe(it, service, writer.Status(), time.Since(start))
+	})
+}
+
+func (o *outlierDetector) Set(detection *api.OutlierDetection) error {
+	if detection.Service == "" {
+		return fmt.Errorf("outlier detection is missing a service")
+	}
+
+	if detection.ConsecutiveErrors < 0 || detection.ConsecutiveGatewayErrors < 0 || detection.LatencyFactor < 0 || detection.MinRequests < 0 {
+		return fmt.Errorf("outlier detection for %s can't be negative", detection.Service)
+	}
+
+	if detection.LatencyFactor > 0 && detection.LatencyFactor <= 1 {
+		return fmt.Errorf("outlier detection for %s needs a latency factor above 1", detection.Service)
+	}
+
+	if detection.MaxEjectionPercent < 0 || detection.MaxEjectionPercent > 100 {
+		return fmt.Errorf("outlier detection for %s needs a max ejection percent between 0 and 100", detection.Service)
+	}
+
+	it := &detecting{
+		detection: detection,
+		base:      defaultBaseEjectionTime,
+		max:       defaultMaxEjectionTime,
+		instances: make(map[string]*instance),
+		lock:      &sync.Mutex{},
+	}
+
+	var err error
+
+	if detection.BaseEjectionTime != "" {
+		it.base, err = time.ParseDuration(detection.BaseEjectionTime)
+
+		if err != nil {
+			return fmt.Errorf("outlier detection for %s has an invalid base ejection time: %w", detection.Service, err)
+		}
+	}
+
+	if detection.MaxEjectionTime != "" {
+		it.max, err = time.ParseDuration(detection.MaxEjectionTime)
+
+		if err != nil {
+			return fmt.Errorf("outlier detection for %s has an invalid max ejection time: %w", detection.Service, err)
+		}
+	}
+
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	o.detections[detection.Service] = it
+
+	return nil
+}
+
+func (o *outlierDetector) Remove(name string) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	delete(o.detections, name)
+}
+
+func (o *outlierDetector) Detections() []*api.OutlierDetection {
+	o.lock.RLock()
+	defer o.lock.RUnlock()
+
+	detections := make([]*api.OutlierDetection, 0, len(o.detections))
+
+	for _, it := range o.detections {
+		detections = append(detections, it.detection)
+	}
+
+	sort.Slice(detections, func(i, j int) bool {
+		return detections[i].Service < detections[j].Service
+	})
+
+	return detections
+}
+
+func (o *outlierDetector) Ejected(name string) []string {
+	ejected := make([]string, 0)
+	it, ok := o.detection(name)
+
+	if !ok {
+		return ejected
+	}
+
+	it.lock.Lock()
+	defer it.lock.Unlock()
+
+	now := time.Now()
+
+	for id, stats := range it.instances {
+		if stats.ejected(now) {
+			ejected = append(ejected, id)
+		}
+	}
+
+	sort.Strings(ejected)
+
+	return ejected
+}
+
+func (o *outlierDetector) RegisterService(service api.Service) error {
+	return nil
+}
+
+func (o *outlierDetector) DeregisterService(service api.Service) error {
+	return nil
+}
+
+func (o *outlierDetector) RegisterInstance(service api.Service) error {
+	return nil
+}
+
+// DeregisterInstance - forget what we know about the instance
+func (o *outlierDetector) DeregisterInstance(service api.Service) error {
+	it, ok := o.detection(service.GetName())
+
+	if !ok {
+		return nil
+	}
+
+	it.lock.Lock()
+	defer it.lock.Unlock()
+
+	delete(it.instances, service.GetID())
+
+	return nil
+}
+
+func (o *outlierDetector) detection(name string) (*detecting, bool) {
+	o.lock.RLock()
+	defer o.lock.RUnlock()
+
+	it, ok := o.detections[name]
+
+	return it, ok
+}
+
+// observe - record how a call went and eject the instance if that made it an outlier
+func (o *outlierDetector) observe(it *detecting, service api.Service, status int, latency time.Duration) {
+	// the registry is asked before locking, it's needed to know how many may be ejected
+	instances, err := o.registry.Lookup(service.GetName())
+
+	if err != nil {
+		log.Printf("Looking up services for service %s threw error: %v\n", service.GetName(), err)
+	}
+
+	it.lock.Lock()
+	defer it.lock.Unlock()
+
+	now := time.Now()
+	stats, ok := it.instances[service.GetID()]
+
+	if !ok {
+		stats = &instance{}
+		it.instances[service.GetID()] = stats
+	}
+
+	// calls that were in flight when the instance was ejected don't count
+	if stats.ejected(now) {
+		return
+	}
+
+	stats.record(now, status, latency, it.max)
+
+	reason := it.outlier(now, stats)
+
+	if reason == "" || !it.mayEject(now, len(instances)) {
+		return
+	}
+
+	stats.ejections++
+	ejection := it.base * time.Duration(stats.ejections)
+
+	if ejection > it.max {
+		ejection = it.max
+	}
+
+	stats.ejectedUntil = now.Add(ejection)
+
+	log.Printf("Ejecting %s.%s for %s, %s\n", service.GetName(), service.GetID(), ejection, reason)
+}
+
+// outlier - why the instance is an outlier, empty if it's not
+func (d *detecting) outlier(now time.Time, stats *instance) string {
+	detection := d.detection
+
+	if detection.ConsecutiveErrors > 0 && stats.errors >= detection.ConsecutiveErrors {
+		return fmt.Sprintf("%d errors in a row", stats.errors)
+	}
+
+	if detection.ConsecutiveGatewayErrors > 0 && stats.gatewayErrors >= detection.ConsecutiveGatewayErrors {
+		return fmt.Sprintf("%d gateway errors in a row", stats.gatewayErrors)
+	}
+
+	if detection.LatencyFactor == 0 {
+		return ""
+	}
+
+	minRequests := detection.MinRequests
+
+	if minRequests == 0 {
+		minRequests = defaultMinRequests
+	}
+
+	if stats.requests < minRequests {
+		return ""
+	}
+
+	latencies := make([]time.Duration, 0, len(d.instances))
+
+	for _, it := range d.instances {
+		if it.requests >= minRequests && !it.ejected(now) {
+			latencies = append(latencies, it.latency)
+		}
+	}
+
+	if len(latencies) < minSiblings {
+		return ""
+	}
+
+	sort.Slice(latencies, func(i, j int) bool {
+		return latencies[i] < latencies[j]
+	})
+
+	median := latencies[len(latencies)/2]
+
+	if float64(stats.latency) > float64(median)*detection.LatencyFactor {
+		return fmt.Sprintf("latency %s against a median of %s", stats.latency, median)
+	}
+
+	return ""
+}
+
+// mayEject - one instance may always be ejected, but never all of them
+func (d *detecting) mayEject(now time.Time, total int) bool {
+	if total < 2 {
+		return false
+	}
+
+	percent := d.detection.MaxEjectionPercent
+
+	if percent == 0 {
+		percent = defaultMaxEjectionPercent
+	}
+
+	allowed := total * percent / 100
+
+	if allowed < 1 {
+		allowed = 1
+	}
+
+	if allowed > total-1 {
+		allowed = total - 1
+	}
+
+	ejected := 0
+
+	for _, it := range d.instances {
+		if it.ejected(now) {
+			ejected++
+		}
+	}
+
+	return ejected < allowed
+}
+
+// record - instances that were let back start over, and are forgiven earlier ejections once they've stayed long enough
+func (i *instance) record(now time.Time, status int, latency time.Duration, forgiveAfter time.Duration) {
+	if !i.ejectedUntil.IsZero() {
+		i.returned = i.ejectedUntil
+		i.ejectedUntil = time.Time{}
+		i.errors = 0
+		i.gatewayErrors = 0
+		i.latency = 0
+		i.requests = 0
+	}
+
+	if i.ejections > 0 && now.Sub(i.returned) > forgiveAfter {
+		i.ejections = 0
+	}
+
+	if status >= 500 {
+		i.errors++
+	} else {
+		i.errors = 0
+	}
+
+	if status == 502 || status == 503 || status == 504 {
+		i.gatewayErrors++
+	} else {
+		i.gatewayErrors = 0
+	}
+
+	if i.requests == 0 {
+		i.latency = latency
+	} else {
+		i.latency = time.Duration(smoothing*float64(latency) + (1-smoothing)*float64(i.latency))
+	}
+
+	i.requests++
+}
+
+func (i *instance) ejected(now time.Time) bool {
+	return now.Before(i.ejectedUntil)
+}
@@ -0,0 +1,212 @@
+package outlier
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Meduzz/modulr/api"
+)
+
+type (
+	fakeRegistry struct {
+		api.ServiceRegistry
+		services []api.Service
+	}
+)
+
+func TestOutlierDetector(t *testing.T) {
+	first := &api.DefaultService{ID: "1", Name: "test"}
+	second := &api.DefaultService{ID: "2", Name: "test"}
+	third := &api.DefaultService{ID: "3", Name: "test"}
+	fourth := &api.DefaultService{ID: "4", Name: "test"}
+	pool := []api.Service{first, second, third, fourth}
+
+	// call - calls the instance through the detector, answering with status after the delay
+	call := func(subject api.OutlierDetector, service api.Service, status int, delay time.Duration) {
+		handler := subject.WrapInstance(service, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			time.Sleep(delay)
+			w.WriteHeader(status)
+		}))
+
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/call/test/", nil))
+	}
+
+	t.Run("without a detection", func(t *testing.T) {
+		subject := NewOutlierDetector(&fakeRegistry{services: pool})
+
+		for i := 0; i < 10; i++ {
+			call(subject, first, 500, 0)
+		}
+
+		if len(subject.Filter(pool)) != 4 {
+			t.Error("expected every instance to stay in the pool")
+		}
+	})
+
+	t.Run("consecutive errors", func(t *testing.T) {
+		subject := NewOutlierDetector(&fakeRegistry{services: pool})
+		err := subject.Set(&api.OutlierDetection{Service: "test", ConsecutiveErrors: 3, MaxEjectionPercent: 50})
+
+		if err != nil {
+			t.Errorf("There was an unexpected error: %v", err)
+		}
+
+		call(subject, first, 500, 0)
+		call(subject, first, 500, 0)
+		call(subject, first, 200, 0)
+		call(subject, first, 500, 0)
+		call(subject, first, 500, 0)
+
+		if len(subject.Filter(pool)) != 4 {
+			t.Error("expected a success to reset the errors in a row")
+		}
+
+		call(subject, first, 500, 0)
+
+		filtered := subject.Filter(pool)
+
+		if len(filtered) != 3 || filtered[0].GetID() != "2" {
+			t.Errorf("expected the first instance to be ejected but got %v", filtered)
+		}
+
+		ejected := subject.Ejected("test")
+
+		if len(ejected) != 1 || ejected[0] != "1" {
+			t.Errorf("expected the first instance to be listed as ejected but got %v", ejected)
+		}
+	})
+
+	t.Run("gateway errors", func(t *testing.T) {
+		subject := NewOutlierDetector(&fakeRegistry{services: pool})
+		subject.Set(&api.OutlierDetection{Service: "test", ConsecutiveGatewayErrors: 2})
+
+		call(subject, second, 500, 0)
+		call(subject, second, 500, 0)
+
+		if len(subject.Filter(pool)) != 4 {
+			t.Error("expected plain errors to not count as gateway errors")
+		}
+
+		call(subject, second, 502, 0)
+		call(subject, second, 504, 0)
+
+		if len(subject.Filter(pool)) != 3 {
+			t.Error("expected the second instance to be ejected")
+		}
+	})
+
+	t.Run("latency outliers", func(t *testing.T) {
+		subject := NewOutlierDetector(&fakeRegistry{services: pool})
+		subject.Set(&api.OutlierDetection{Service: "test", LatencyFactor: 3, MinRequests: 2})
+
+		for i := 0; i < 2; i++ {
+			call(subject, first, 200, time.Millisecond)
+			call(subject, second, 200, time.Millisecond)
+			call(subject, third, 200, time.Millisecond)
+		}
+
+		call(subject, fourth, 200, 20*time.Millisecond)
+
+		if len(subject.Filter(pool)) != 4 {
+			t.Error("expected the slow instance to need min requests before being judged")
+		}
+
+		call(subject, fourth, 200, 20*time.Millisecond)
+
+		filtered := subject.Filter(pool)
+
+		if len(filtered) != 3 || filtered[2].GetID() != "3" {
+			t.Errorf("expected the slow instance to be ejected but got %v", filtered)
+		}
+	})
+
+	t.Run("max ejection percent", func(t *testing.T) {
+		subject := NewOutlierDetector(&fakeRegistry{services: pool})
+		subject.Set(&api.OutlierDetection{Service: "test", ConsecutiveErrors: 1, MaxEjectionPercent: 50})
+
+		for _, it := range pool {
+			call(subject, it, 500, 0)
+		}
+
+		if len(subject.Filter(pool)) != 2 {
+			t.Error("expected only half of the instances to be ejected")
+		}
+
+		// a single instance is never ejected
+		single := NewOutlierDetector(&fakeRegistry{services: []api.Service{first}})
+		single.Set(&api.OutlierDetection{Service: "test", ConsecutiveErrors: 1, MaxEjectionPercent: 100})
+
+		call(single, first, 500, 0)
+
+		if len(single.Filter([]api.Service{first})) != 1 {
+			t.Error("expected the only instance to stay")
+		}
+	})
+
+	t.Run("ejection time grows", func(t *testing.T) {
+		subject := NewOutlierDetector(&fakeRegistry{services: pool})
+		subject.Set(&api.OutlierDetection{Service: "test", ConsecutiveErrors: 1, BaseEjectionTime: "50ms", MaxEjectionTime: "1s"})
+
+		call(subject, first, 500, 0)
+
+		if len(subject.Filter(pool)) != 3 {
+			t.Error("expected the first instance to be ejected")
+		}
+
+		time.Sleep(70 * time.Millisecond)
+
+		if len(subject.Filter(pool)) != 4 {
+			t.Error("expected the first instance to be back")
+		}
+
+		call(subject, first, 500, 0)
+		time.Sleep(70 * time.Millisecond)
+
+		if len(subject.Filter(pool)) != 3 {
+			t.Error("expected the second ejection to last longer")
+		}
+
+		time.Sleep(50 * time.Millisecond)
+
+		if len(subject.Filter(pool)) != 4 {
+			t.Error("expected the first instance to be back again")
+		}
+	})
+
+	t.Run("deregistered instances are forgotten", func(t *testing.T) {
+		subject := NewOutlierDetector(&fakeRegistry{services: pool})
+		subject.Set(&api.OutlierDetection{Service: "test", ConsecutiveErrors: 1})
+
+		call(subject, first, 500, 0)
+		subject.DeregisterInstance(first)
+
+		if len(subject.Ejected("test")) != 0 {
+			t.Error("expected the deregistered instance to be forgotten")
+		}
+	})
+
+	t.Run("invalid detections", func(t *testing.T) {
+		subject := NewOutlierDetector(&fakeRegistry{services: pool})
+
+		invalid := []*api.OutlierDetection{
+			{},
+			{Service: "test", LatencyFactor: 0.5},
+			{Service: "test", MaxEjectionPercent: 101},
+			{Service: "test", BaseEjectionTime: "soon"},
+		}
+
+		for _, it := range invalid {
+			if subject.Set(it) == nil {
+				t.Errorf("expected an error for %v", it)
+			}
+		}
+	})
+}
+
+func (f *fakeRegistry) Plugin(api.Lifecycle) {}
+
+func (f *fakeRegistry) Lookup(string) ([]api.Service, error) {
+	return f.services, nil
+}
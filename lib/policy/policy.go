@@ -0,0 +1,269 @@
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/Meduzz/modulr/api"
+	"github.com/Meduzz/modulr/lib/auth"
+	"github.com/Meduzz/modulr/lib/router"
+)
+
+type (
+	policyEngine struct {
+		policy *api.Policy
+		lock   *sync.RWMutex
+	}
+
+	// request - what's being decided on, calls have a service and publishes a topic
+	request struct {
+		identity *api.Identity
+		service  string
+		method   string
+		path     string
+		topic    string
+	}
+)
+
+const (
+	// Allow - rules that let requests through
+	Allow = "allow"
+	// Deny - rules that stop requests
+	Deny = "deny"
+)
+
+// ErrDenied - returned, wrapped, when a policy denies a call or publish
+var ErrDenied = errors.New("denied by policy")
+
+// NewPolicyEngine - creates a new policy engine without a policy, allowing everything
+func NewPolicyEngine() api.PolicyEngine {
+	return &policyEngine{
+		lock: &sync.RWMutex{},
+	}
+}
+
+// LoadFile - replace the policy of the engine with the policy in a json file
+func LoadFile(engine api.PolicyEngine, path string) error {
+	bs, err := os.ReadFile(path)
+
+	if err != nil {
+		return err
+	}
+
+	policy := &api.Policy{}
+	err = json.Unmarshal(bs, policy)
+
+	if err != nil {
+		return err
+	}
+
+	return engine.Load(policy)
+}
+
+func (p *policyEngine) Wrap(name string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		identity := auth.IdentityFrom(req.Context())
+		err := p.AuthorizeCall(identity, name, req.Method, router.Path(req, name))
+
+		if err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		handler.ServeHTTP(w, req)
+	})
+}
+
+func (p *policyEngine) AuthorizeCall(identity *api.Identity, service, method, path string) error {
+	return p.decide(&request{
+		identity: identity,
+		service:  service,
+		method:   method,
+		path:     canonical(path),
+	})
+}
+
+func (p *policyEngine) AuthorizePublish(identity *api.Identity, topic string) error {
+	return p.decide(&request{
+		identity: identity,
+		topic:    topic,
+	})
+}
+
+func (p *policyEngine) Load(policy *api.Policy) error {
+	for _, rule := range policy.Rules {
+		if rule.Effect != Allow && rule.Effect != Deny {
+			return fmt.Errorf("rule %s has an unknown effect %s", rule.Name, rule.Effect)
+		}
+
+		if len(rule.Services) > 0 && len(rule.Topics) > 0 {
+			return fmt.Errorf("rule %s has both services and topics", rule.Name)
+		}
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.policy = policy
+
+	return nil
+}
+
+func (p *policyEngine) Policy() *api.Policy {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	return p.policy
+}
+
+// decide - deny rules win over allow rules, without a policy everything is allowed. Decisions are logged for auditing.
+func (p *policyEngine) decide(req *request) error {
+	p.lock.RLock()
+	policy := p.policy
+	p.lock.RUnlock()
+
+	if policy == nil {
+		return nil
+	}
+
+	var allowedBy *api.PolicyRule
+
+	for _, rule := range policy.Rules {
+		if !req.matches(rule) {
+			continue
+		}
+
+		if rule.Effect == Deny {
+			audit(req, false, fmt.Sprintf("rule %s", rule.Name))
+			return fmt.Errorf("%w: %s", ErrDenied, rule.Name)
+		}
+
+		if allowedBy == nil {
+			allowedBy = rule
+		}
+	}
+
+	if allowedBy != nil {
+		audit(req, true, fmt.Sprintf("rule %s", allowedBy.Name))
+		return nil
+	}
+
+	if policy.DefaultDeny {
+		audit(req, false, "default")
+		return fmt.Errorf("%w: no rule allows it", ErrDenied)
+	}
+
+	audit(req, true, "default")
+
+	return nil
+}
+
+// canonical - the path decoded & cleaned, so that /x/../admin, //admin or %2e%2e can't slip past rules like /admin*
+func canonical(it string) string {
+	// decoded until it stops changing, in case the instance decodes once more
+	for i := 0; i < 3; i++ {
+		decoded, err := url.PathUnescape(it)
+
+		if err != nil || decoded == it {
+			break
+		}
+
+		it = decoded
+	}
+
+	cleaned := path.Clean("/" + it)
+
+	if strings.HasSuffix(it, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+
+	return cleaned
+}
+
+func (r *request) matches(rule *api.PolicyRule) bool {
+	if r.topic != "" {
+		if len(rule.Services) > 0 || len(rule.Methods) > 0 || len(rule.Paths) > 0 || !matchesAny(rule.Topics, r.topic) {
+			return false
+		}
+	} else {
+		if len(rule.Topics) > 0 || !matchesAny(rule.Services, r.service) || !matchesAny(rule.Paths, r.path) {
+			return false
+		}
+
+		if len(rule.Methods) > 0 && !containsFold(rule.Methods, r.method) {
+			return false
+		}
+	}
+
+	if len(rule.Subjects) > 0 {
+		if r.identity == nil || !matchesAny(rule.Subjects, r.identity.Subject) {
+			return false
+		}
+	}
+
+	for claim, value := range rule.Claims {
+		if r.identity == nil || r.identity.Claims[claim] != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// audit - one line per decision, with who asked for what
+func audit(req *request, allowed bool, reason string) {
+	decision := "denied"
+
+	if allowed {
+		decision = "allowed"
+	}
+
+	subject := "anonymous"
+
+	if req.identity != nil {
+		subject = req.identity.Subject
+	}
+
+	if req.topic != "" {
+		log.Printf("Policy %s %s publishing to %s (%s)\n", decision, subject, req.topic, reason)
+	} else {
+		log.Printf("Policy %s %s calling %s %s %s (%s)\n", decision, subject, req.service, req.method, req.path, reason)
+	}
+}
+
+// matchesAny - empty patterns match anything, patterns ending with * match by prefix
+func matchesAny(patterns []string, value string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+
+	for _, pattern := range patterns {
+		if strings.HasSuffix(pattern, "*") {
+			if strings.HasPrefix(value, strings.TrimSuffix(pattern, "*")) {
+				return true
+			}
+		} else if pattern == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsFold(list []string, it string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, it) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,182 @@
+package policy
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Meduzz/modulr/api"
+	"github.com/Meduzz/modulr/lib/auth"
+)
+
+type (
+	// headerMethod - trusts whoever the X-Caller header says it is
+	headerMethod struct{}
+)
+
+func TestAuthorizeCall(t *testing.T) {
+	orders := &api.Identity{Subject: "orders", Claims: map[string]string{"team": "shop"}}
+	billing := &api.Identity{Subject: "billing", Claims: map[string]string{"team": "finance"}}
+
+	subject := NewPolicyEngine()
+
+	t.Run("without a policy", func(t *testing.T) {
+		err := subject.AuthorizeCall(nil, "payments", "POST", "/charge")
+
+		if err != nil {
+			t.Errorf("There was an unexpected error: %v", err)
+		}
+	})
+
+	err := subject.Load(&api.Policy{
+		DefaultDeny: true,
+		Rules: []*api.PolicyRule{
+			{Name: "orders charge", Effect: Allow, Subjects: []string{"orders"}, Services: []string{"payments"}, Methods: []string{"post"}, Paths: []string{"/charge*"}},
+			{Name: "finance reads", Effect: Allow, Claims: map[string]string{"team": "finance"}, Services: []string{"payments"}, Methods: []string{"GET"}},
+			{Name: "no admin", Effect: Deny, Services: []string{"payments"}, Paths: []string{"/admin*"}},
+			{Name: "health", Effect: Allow, Services: []string{"*"}, Paths: []string{"/health"}},
+			{Name: "anyone known", Effect: Allow, Subjects: []string{"*"}, Services: []string{"catalog"}},
+		},
+	})
+
+	if err != nil {
+		t.Fatalf("There was an unexpected error: %v", err)
+	}
+
+	cases := []struct {
+		name     string
+		identity *api.Identity
+		service  string
+		method   string
+		path     string
+		allowed  bool
+	}{
+		{"subject, method & path", orders, "payments", "POST", "/charge/123", true},
+		{"wrong method", orders, "payments", "DELETE", "/charge/123", false},
+		{"wrong subject", billing, "payments", "POST", "/charge/123", false},
+		{"claims", billing, "payments", "GET", "/charges", true},
+		{"deny wins", billing, "payments", "GET", "/admin/users", false},
+		{"dot segments", billing, "payments", "GET", "/charges/../admin/users", false},
+		{"double slashes", billing, "payments", "GET", "//admin/users", false},
+		{"encoded dot segments", billing, "payments", "GET", "/charges/%2e%2e/admin/users", false},
+		{"dot segments out of an allowed path", orders, "payments", "POST", "/charge/../refund", false},
+		{"wildcard service", nil, "payments", "GET", "/health", true},
+		{"any authenticated", billing, "catalog", "GET", "/items", true},
+		{"anonymous is not authenticated", nil, "catalog", "GET", "/items", false},
+		{"default deny", orders, "shipping", "GET", "/", false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := subject.AuthorizeCall(c.identity, c.service, c.method, c.path)
+
+			if c.allowed && err != nil {
+				t.Errorf("There was an unexpected error: %v", err)
+			}
+
+			if !c.allowed && !errors.Is(err, ErrDenied) {
+				t.Errorf("expected to be denied but got %v", err)
+			}
+		})
+	}
+
+	t.Run("default allow", func(t *testing.T) {
+		subject.Load(&api.Policy{Rules: []*api.PolicyRule{{Name: "no admin", Effect: Deny, Paths: []string{"/admin*"}}}})
+
+		if subject.AuthorizeCall(nil, "shipping", "GET", "/") != nil {
+			t.Error("expected calls no rule matches to be allowed")
+		}
+
+		if subject.AuthorizeCall(orders, "shipping", "GET", "/admin") == nil {
+			t.Error("expected a call to be denied")
+		}
+	})
+
+	t.Run("invalid policies", func(t *testing.T) {
+		err := subject.Load(&api.Policy{Rules: []*api.PolicyRule{{Name: "maybe", Effect: "perhaps"}}})
+
+		if err == nil {
+			t.Error("expected an error")
+		}
+
+		err = subject.Load(&api.Policy{Rules: []*api.PolicyRule{{Name: "both", Effect: Allow, Services: []string{"a"}, Topics: []string{"b"}}}})
+
+		if err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
+
+func TestAuthorizePublish(t *testing.T) {
+	orders := &api.Identity{Subject: "orders"}
+
+	subject := NewPolicyEngine()
+	subject.Load(&api.Policy{
+		DefaultDeny: true,
+		Rules: []*api.PolicyRule{
+			{Name: "order events", Effect: Allow, Subjects: []string{"orders"}, Topics: []string{"orders.*"}},
+			{Name: "payments only", Effect: Allow, Services: []string{"*"}},
+		},
+	})
+
+	if subject.AuthorizePublish(orders, "orders.created") != nil {
+		t.Error("expected orders to publish order events")
+	}
+
+	if subject.AuthorizePublish(orders, "payments.created") == nil {
+		t.Error("expected orders not to publish payment events")
+	}
+
+	if subject.AuthorizePublish(nil, "orders.created") == nil {
+		t.Error("expected anonymous publishers to be denied")
+	}
+}
+
+func TestWrap(t *testing.T) {
+	authenticator := auth.NewAuthenticator()
+	authenticator.RegisterMethod("header", &headerMethod{})
+
+	subject := NewPolicyEngine()
+	subject.Load(&api.Policy{
+		DefaultDeny: true,
+		Rules:       []*api.PolicyRule{{Name: "orders", Effect: Allow, Subjects: []string{"orders"}, Paths: []string{"/charge"}}},
+	})
+
+	handler := subject.Wrap("payments", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(200)
+	}))
+
+	engine := authenticator.Wrap(&api.AuthRequirements{Methods: []string{"header"}}, handler)
+
+	call := func(caller, path string) int {
+		req := httptest.NewRequest("POST", path, nil)
+		req.Header.Set("X-Caller", caller)
+		res := httptest.NewRecorder()
+		engine.ServeHTTP(res, req)
+
+		return res.Code
+	}
+
+	if code := call("orders", "/call/payments/charge"); code != 200 {
+		t.Errorf("expected 200 but got %d", code)
+	}
+
+	if code := call("orders", "/call/payments/refund"); code != 403 {
+		t.Errorf("expected 403 but got %d", code)
+	}
+
+	if code := call("billing", "/call/payments/charge"); code != 403 {
+		t.Errorf("expected 403 but got %d", code)
+	}
+}
+
+func (h *headerMethod) Authenticate(req *http.Request) (*api.Identity, error) {
+	caller := req.Header.Get("X-Caller")
+
+	if caller == "" {
+		return nil, nil
+	}
+
+	return &api.Identity{Subject: caller, Claims: map[string]string{}}, nil
+}
@@ -0,0 +1,90 @@
+package proxy
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/Meduzz/modulr/api"
+	"github.com/Meduzz/modulr/lib/router"
+	"github.com/gin-gonic/gin"
+)
+
+type (
+	// ginForwarder - runs a forwarder written against gin as a http.Handler, by an engine of our own
+	ginForwarder struct {
+		forwarder api.Forwarder
+		engine    *gin.Engine
+	}
+
+	handlerKey struct{}
+)
+
+// CallHandler - serves /<service>/<path> of every service for net/http, the net/http twin of /call/:service/*path.
+// Mount it with http.StripPrefix, like mux.Handle("/call/", http.StripPrefix("/call", proxy.CallHandler(p))).
+func CallHandler(p api.Proxy) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		name, path, _ := strings.Cut(strings.TrimPrefix(req.URL.Path, "/"), "/")
+
+		if name == "" {
+			http.NotFound(w, req)
+			return
+		}
+
+		req = router.WithMatch(req, &api.Match{
+			Route: &api.Route{Service: name},
+			Path:  "/" + path,
+		})
+
+		p.HandlerFor(name).ServeHTTP(w, req)
+	})
+}
+
+// HandlerFor - the handler chain of the service, the path is what the service sees unless a route matched
+func (p *proxy) HandlerFor(name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if router.MatchFrom(req.Context()) == nil {
+			req = router.WithMatch(req, &api.Match{
+				Route: &api.Route{Service: name},
+				Path:  req.URL.Path,
+			})
+		}
+
+		handler, err := p.handlerFor(name)
+
+		if err != nil {
+			log.Printf("Looking up %s threw error: %v\n", name, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		handler.ServeHTTP(w, req)
+	})
+}
+
+func (p *proxy) RegisterHttpForwarder(typ string, forwarder api.HttpForwarder) {
+	p.registry[typ] = forwarder
+}
+
+// HttpHandler - the request carries the gin handler of the instance to the engine
+func (g *ginForwarder) HttpHandler(service api.Service) http.Handler {
+	handler := g.forwarder.Handler(service)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		g.engine.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), handlerKey{}, handler)))
+	})
+}
+
+// ginHandler - gin starts no route handlers out with 404, handlers that only write should still answer 200
+func ginHandler(ctx *gin.Context) {
+	handler, ok := ctx.Request.Context().Value(handlerKey{}).(gin.HandlerFunc)
+
+	if !ok {
+		ctx.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	ctx.Status(http.StatusOK)
+	handler(ctx)
+}
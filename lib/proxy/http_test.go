@@ -0,0 +1,93 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Meduzz/modulr/api"
+	"github.com/Meduzz/modulr/lib/router"
+	"github.com/gin-gonic/gin"
+)
+
+type (
+	fakeRegistry struct {
+		api.ServiceRegistry
+		services map[string][]api.Service
+	}
+
+	firstLoadBalancer struct{}
+
+	echoForwarder struct{}
+)
+
+func TestHttpHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	subject := NewProxy(&fakeRegistry{services: map[string][]api.Service{
+		"test": {&api.DefaultService{ID: "1", Name: "test", Type: "echo"}},
+	}})
+	subject.SetLoadBalancer(&firstLoadBalancer{})
+	subject.RegisterHttpForwarder("echo", &echoForwarder{})
+
+	call := func(handler http.Handler, path string) *httptest.ResponseRecorder {
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, httptest.NewRequest("GET", path, nil))
+
+		return res
+	}
+
+	t.Run("handler for a service", func(t *testing.T) {
+		mux := http.NewServeMux()
+		mux.Handle("/orders/", http.StripPrefix("/orders", subject.HandlerFor("test")))
+
+		res := call(mux, "/orders/things?a=b")
+
+		if res.Code != 200 || res.Body.String() != "1 /things" {
+			t.Errorf("expected the echo forwarder to answer but got %d %s", res.Code, res.Body.String())
+		}
+	})
+
+	t.Run("call handler", func(t *testing.T) {
+		mux := http.NewServeMux()
+		mux.Handle("/call/", http.StripPrefix("/call", CallHandler(subject)))
+
+		res := call(mux, "/call/test/things")
+
+		if res.Code != 200 || res.Body.String() != "1 /things" {
+			t.Errorf("expected the echo forwarder to answer but got %d %s", res.Code, res.Body.String())
+		}
+
+		res = call(mux, "/call/unknown/things")
+
+		if res.Code != 404 {
+			t.Errorf("expected 404 for a service without instances but got %d", res.Code)
+		}
+	})
+
+	t.Run("routed handler", func(t *testing.T) {
+		routes := router.NewRouter()
+		routes.Add(&api.Route{Name: "orders", Service: "test", Prefix: "/api/orders", StripPrefix: true})
+
+		res := call(router.HttpHandler(routes, subject), "/api/orders/things")
+
+		if res.Code != 200 || res.Body.String() != "1 /things" {
+			t.Errorf("expected the echo forwarder to answer but got %d %s", res.Code, res.Body.String())
+		}
+	})
+}
+
+func (f *fakeRegistry) Lookup(name string) ([]api.Service, error) {
+	return f.services[name], nil
+}
+
+func (f *firstLoadBalancer) Next(services []api.Service) api.Service {
+	return services[0]
+}
+
+func (e *echoForwarder) HttpHandler(service api.Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprintf(w, "%s %s", service.GetID(), router.Path(req, service.GetName()))
+	})
+}
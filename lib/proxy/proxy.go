@@ -9,50 +9,224 @@ import (
 
 type (
 	proxy struct {
-		registry        map[string]api.Forwarder
+		registry        map[string]api.HttpForwarder
 		serviceRegistry api.ServiceRegistry
 		lb              api.LoadBalancer
+		splitter        api.TrafficSplitter
+		outliers        api.OutlierDetector
+		hedger          api.Hedger
+		failover        api.Failover
+		faults          api.FaultInjector
+		concurrency     api.ConcurrencyLimiter
+		mirror          api.RequestMirror
+		cache           api.ResponseCache
+		limiter         api.RateLimiter
+		authenticator   api.Authenticator
+		policies        api.PolicyEngine
+		engine          *gin.Engine
 	}
 )
 
 // NewProxy - creates a new http loadbalancer
 func NewProxy(serviceRegistry api.ServiceRegistry) api.Proxy {
-	forwarders := make(map[string]api.Forwarder)
+	forwarders := make(map[string]api.HttpForwarder)
 
-	return &proxy{
+	p := &proxy{
 		registry:        forwarders,
 		serviceRegistry: serviceRegistry,
+		engine:          gin.New(),
 	}
+
+	p.engine.NoRoute(ginHandler)
+
+	return p
 }
 
 func (p *proxy) ForwarderFor(name string) (gin.HandlerFunc, error) {
+	handler, err := p.handlerFor(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return func(ctx *gin.Context) {
+		handler.ServeHTTP(ctx.Writer, ctx.Request)
+		// a bare WriteHeader only sticks once gin flushes it, which a borrowed context never does
+		ctx.Writer.WriteHeaderNow()
+	}, nil
+}
+
+// handlerFor - the handler chain of the service, with the instances it has right now
+func (p *proxy) handlerFor(name string) (http.Handler, error) {
 	services, err := p.serviceRegistry.Lookup(name)
 
 	if err != nil {
 		return nil, err
 	}
 
+	var handler http.Handler
+
 	if len(services) == 0 {
-		// TODO also write a pesky log about it?
-		return gin.WrapF(http.NotFound), nil
+		if p.failover != nil {
+			handler = p.failover.Fallback(name)
+		}
+
+		if handler == nil {
+			// TODO also write a pesky log about it?
+			return http.NotFoundHandler(), nil
+		}
+	} else {
+		handler = p.instanceHandler(name, services)
+	}
+
+	// the fallbacks answer in place of the service, so everything guarding the service guards them too
+	if p.faults != nil {
+		handler = p.faults.Wrap(name, handler)
 	}
 
-	service := p.lb.Next(services)
+	if p.concurrency != nil {
+		handler = p.concurrency.Wrap(name, handler)
+	}
+
+	if p.mirror != nil {
+		handler = p.mirror.Wrap(name, handler)
+	}
 
-	forwarder, ok := p.registry[service.GetType()]
+	if p.cache != nil {
+		handler = p.cache.Wrap(name, handler)
+	}
 
-	if !ok {
-		// TODO also write a pesky log about it?
-		return gin.WrapF(http.NotFound), nil
+	if p.limiter != nil {
+		handler = p.limiter.Wrap(name, handler)
 	}
 
-	return forwarder.Handler(service), nil
+	if p.policies != nil {
+		handler = p.policies.Wrap(name, handler)
+	}
+
+	if p.authenticator != nil {
+		handler = p.authenticator.Wrap(requirements(services), handler)
+	}
+
+	return handler, nil
 }
 
 func (p *proxy) RegisterForwarder(typ string, forwarder api.Forwarder) {
-	p.registry[typ] = forwarder
+	p.RegisterHttpForwarder(typ, &ginForwarder{forwarder, p.engine})
 }
 
 func (p *proxy) SetLoadBalancer(lb api.LoadBalancer) {
 	p.lb = lb
 }
+
+func (p *proxy) SetTrafficSplitter(splitter api.TrafficSplitter) {
+	p.splitter = splitter
+}
+
+func (p *proxy) SetOutlierDetector(outliers api.OutlierDetector) {
+	p.outliers = outliers
+}
+
+func (p *proxy) SetHedger(hedger api.Hedger) {
+	p.hedger = hedger
+}
+
+func (p *proxy) SetFailover(failover api.Failover) {
+	p.failover = failover
+}
+
+func (p *proxy) SetFaultInjector(faults api.FaultInjector) {
+	p.faults = faults
+}
+
+func (p *proxy) SetConcurrencyLimiter(concurrency api.ConcurrencyLimiter) {
+	p.concurrency = concurrency
+}
+
+func (p *proxy) SetRequestMirror(mirror api.RequestMirror) {
+	p.mirror = mirror
+}
+
+func (p *proxy) SetResponseCache(cache api.ResponseCache) {
+	p.cache = cache
+}
+
+func (p *proxy) SetRateLimiter(limiter api.RateLimiter) {
+	p.limiter = limiter
+}
+
+func (p *proxy) SetAuthenticator(authenticator api.Authenticator) {
+	p.authenticator = authenticator
+}
+
+func (p *proxy) SetPolicyEngine(policies api.PolicyEngine) {
+	p.policies = policies
+}
+
+// instanceHandler - forwards to an instance of the service, hedging and remembering the last good responses when asked to
+func (p *proxy) instanceHandler(name string, services []api.Service) http.Handler {
+	// the instance is picked per request, since splitting might depend on the request
+	var handler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		pool := services
+
+		if p.splitter != nil {
+			pool = p.splitter.Split(req, services)
+		}
+
+		if p.outliers != nil {
+			pool = p.outliers.Filter(pool)
+		}
+
+		if p.hedger != nil {
+			pool = p.hedger.Filter(req, pool)
+		}
+
+		service := p.lb.Next(pool)
+
+		forwarder, ok := p.registry[service.GetType()]
+
+		if !ok {
+			// TODO also write a pesky log about it?
+			http.NotFound(w, req)
+			return
+		}
+
+		handle := forwarder.HttpHandler(service)
+
+		// calls rejected by the concurrency limits never reached the instance, and say nothing about it
+		if p.outliers != nil {
+			handle = p.outliers.WrapInstance(service, handle)
+		}
+
+		if p.concurrency != nil {
+			handle = p.concurrency.WrapInstance(service, handle)
+		}
+
+		if p.hedger != nil {
+			handle = p.hedger.WrapInstance(service, handle)
+		}
+
+		handle.ServeHTTP(w, req)
+	})
+
+	if p.hedger != nil {
+		handler = p.hedger.Wrap(name, handler)
+	}
+
+	if p.failover != nil {
+		handler = p.failover.Wrap(name, handler)
+	}
+
+	return handler
+}
+
+// requirements - instances of a service should agree on them, the first one declaring any wins
+func requirements(services []api.Service) *api.AuthRequirements {
+	for _, it := range services {
+		if it.GetAuth() != nil {
+			return it.GetAuth()
+		}
+	}
+
+	return nil
+}
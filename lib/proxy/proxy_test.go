@@ -0,0 +1,74 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Meduzz/modulr/api"
+	"github.com/gin-gonic/gin"
+)
+
+type (
+	staticFailover struct {
+		api.Failover
+	}
+
+	denyingPolicies struct {
+		api.PolicyEngine
+	}
+)
+
+func TestForwarderFor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	subject := NewProxy(&fakeRegistry{services: map[string][]api.Service{}})
+	subject.SetLoadBalancer(&firstLoadBalancer{})
+	subject.SetFailover(&staticFailover{})
+
+	call := func(name string) *httptest.ResponseRecorder {
+		handler, err := subject.ForwarderFor(name)
+
+		if err != nil {
+			t.Fatalf("There was an unexpected error: %v", err)
+		}
+
+		res := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(res)
+		ctx.Request = httptest.NewRequest("GET", "/things", nil)
+		handler(ctx)
+
+		return res
+	}
+
+	t.Run("fallback without instances", func(t *testing.T) {
+		res := call("test")
+
+		if res.Code != 200 || res.Body.String() != "fallback" {
+			t.Errorf("expected the fallback to answer but got %d %s", res.Code, res.Body.String())
+		}
+	})
+
+	t.Run("fallbacks are guarded like the service", func(t *testing.T) {
+		subject.SetPolicyEngine(&denyingPolicies{})
+		defer subject.SetPolicyEngine(nil)
+
+		res := call("test")
+
+		if res.Code != http.StatusForbidden {
+			t.Errorf("expected the policy to deny the call but got %d %s", res.Code, res.Body.String())
+		}
+	})
+}
+
+func (s *staticFailover) Fallback(name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("fallback"))
+	})
+}
+
+func (d *denyingPolicies) Wrap(name string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	})
+}
@@ -0,0 +1,193 @@
+package ratelimit
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Meduzz/modulr/api"
+	"github.com/Meduzz/modulr/lib/router"
+)
+
+type (
+	rateLimiter struct {
+		limits  map[string]*api.RateLimit // service name -> limits
+		backend api.RateLimitBackend
+		lock    *sync.RWMutex
+	}
+)
+
+const (
+	// KeyService - one bucket for the whole service
+	KeyService = "service"
+	// KeyIP - a bucket per ip of the peer, forwarded headers can be spoofed and are ignored.
+	// Behind a load balancer, count by the header it puts the client ip in instead.
+	KeyIP = "ip"
+	// KeyAPIKey - a bucket per api key
+	KeyAPIKey = "apikey"
+	// KeyHeader - a bucket per value of a header
+	KeyHeader = "header"
+
+	// APIKeyHeader - where api keys are read from by default
+	APIKeyHeader = "X-Api-Key"
+)
+
+// NewRateLimiter - creates a new rate limiter without any limits, it needs a backend before it limits anything
+func NewRateLimiter() api.RateLimiter {
+	return &rateLimiter{
+		limits: make(map[string]*api.RateLimit),
+		lock:   &sync.RWMutex{},
+	}
+}
+
+// Wrap - backend errors are logged and let the request through
+func (r *rateLimiter) Wrap(name string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.lock.RLock()
+		limit, ok := r.limits[name]
+		backend := r.backend
+		r.lock.RUnlock()
+
+		if !ok || backend == nil {
+			handler.ServeHTTP(w, req)
+			return
+		}
+
+		for index, rule := range limit.Rules {
+			if !applies(req, rule) {
+				continue
+			}
+
+			key := fmt.Sprintf("%s/%d/%s", name, index, keyOf(req, rule))
+			allowed, wait, err := backend.Take(key, rule.Rate, burst(rule))
+
+			if err != nil {
+				log.Printf("Taking a token for %s threw error: %v\n", name, err)
+				continue
+			}
+
+			if !allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+		}
+
+		handler.ServeHTTP(w, req)
+	})
+}
+
+func (r *rateLimiter) Set(limit *api.RateLimit) error {
+	if limit.Service == "" {
+		return fmt.Errorf("rate limit is missing a service")
+	}
+
+	for _, rule := range limit.Rules {
+		if rule.Rate <= 0 {
+			return fmt.Errorf("rate limit for %s needs a rate above 0", limit.Service)
+		}
+
+		if rule.Burst < 0 {
+			return fmt.Errorf("rate limit for %s has a negative burst", limit.Service)
+		}
+
+		switch rule.Key {
+		case KeyService, KeyIP, KeyAPIKey, "":
+		case KeyHeader:
+			if rule.Header == "" {
+				return fmt.Errorf("rate limit for %s is keyed by header but has no header", limit.Service)
+			}
+		default:
+			return fmt.Errorf("rate limit for %s has an unknown key %s", limit.Service, rule.Key)
+		}
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.limits[limit.Service] = limit
+
+	return nil
+}
+
+func (r *rateLimiter) Remove(name string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	delete(r.limits, name)
+}
+
+func (r *rateLimiter) Limits() []*api.RateLimit {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	limits := make([]*api.RateLimit, 0, len(r.limits))
+
+	for _, it := range r.limits {
+		limits = append(limits, it)
+	}
+
+	sort.Slice(limits, func(i, j int) bool {
+		return limits[i].Service < limits[j].Service
+	})
+
+	return limits
+}
+
+func (r *rateLimiter) SetBackend(backend api.RateLimitBackend) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.backend = backend
+}
+
+// applies - rules with a route only count requests matched by that route
+func applies(req *http.Request, rule *api.RateLimitRule) bool {
+	if rule.Route == "" {
+		return true
+	}
+
+	match := router.MatchFrom(req.Context())
+
+	return match != nil && match.Route.Name == rule.Route
+}
+
+// keyOf - requests without the header share a bucket
+func keyOf(req *http.Request, rule *api.RateLimitRule) string {
+	switch rule.Key {
+	case KeyIP:
+		ip, _, err := net.SplitHostPort(strings.TrimSpace(req.RemoteAddr))
+
+		if err != nil {
+			return ""
+		}
+
+		return ip
+	case KeyAPIKey:
+		header := rule.Header
+
+		if header == "" {
+			header = APIKeyHeader
+		}
+
+		return req.Header.Get(header)
+	case KeyHeader:
+		return req.Header.Get(rule.Header)
+	}
+
+	return ""
+}
+
+func burst(rule *api.RateLimitRule) int {
+	if rule.Burst > 0 {
+		return rule.Burst
+	}
+
+	return int(math.Ceil(rule.Rate))
+}
@@ -0,0 +1,193 @@
+package ratelimit
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Meduzz/modulr/api"
+	"github.com/Meduzz/modulr/lib/router"
+)
+
+type (
+	// countingBackend - hands out burst tokens per key, and never refills
+	countingBackend struct {
+		taken map[string]int
+		fail  bool
+	}
+)
+
+func TestRateLimiter(t *testing.T) {
+	backend := &countingBackend{taken: make(map[string]int)}
+	subject := NewRateLimiter()
+
+	engine := subject.Wrap("test", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(200)
+	}))
+
+	call := func(header, value string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/call/test/", nil)
+
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+
+		res := httptest.NewRecorder()
+		engine.ServeHTTP(res, req)
+
+		return res
+	}
+
+	t.Run("without limits or backend", func(t *testing.T) {
+		for i := 0; i < 5; i++ {
+			if call("", "").Code != 200 {
+				t.Error("expected 200")
+			}
+		}
+	})
+
+	subject.SetBackend(backend)
+
+	t.Run("limited by service", func(t *testing.T) {
+		subject.Set(&api.RateLimit{Service: "test", Rules: []*api.RateLimitRule{{Rate: 1, Burst: 2}}})
+
+		codes := []int{call("", "").Code, call("", "").Code, call("", "").Code}
+
+		if codes[0] != 200 || codes[1] != 200 || codes[2] != 429 {
+			t.Errorf("expected 200, 200, 429 but got %v", codes)
+		}
+
+		if call("", "").Header().Get("Retry-After") != "1" {
+			t.Error("expected a Retry-After header")
+		}
+	})
+
+	t.Run("limited by api key", func(t *testing.T) {
+		subject.Set(&api.RateLimit{Service: "test", Rules: []*api.RateLimitRule{{Key: KeyAPIKey, Rate: 1}}})
+
+		if call(APIKeyHeader, "a").Code != 200 {
+			t.Error("expected the first call with key a to pass")
+		}
+
+		if call(APIKeyHeader, "a").Code != 429 {
+			t.Error("expected the second call with key a to be limited")
+		}
+
+		if call(APIKeyHeader, "b").Code != 200 {
+			t.Error("expected key b to have a bucket of its own")
+		}
+	})
+
+	t.Run("limited by header", func(t *testing.T) {
+		subject.Set(&api.RateLimit{Service: "test", Rules: []*api.RateLimitRule{{Key: KeyHeader, Header: "X-Tenant", Rate: 1}}})
+
+		call("X-Tenant", "c")
+
+		if call("X-Tenant", "c").Code != 429 {
+			t.Error("expected the second call for tenant c to be limited")
+		}
+
+		if call("X-Tenant", "d").Code != 200 {
+			t.Error("expected tenant d to have a bucket of its own")
+		}
+	})
+
+	t.Run("limited by ip", func(t *testing.T) {
+		subject.Set(&api.RateLimit{Service: "test", Rules: []*api.RateLimitRule{{Key: KeyIP, Rate: 1}}})
+		backend.taken = make(map[string]int)
+
+		if call("X-Forwarded-For", "198.51.100.1").Code != 200 {
+			t.Error("expected the first call to pass")
+		}
+
+		if call("X-Forwarded-For", "198.51.100.2").Code != 429 {
+			t.Error("expected a spoofed X-Forwarded-For to share the bucket of the peer")
+		}
+
+		backend.taken = make(map[string]int)
+	})
+
+	t.Run("limited by route", func(t *testing.T) {
+		subject.Set(&api.RateLimit{Service: "test", Rules: []*api.RateLimitRule{{Key: KeyIP, Route: "limited", Rate: 1}}})
+
+		limited := subject.Wrap("test", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(200)
+		}))
+		routed := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			route := &api.Route{Name: req.Header.Get("X-Route")}
+			limited.ServeHTTP(w, router.WithMatch(req, &api.Match{Route: route, Path: "/"}))
+		})
+
+		codes := make([]int, 0)
+
+		for _, route := range []string{"limited", "limited", "other", "other"} {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set("X-Route", route)
+			res := httptest.NewRecorder()
+			routed.ServeHTTP(res, req)
+
+			codes = append(codes, res.Code)
+		}
+
+		if fmt.Sprint(codes) != "[200 429 200 200]" {
+			t.Errorf("expected only the limited route to be limited but got %v", codes)
+		}
+	})
+
+	t.Run("backend errors let requests through", func(t *testing.T) {
+		subject.Set(&api.RateLimit{Service: "test", Rules: []*api.RateLimitRule{{Rate: 1}}})
+		backend.fail = true
+
+		for i := 0; i < 3; i++ {
+			if call("", "").Code != 200 {
+				t.Error("expected 200")
+			}
+		}
+
+		backend.fail = false
+	})
+
+	t.Run("removed limits", func(t *testing.T) {
+		subject.Remove("test")
+
+		if len(subject.Limits()) != 0 {
+			t.Error("the limits were not removed")
+		}
+
+		if call("", "").Code != 200 {
+			t.Error("expected 200")
+		}
+	})
+
+	t.Run("invalid limits", func(t *testing.T) {
+		invalid := []*api.RateLimit{
+			{Rules: []*api.RateLimitRule{{Rate: 1}}},
+			{Service: "test", Rules: []*api.RateLimitRule{{Rate: 0}}},
+			{Service: "test", Rules: []*api.RateLimitRule{{Rate: 1, Burst: -1}}},
+			{Service: "test", Rules: []*api.RateLimitRule{{Rate: 1, Key: "moon"}}},
+			{Service: "test", Rules: []*api.RateLimitRule{{Rate: 1, Key: KeyHeader}}},
+		}
+
+		for _, it := range invalid {
+			if subject.Set(it) == nil {
+				t.Errorf("expected an error for %+v", it.Rules[0])
+			}
+		}
+	})
+}
+
+func (c *countingBackend) Take(key string, rate float64, burst int) (bool, time.Duration, error) {
+	if c.fail {
+		return false, 0, fmt.Errorf("backend is down")
+	}
+
+	if c.taken[key] >= burst {
+		return false, 500 * time.Millisecond, nil
+	}
+
+	c.taken[key]++
+
+	return true, 0, nil
+}
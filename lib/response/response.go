@@ -0,0 +1,82 @@
+// Package response - what the handlers wrapping a service need of a http.ResponseWriter
+package response
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+type (
+	// Writer - passes the response on while remembering its status, flushing & hijacking still reach the writer it wraps
+	Writer struct {
+		http.ResponseWriter
+		status int
+	}
+)
+
+// NewWriter - wraps w, unless it already is a Writer
+func NewWriter(w http.ResponseWriter) *Writer {
+	it, ok := w.(*Writer)
+
+	if ok {
+		return it
+	}
+
+	return &Writer{ResponseWriter: w}
+}
+
+// Status - the status answered with, 200 until something else is written like net/http does
+func (w *Writer) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+
+	return w.status
+}
+
+// Written - has the status been written yet
+func (w *Writer) Written() bool {
+	return w.status != 0
+}
+
+func (w *Writer) WriteHeader(status int) {
+	// informational responses are followed by the real one
+	if w.status == 0 && status >= http.StatusOK {
+		w.status = status
+	}
+
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *Writer) Write(bs []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	return w.ResponseWriter.Write(bs)
+}
+
+func (w *Writer) Flush() {
+	flusher, ok := w.ResponseWriter.(http.Flusher)
+
+	if ok {
+		flusher.Flush()
+	}
+}
+
+func (w *Writer) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer can not be hijacked")
+	}
+
+	return hijacker.Hijack()
+}
+
+// Unwrap - for http.ResponseController
+func (w *Writer) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,45 @@
+package router
+
+import (
+	"net/http"
+
+	"github.com/Meduzz/modulr/api"
+	"github.com/gin-gonic/gin"
+)
+
+// Handler - gin handler that routes requests through the router to the proxy, 404s when no route matched
+func Handler(router api.Router, proxy api.Proxy) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		match := router.Match(ctx.Request)
+
+		if match == nil {
+			ctx.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+
+		ctx.Request = WithMatch(ctx.Request, match)
+
+		handler, err := proxy.ForwarderFor(match.Route.Service)
+
+		if err != nil {
+			ctx.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+
+		handler(ctx)
+	}
+}
+
+// HttpHandler - the net/http twin of Handler, for the standard mux, chi or any other router
+func HttpHandler(router api.Router, proxy api.Proxy) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		match := router.Match(req)
+
+		if match == nil {
+			http.NotFound(w, req)
+			return
+		}
+
+		proxy.HandlerFor(match.Route.Service).ServeHTTP(w, WithMatch(req, match))
+	})
+}
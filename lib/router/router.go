@@ -0,0 +1,321 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Meduzz/modulr/api"
+)
+
+type (
+	router struct {
+		routes []*compiled
+		lock   *sync.RWMutex
+	}
+
+	compiled struct {
+		route *api.Route
+		regex *regexp.Regexp
+	}
+
+	matchKey struct{}
+)
+
+// NewRouter - creates a new empty router
+func NewRouter() api.Router {
+	return &router{
+		routes: make([]*compiled, 0),
+		lock:   &sync.RWMutex{},
+	}
+}
+
+// LoadFile - replace the routes of the router with the routes in a json file
+func LoadFile(r api.Router, path string) error {
+	bs, err := os.ReadFile(path)
+
+	if err != nil {
+		return err
+	}
+
+	routes := make([]*api.Route, 0)
+	err = json.Unmarshal(bs, &routes)
+
+	if err != nil {
+		return err
+	}
+
+	return r.Load(routes)
+}
+
+// WithMatch - attach a match to the request
+func WithMatch(req *http.Request, match *api.Match) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), matchKey{}, match))
+}
+
+// MatchFrom - fetch the match attached to a request context, nil if none
+func MatchFrom(ctx context.Context) *api.Match {
+	match, ok := ctx.Value(matchKey{}).(*api.Match)
+
+	if !ok {
+		return nil
+	}
+
+	return match
+}
+
+// Path - the path to forward a request to a service with, relative to the service context.
+// Either what the route rewrote it to, or the path with /call/<name> removed.
+func Path(req *http.Request, name string) string {
+	match := MatchFrom(req.Context())
+
+	if match != nil {
+		return match.Path
+	}
+
+	return strings.Replace(req.URL.Path, fmt.Sprintf("/call/%s", name), "", 1)
+}
+
+func (r *router) Match(req *http.Request) *api.Match {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	for _, it := range r.routes {
+		path, ok := it.match(req)
+
+		if ok {
+			return &api.Match{
+				Route: it.route,
+				Path:  path,
+			}
+		}
+	}
+
+	return nil
+}
+
+func (r *router) Add(route *api.Route) error {
+	it, err := compile(route)
+
+	if err != nil {
+		return err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	keepers := make([]*compiled, 0, len(r.routes)+1)
+
+	for _, existing := range r.routes {
+		if existing.route.Name != route.Name {
+			keepers = append(keepers, existing)
+		}
+	}
+
+	r.routes = sorted(append(keepers, it))
+
+	return nil
+}
+
+func (r *router) Remove(name string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	keepers := make([]*compiled, 0, len(r.routes))
+
+	for _, existing := range r.routes {
+		if existing.route.Name != name {
+			keepers = append(keepers, existing)
+		}
+	}
+
+	if len(keepers) == len(r.routes) {
+		return fmt.Errorf("no route named %s", name)
+	}
+
+	r.routes = keepers
+
+	return nil
+}
+
+func (r *router) Routes() []*api.Route {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	routes := make([]*api.Route, 0, len(r.routes))
+
+	for _, it := range r.routes {
+		routes = append(routes, it.route)
+	}
+
+	return routes
+}
+
+func (r *router) Load(routes []*api.Route) error {
+	all := make([]*compiled, 0, len(routes))
+	names := make(map[string]bool)
+
+	for _, route := range routes {
+		if names[route.Name] {
+			return fmt.Errorf("route %s was declared twice", route.Name)
+		}
+
+		names[route.Name] = true
+
+		it, err := compile(route)
+
+		if err != nil {
+			return err
+		}
+
+		all = append(all, it)
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.routes = sorted(all)
+
+	return nil
+}
+
+func compile(route *api.Route) (*compiled, error) {
+	if route.Name == "" {
+		return nil, fmt.Errorf("route is missing a name")
+	}
+
+	if route.Service == "" {
+		return nil, fmt.Errorf("route %s is missing a service", route.Name)
+	}
+
+	it := &compiled{route: route}
+
+	if route.Regex != "" {
+		regex, err := regexp.Compile(route.Regex)
+
+		if err != nil {
+			return nil, fmt.Errorf("route %s has an invalid regex: %w", route.Name, err)
+		}
+
+		it.regex = regex
+	}
+
+	return it, nil
+}
+
+// sorted - highest priority first, then longest prefix, otherwise keep insertion order
+func sorted(routes []*compiled) []*compiled {
+	sort.SliceStable(routes, func(i, j int) bool {
+		if routes[i].route.Priority != routes[j].route.Priority {
+			return routes[i].route.Priority > routes[j].route.Priority
+		}
+
+		return len(routes[i].route.Prefix) > len(routes[j].route.Prefix)
+	})
+
+	return routes
+}
+
+// match - returns the path to forward and if the route matched the request
+func (c *compiled) match(req *http.Request) (string, bool) {
+	route := c.route
+
+	if route.Host != "" && !matchHost(route.Host, req.Host) {
+		return "", false
+	}
+
+	if len(route.Methods) > 0 && !matchMethod(route.Methods, req.Method) {
+		return "", false
+	}
+
+	for name, value := range route.Headers {
+		actual := req.Header.Get(name)
+
+		if actual == "" || (value != "" && actual != value) {
+			return "", false
+		}
+	}
+
+	path := req.URL.Path
+
+	if c.regex != nil {
+		if !c.regex.MatchString(path) {
+			return "", false
+		}
+
+		if route.Rewrite != "" {
+			return c.regex.ReplaceAllString(path, route.Rewrite), true
+		}
+
+		return path, true
+	}
+
+	if !matchPrefix(route.Prefix, path) {
+		return "", false
+	}
+
+	if route.Rewrite != "" {
+		return route.Rewrite + strings.TrimPrefix(path, route.Prefix), true
+	}
+
+	if route.StripPrefix {
+		stripped := strings.TrimPrefix(path, route.Prefix)
+
+		if !strings.HasPrefix(stripped, "/") {
+			stripped = "/" + stripped
+		}
+
+		return stripped, true
+	}
+
+	return path, true
+}
+
+// matchPrefix - prefixes only match on whole path segments, /api matches /api/users but not /apis
+func matchPrefix(prefix, path string) bool {
+	if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+
+	if prefix == "" || strings.HasSuffix(prefix, "/") || len(path) == len(prefix) {
+		return true
+	}
+
+	return path[len(prefix)] == '/'
+}
+
+func matchHost(pattern, host string) bool {
+	hostname, _, err := net.SplitHostPort(host)
+
+	if err == nil {
+		host = hostname
+	}
+
+	host = strings.ToLower(host)
+	pattern = strings.ToLower(pattern)
+
+	// *.example.com stands in for exactly one label, like it does in certificates
+	if strings.HasPrefix(pattern, "*.") {
+		label, ok := strings.CutSuffix(host, pattern[1:])
+		return ok && label != "" && !strings.Contains(label, ".")
+	}
+
+	return host == pattern
+}
+
+func matchMethod(methods []string, method string) bool {
+	for _, it := range methods {
+		if strings.EqualFold(it, method) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,185 @@
+package router
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Meduzz/modulr/api"
+)
+
+func TestRouter(t *testing.T) {
+	subject := NewRouter()
+
+	err := subject.Load([]*api.Route{
+		{Name: "users", Service: "users", Prefix: "/api/users", StripPrefix: true},
+		{Name: "api", Service: "api", Prefix: "/api"},
+		{Name: "admin", Service: "admin", Prefix: "/api", Priority: 10, Headers: map[string]string{"X-Admin": "true"}},
+		{Name: "orders", Service: "orders", Regex: "^/orders/([0-9]+)$", Rewrite: "/v2/orders/$1", Methods: []string{"GET"}},
+		{Name: "host", Service: "host", Host: "*.example.com", Prefix: "/", Rewrite: "/public/"},
+	})
+
+	if err != nil {
+		t.Errorf("There was an unexpected error: %v", err)
+	}
+
+	t.Run("longest prefix wins", func(t *testing.T) {
+		match := subject.Match(httptest.NewRequest("GET", "/api/users/1", nil))
+
+		if match == nil {
+			t.Fatal("match was nil")
+		}
+
+		if match.Route.Name != "users" {
+			t.Errorf("expected route users but was %s", match.Route.Name)
+		}
+
+		if match.Path != "/1" {
+			t.Errorf("expected path /1 but was %s", match.Path)
+		}
+	})
+
+	t.Run("prefix respects segments", func(t *testing.T) {
+		match := subject.Match(httptest.NewRequest("GET", "/apis", nil))
+
+		if match != nil {
+			t.Errorf("expected no match but got %s", match.Route.Name)
+		}
+	})
+
+	t.Run("priority and headers", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/users/1", nil)
+		req.Header.Set("X-Admin", "true")
+
+		match := subject.Match(req)
+
+		if match == nil {
+			t.Fatal("match was nil")
+		}
+
+		if match.Route.Name != "admin" {
+			t.Errorf("expected route admin but was %s", match.Route.Name)
+		}
+
+		if match.Path != "/api/users/1" {
+			t.Errorf("expected path to be untouched but was %s", match.Path)
+		}
+	})
+
+	t.Run("regex rewrite and method", func(t *testing.T) {
+		match := subject.Match(httptest.NewRequest("GET", "/orders/42", nil))
+
+		if match == nil {
+			t.Fatal("match was nil")
+		}
+
+		if match.Path != "/v2/orders/42" {
+			t.Errorf("expected path /v2/orders/42 but was %s", match.Path)
+		}
+
+		match = subject.Match(httptest.NewRequest("POST", "/orders/42", nil))
+
+		if match != nil {
+			t.Errorf("expected no match but got %s", match.Route.Name)
+		}
+	})
+
+	t.Run("wildcard host", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/index.html", nil)
+		req.Host = "www.example.com:8080"
+
+		match := subject.Match(req)
+
+		if match == nil {
+			t.Fatal("match was nil")
+		}
+
+		if match.Route.Name != "host" {
+			t.Errorf("expected route host but was %s", match.Route.Name)
+		}
+
+		if match.Path != "/public/index.html" {
+			t.Errorf("expected path /public/index.html but was %s", match.Path)
+		}
+	})
+
+	t.Run("wildcard host covers one label", func(t *testing.T) {
+		for _, host := range []string{"a.b.example.com", "example.com"} {
+			req := httptest.NewRequest("GET", "/index.html", nil)
+			req.Host = host
+
+			match := subject.Match(req)
+
+			if match != nil {
+				t.Errorf("expected no match for %s but got route %s", host, match.Route.Name)
+			}
+		}
+	})
+
+	t.Run("runtime updates", func(t *testing.T) {
+		err := subject.Add(&api.Route{Name: "api", Service: "api2", Prefix: "/api"})
+
+		if err != nil {
+			t.Errorf("There was an unexpected error: %v", err)
+		}
+
+		match := subject.Match(httptest.NewRequest("GET", "/api/other", nil))
+
+		if match == nil || match.Route.Service != "api2" {
+			t.Error("expected the replaced route to match")
+		}
+
+		err = subject.Remove("api")
+
+		if err != nil {
+			t.Errorf("There was an unexpected error: %v", err)
+		}
+
+		match = subject.Match(httptest.NewRequest("GET", "/api/other", nil))
+
+		if match != nil {
+			t.Errorf("expected no match but got %s", match.Route.Name)
+		}
+
+		err = subject.Remove("api")
+
+		if err == nil {
+			t.Error("expected an error")
+		}
+	})
+
+	t.Run("invalid routes", func(t *testing.T) {
+		err := subject.Add(&api.Route{Name: "broken", Service: "broken", Regex: "("})
+
+		if err == nil {
+			t.Error("expected an error")
+		}
+
+		err = subject.Add(&api.Route{Name: "nameless"})
+
+		if err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
+
+func TestLoadFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "routes.json")
+	err := os.WriteFile(file, []byte(`[{"name":"a","service":"a","prefix":"/a","stripPrefix":true}]`), 0644)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subject := NewRouter()
+	err = LoadFile(subject, file)
+
+	if err != nil {
+		t.Errorf("There was an unexpected error: %v", err)
+	}
+
+	if len(subject.Routes()) != 1 {
+		t.Errorf("expected 1 route but got %d", len(subject.Routes()))
+	}
+}
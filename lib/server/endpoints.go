@@ -0,0 +1,357 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Meduzz/modulr/api"
+	"github.com/Meduzz/modulr/lib/auth"
+	"github.com/Meduzz/modulr/lib/policy"
+	"github.com/Meduzz/modulr/lib/router"
+	"github.com/gin-gonic/gin"
+)
+
+type (
+	// Endpoints - the endpoints every modulr proxy needs: register, deregister, list & lookup, call, publish, request & health
+	Endpoints struct {
+		options  *Options
+		catalog  *catalog
+		draining int32
+	}
+
+	// Options - what the endpoints talk to, where they're mounted and what runs before them
+	Options struct {
+		Registry        api.ServiceRegistry // required
+		Proxy           api.Proxy           // required
+		Events          api.EventSupport    // publish & request are left out without it
+		Authenticator   api.Authenticator   // publishers authenticate with the AuthMethods, when there are any
+		AuthMethods     []string            // methods publishers may authenticate with
+		BasePath        string              // prefix of every endpoint, ie /modulr, defaults to none
+		CallPath        string              // where services are called, defaults to /call
+		MaxWait         time.Duration       // longest request/reply a caller may ask for, defaults to 30s
+		Middleware      []gin.HandlerFunc   // runs before every endpoint, ie logging
+		AdminMiddleware []gin.HandlerFunc   // runs before register, deregister, list & lookup, after Middleware. Ie to protect them.
+	}
+
+	// catalog - the names of the registered services, the registry only looks up by name
+	catalog struct {
+		names map[string]bool
+		lock  *sync.RWMutex
+	}
+)
+
+const (
+	defaultCallPath = "/call"
+	defaultMaxWait  = 30 * time.Second
+	// defaultWait - how long request/reply waits when the caller doesn't say
+	defaultWait = 5 * time.Second
+)
+
+// NewEndpoints - creates the endpoints, they see services registered from now on.
+// Create them before ServiceRegistry.Start to list the services it brings back.
+func NewEndpoints(options *Options) (*Endpoints, error) {
+	if options.Registry == nil || options.Proxy == nil {
+		return nil, fmt.Errorf("the endpoints need both a registry and a proxy")
+	}
+
+	e := &Endpoints{
+		options: options,
+		catalog: &catalog{
+			names: make(map[string]bool),
+			lock:  &sync.RWMutex{},
+		},
+	}
+
+	options.Registry.Plugin(e.catalog)
+
+	return e, nil
+}
+
+// Mount - add the endpoints to the routes
+func (e *Endpoints) Mount(routes gin.IRouter) {
+	group := routes.Group(strings.TrimSuffix(e.options.BasePath, "/"), e.options.Middleware...)
+	admin := group.Group("", e.options.AdminMiddleware...)
+
+	admin.POST("/register", e.register)
+	admin.DELETE("/deregister/:name/:id", e.deregister)
+	admin.GET("/services", e.list)
+	admin.GET("/services/:name", e.lookup)
+
+	callPath := e.options.CallPath
+
+	if callPath == "" {
+		callPath = defaultCallPath
+	}
+
+	group.Any(strings.TrimSuffix(callPath, "/")+"/:service/*path", e.call)
+	group.GET("/health", e.health)
+
+	if e.options.Events == nil {
+		return
+	}
+
+	publishers := &api.AuthRequirements{Methods: e.options.AuthMethods}
+
+	if e.options.Authenticator != nil {
+		authenticate := auth.Middleware(e.options.Authenticator, publishers)
+
+		group.POST("/publish", authenticate, e.publish)
+		group.POST("/request", authenticate, e.request)
+	} else {
+		group.POST("/publish", e.publish)
+		group.POST("/request", e.request)
+	}
+}
+
+// Drain - health answers 503 from now on, so that load balancers stop sending traffic our way. Meant for Server.OnShutdown.
+func (e *Endpoints) Drain() {
+	atomic.StoreInt32(&e.draining, 1)
+}
+
+func (e *Endpoints) register(ctx *gin.Context) {
+	service := &api.DefaultService{
+		Scheme: "http",
+	}
+
+	err := ctx.ShouldBindJSON(service)
+
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = validate(service)
+
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = e.options.Registry.Register(service)
+
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	log.Printf("service named %s, of type %s, was registered\n", service.GetName(), service.GetType())
+
+	ctx.Status(http.StatusOK)
+}
+
+func (e *Endpoints) deregister(ctx *gin.Context) {
+	name := ctx.Param("name")
+	id := ctx.Param("id")
+
+	service, err := e.options.Registry.Deregister(name, id)
+
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	if service == nil {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("no instance %s of service %s", id, name)})
+		return
+	}
+
+	ctx.Status(http.StatusOK)
+}
+
+func (e *Endpoints) list(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, e.catalog.list())
+}
+
+func (e *Endpoints) lookup(ctx *gin.Context) {
+	services, err := e.options.Registry.Lookup(ctx.Param("name"))
+
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	if services == nil {
+		services = make([]api.Service, 0)
+	}
+
+	ctx.JSON(http.StatusOK, services)
+}
+
+// call - the call path is matched like a route stripping <callPath>/<name>, so forwarders & policies see the path of the service
+func (e *Endpoints) call(ctx *gin.Context) {
+	name := ctx.Param("service")
+	handler, err := e.options.Proxy.ForwarderFor(name)
+
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	path := ctx.Param("path")
+	route := &api.Route{Service: name, Prefix: strings.TrimSuffix(ctx.Request.URL.Path, path), StripPrefix: true}
+	ctx.Request = router.WithMatch(ctx.Request, &api.Match{Route: route, Path: path})
+
+	handler(ctx)
+}
+
+func (e *Endpoints) publish(ctx *gin.Context) {
+	event, ok := bindEvent(ctx)
+
+	if !ok {
+		return
+	}
+
+	err := e.options.Events.Publish(event)
+
+	if errors.Is(err, policy.ErrDenied) {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	ctx.Status(http.StatusOK)
+}
+
+// request - request/reply over the event adapter, ?maxWait=<duration> says how long to wait for the reply
+func (e *Endpoints) request(ctx *gin.Context) {
+	wait := defaultWait
+	max := e.options.MaxWait
+
+	if max == 0 {
+		max = defaultMaxWait
+	}
+
+	if it := ctx.Query("maxWait"); it != "" {
+		var err error
+		wait, err = time.ParseDuration(it)
+
+		if err != nil || wait <= 0 || wait > max {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("maxWait must be a duration up to %s", max)})
+			return
+		}
+	}
+
+	event, ok := bindEvent(ctx)
+
+	if !ok {
+		return
+	}
+
+	reply, err := e.options.Events.Request(event, wait.String())
+
+	if errors.Is(err, policy.ErrDenied) {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadGateway, err)
+		return
+	}
+
+	ctx.Data(http.StatusOK, "application/json", reply)
+}
+
+func (e *Endpoints) health(ctx *gin.Context) {
+	if atomic.LoadInt32(&e.draining) == 1 {
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{"status": "draining"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"status": "up"})
+}
+
+// bindEvent - the publisher is the authenticated caller, never whatever the body says
+func bindEvent(ctx *gin.Context) (*api.Event, bool) {
+	event := &api.Event{}
+	err := ctx.ShouldBindJSON(event)
+
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	if event.Topic == "" {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "event is missing a topic"})
+		return nil, false
+	}
+
+	event.Publisher = auth.IdentityFrom(ctx.Request.Context())
+
+	return event, true
+}
+
+// validate - what the proxy needs of a service to find it, and route to it
+func validate(service *api.DefaultService) error {
+	if service.Name == "" || service.ID == "" || service.Type == "" {
+		return fmt.Errorf("service needs a name, an id and a type")
+	}
+
+	if strings.Contains(service.Name, "/") {
+		return fmt.Errorf("service name %s can not contain /", service.Name)
+	}
+
+	if service.Port < 0 || service.Port > 65535 {
+		return fmt.Errorf("service port %d is out of range", service.Port)
+	}
+
+	for _, it := range service.Subscriptions {
+		if it == nil || it.Topic == "" {
+			return fmt.Errorf("service subscriptions need a topic")
+		}
+	}
+
+	return nil
+}
+
+func (c *catalog) list() []string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	names := make([]string, 0, len(c.names))
+
+	for name := range c.names {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+func (c *catalog) RegisterService(service api.Service) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.names[service.GetName()] = true
+
+	return nil
+}
+
+func (c *catalog) DeregisterService(service api.Service) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	delete(c.names, service.GetName())
+
+	return nil
+}
+
+func (c *catalog) RegisterInstance(service api.Service) error {
+	return nil
+}
+
+func (c *catalog) DeregisterInstance(service api.Service) error {
+	return nil
+}
@@ -0,0 +1,252 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Meduzz/modulr/api"
+	"github.com/Meduzz/modulr/lib/policy"
+	"github.com/Meduzz/modulr/lib/router"
+	"github.com/gin-gonic/gin"
+)
+
+type (
+	fakeRegistry struct {
+		api.ServiceRegistry
+		services map[string][]api.Service
+		plugins  []api.Lifecycle
+	}
+
+	fakeProxy struct {
+		api.Proxy
+	}
+
+	fakeEvents struct {
+		api.EventSupport
+		published []*api.Event
+	}
+)
+
+func TestEndpoints(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registry := &fakeRegistry{services: make(map[string][]api.Service)}
+	events := &fakeEvents{}
+
+	subject, err := NewEndpoints(&Options{
+		Registry: registry,
+		Proxy:    &fakeProxy{},
+		Events:   events,
+		BasePath: "/modulr/",
+		CallPath: "/services/call",
+		AdminMiddleware: []gin.HandlerFunc{func(ctx *gin.Context) {
+			if ctx.GetHeader("X-Admin") != "yes" {
+				ctx.AbortWithStatus(http.StatusForbidden)
+			}
+		}},
+	})
+
+	if err != nil {
+		t.Fatalf("There was an unexpected error: %v", err)
+	}
+
+	engine := gin.New()
+	subject.Mount(engine)
+
+	call := func(method, path, body string, admin bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+
+		if admin {
+			req.Header.Set("X-Admin", "yes")
+		}
+
+		res := httptest.NewRecorder()
+		engine.ServeHTTP(res, req)
+
+		return res
+	}
+
+	t.Run("register", func(t *testing.T) {
+		if call("POST", "/modulr/register", `{"id":"1","name":"test","type":"http"}`, false).Code != 403 {
+			t.Error("expected the admin middleware to run")
+		}
+
+		invalid := []string{
+			`not json`,
+			`{"id":"1","type":"http"}`,
+			`{"id":"1","name":"te/st","type":"http"}`,
+			`{"id":"1","name":"test","type":"http","port":70000}`,
+		}
+
+		for _, it := range invalid {
+			res := call("POST", "/modulr/register", it, true)
+
+			if res.Code != 400 || !strings.Contains(res.Body.String(), "error") {
+				t.Errorf("expected 400 for %s but got %d", it, res.Code)
+			}
+		}
+
+		res := call("POST", "/modulr/register", `{"id":"1","name":"test","type":"http","address":"localhost","port":8080}`, true)
+
+		if res.Code != 200 {
+			t.Errorf("expected 200 but got %d", res.Code)
+		}
+
+		if registry.services["test"][0].GetScheme() != "http" {
+			t.Error("expected the scheme to default to http")
+		}
+	})
+
+	t.Run("list & lookup", func(t *testing.T) {
+		res := call("GET", "/modulr/services", "", true)
+
+		if res.Body.String() != `["test"]` {
+			t.Errorf("expected the test service to be listed but got %s", res.Body.String())
+		}
+
+		res = call("GET", "/modulr/services/test", "", true)
+
+		if !strings.Contains(res.Body.String(), `"address":"localhost"`) {
+			t.Errorf("expected the instance but got %s", res.Body.String())
+		}
+
+		res = call("GET", "/modulr/services/unknown", "", true)
+
+		if res.Body.String() != `[]` {
+			t.Errorf("expected no instances but got %s", res.Body.String())
+		}
+	})
+
+	t.Run("call", func(t *testing.T) {
+		res := call("GET", "/modulr/services/call/test/things", "", false)
+
+		if res.Body.String() != "test /things" {
+			t.Errorf("unexpected body %s", res.Body.String())
+		}
+	})
+
+	t.Run("publish", func(t *testing.T) {
+		if call("POST", "/modulr/publish", `{"body":{}}`, false).Code != 400 {
+			t.Error("expected an event without topic to be refused")
+		}
+
+		res := call("POST", "/modulr/publish", `{"topic":"orders","body":{"id":1}}`, false)
+
+		if res.Code != 200 || len(events.published) != 1 || events.published[0].Topic != "orders" {
+			t.Errorf("expected the event to be published but got %d", res.Code)
+		}
+
+		if call("POST", "/modulr/publish", `{"topic":"secret","body":{}}`, false).Code != 403 {
+			t.Error("expected a denied publish to be forbidden")
+		}
+	})
+
+	t.Run("request", func(t *testing.T) {
+		res := call("POST", "/modulr/request?maxWait=1s", `{"topic":"orders","body":{"id":1}}`, false)
+
+		if res.Code != 200 || res.Body.String() != `{"reply":"orders 1s"}` {
+			t.Errorf("unexpected reply %d %s", res.Code, res.Body.String())
+		}
+
+		if call("POST", "/modulr/request?maxWait=1h", `{"topic":"orders","body":{}}`, false).Code != 400 {
+			t.Error("expected a too long maxWait to be refused")
+		}
+
+		if call("POST", "/modulr/request", `{"topic":"secret","body":{}}`, false).Code != 403 {
+			t.Error("expected a denied request to be forbidden")
+		}
+	})
+
+	t.Run("deregister", func(t *testing.T) {
+		if call("DELETE", "/modulr/deregister/test/2", "", true).Code != 404 {
+			t.Error("expected 404 for an unknown instance")
+		}
+
+		if call("DELETE", "/modulr/deregister/test/1", "", true).Code != 200 {
+			t.Error("expected the instance to be deregistered")
+		}
+
+		res := call("GET", "/modulr/services", "", true)
+
+		if res.Body.String() != `[]` {
+			t.Errorf("expected no services but got %s", res.Body.String())
+		}
+	})
+
+	t.Run("health", func(t *testing.T) {
+		if call("GET", "/modulr/health", "", false).Code != 200 {
+			t.Error("expected to be healthy")
+		}
+
+		subject.Drain()
+
+		if call("GET", "/modulr/health", "", false).Code != 503 {
+			t.Error("expected to be draining")
+		}
+	})
+}
+
+func (f *fakeRegistry) Register(service api.Service) error {
+	if len(f.services[service.GetName()]) == 0 {
+		for _, it := range f.plugins {
+			it.RegisterService(service)
+		}
+	}
+
+	f.services[service.GetName()] = append(f.services[service.GetName()], service)
+
+	return nil
+}
+
+func (f *fakeRegistry) Deregister(name, id string) (api.Service, error) {
+	for i, it := range f.services[name] {
+		if it.GetID() == id {
+			f.services[name] = append(f.services[name][:i], f.services[name][i+1:]...)
+
+			if len(f.services[name]) == 0 {
+				for _, plugin := range f.plugins {
+					plugin.DeregisterService(it)
+				}
+			}
+
+			return it, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (f *fakeRegistry) Lookup(name string) ([]api.Service, error) {
+	return f.services[name], nil
+}
+
+func (f *fakeRegistry) Plugin(lifecycle api.Lifecycle) {
+	f.plugins = append(f.plugins, lifecycle)
+}
+
+func (f *fakeProxy) ForwarderFor(name string) (gin.HandlerFunc, error) {
+	return func(ctx *gin.Context) {
+		ctx.String(200, "%s %s", name, router.Path(ctx.Request, name))
+	}, nil
+}
+
+func (f *fakeEvents) Publish(event *api.Event) error {
+	if event.Topic == "secret" {
+		return fmt.Errorf("%w: secret", policy.ErrDenied)
+	}
+
+	f.published = append(f.published, event)
+
+	return nil
+}
+
+func (f *fakeEvents) Request(event *api.Event, maxWait string) ([]byte, error) {
+	if event.Topic == "secret" {
+		return nil, fmt.Errorf("%w: secret", policy.ErrDenied)
+	}
+
+	return []byte(fmt.Sprintf(`{"reply":"%s %s"}`, event.Topic, maxWait)), nil
+}
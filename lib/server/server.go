@@ -0,0 +1,275 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+type (
+	// Server - serves a handler over http, https or both
+	Server struct {
+		config  *Config
+		handler http.Handler
+		tls     *tlsConfig
+		servers []*http.Server
+		hooks   []func()
+		drain   time.Duration
+		lock    *sync.Mutex
+	}
+
+	// Config - where and how to listen
+	Config struct {
+		Addr         string         `json:"addr,omitempty"`         // address to serve http on, ie :8080
+		TLSAddr      string         `json:"tlsAddr,omitempty"`      // address to serve https on, ie :8443
+		Certificates []*Certificate `json:"certificates,omitempty"` // certificates to pick from by server name, the first one is the default
+		ClientCA     string         `json:"clientCa,omitempty"`     // pem bundle of CAs that client certificates must be issued by
+		ClientAuth   string         `json:"clientAuth,omitempty"`   // none (default), optional or require
+		DrainDelay   string         `json:"drainDelay,omitempty"`   // keep serving this long once shutdown begins, so load balancers notice, ie 5s
+	}
+
+	// Certificate - a certificate & key on disk, reloaded when they change
+	Certificate struct {
+		Cert  string   `json:"cert"`
+		Key   string   `json:"key"`
+		Hosts []string `json:"hosts,omitempty"` // server names to serve it for, defaults to the names in the certificate
+	}
+)
+
+// NewServer - creates a server for the handler, failing if the certificates can't be loaded
+func NewServer(config *Config, handler http.Handler) (*Server, error) {
+	if config.Addr == "" && config.TLSAddr == "" {
+		return nil, fmt.Errorf("the server needs an addr, a tlsAddr or both")
+	}
+
+	s := &Server{
+		config:  config,
+		handler: handler,
+		servers: make([]*http.Server, 0),
+		hooks:   make([]func(), 0),
+		lock:    &sync.Mutex{},
+	}
+
+	if config.DrainDelay != "" {
+		drain, err := time.ParseDuration(config.DrainDelay)
+
+		if err != nil {
+			return nil, err
+		}
+
+		s.drain = drain
+	}
+
+	if config.TLSAddr != "" {
+		tls, err := newTLSConfig(config)
+
+		if err != nil {
+			return nil, err
+		}
+
+		s.tls = tls
+	}
+
+	return s, nil
+}
+
+// LoadFile - creates a server for the handler from a json config file
+func LoadFile(path string, handler http.Handler) (*Server, error) {
+	bs, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	config := &Config{}
+	err = json.Unmarshal(bs, config)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return NewServer(config, handler)
+}
+
+// Start - listen on the configured addresses and serve until Shutdown is called or serving fails
+func (s *Server) Start() error {
+	listeners, err := s.listen()
+
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(listeners...)
+}
+
+// Serve - serve on listeners that are already open, wrap them with TLSListener for https
+func (s *Server) Serve(listeners ...net.Listener) error {
+	return s.wait(s.serve(listeners), len(listeners))
+}
+
+// TLSListener - wraps a listener so that it terminates tls the way the server is configured to
+func (s *Server) TLSListener(listener net.Listener) (net.Listener, error) {
+	if s.tls == nil {
+		return nil, fmt.Errorf("the server has no tlsAddr configured")
+	}
+
+	return s.tls.listener(listener), nil
+}
+
+// Run - start the server and shut it down gracefully on SIGINT or SIGTERM, giving open connections grace to finish
+func (s *Server) Run(grace time.Duration) error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	listeners, err := s.listen()
+
+	if err != nil {
+		return err
+	}
+
+	// the servers are known before any signal is looked at, so that shutdown always reaches them
+	served := s.serve(listeners)
+	errs := make(chan error, 1)
+
+	go func() {
+		errs <- s.wait(served, len(listeners))
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case it := <-signals:
+		log.Printf("Shutting down on %s\n", it)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.drain+grace)
+	defer cancel()
+
+	err = s.Shutdown(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	return <-errs
+}
+
+// OnShutdown - run the hook when shutdown begins, before connections are closed
+func (s *Server) OnShutdown(hook func()) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.hooks = append(s.hooks, hook)
+}
+
+// Shutdown - run the hooks, keep serving for the drain delay, then stop accepting connections
+// and wait for the open ones to finish, or for the context to end
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.lock.Lock()
+	servers := s.servers
+	hooks := s.hooks
+	s.servers = make([]*http.Server, 0)
+	s.lock.Unlock()
+
+	for _, hook := range hooks {
+		hook()
+	}
+
+	if s.drain > 0 && len(servers) > 0 {
+		timer := time.NewTimer(s.drain)
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+		}
+	}
+
+	var err error
+
+	for _, srv := range servers {
+		it := srv.Shutdown(ctx)
+
+		if it != nil && err == nil {
+			err = it
+		}
+	}
+
+	return err
+}
+
+// listen - open the configured addresses
+func (s *Server) listen() ([]net.Listener, error) {
+	listeners := make([]net.Listener, 0)
+
+	if s.config.Addr != "" {
+		listener, err := net.Listen("tcp", s.config.Addr)
+
+		if err != nil {
+			return nil, err
+		}
+
+		listeners = append(listeners, listener)
+	}
+
+	if s.config.TLSAddr != "" {
+		listener, err := net.Listen("tcp", s.config.TLSAddr)
+
+		if err != nil {
+			for _, it := range listeners {
+				it.Close()
+			}
+
+			return nil, err
+		}
+
+		listeners = append(listeners, s.tls.listener(listener))
+	}
+
+	return listeners, nil
+}
+
+// serve - register a server per listener and start serving, every server reports on the channel when it stops
+func (s *Server) serve(listeners []net.Listener) chan error {
+	errs := make(chan error, len(listeners))
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, listener := range listeners {
+		srv := &http.Server{Handler: s.handler}
+		s.servers = append(s.servers, srv)
+
+		go func(listener net.Listener) {
+			errs <- srv.Serve(listener)
+		}(listener)
+	}
+
+	return errs
+}
+
+// wait - wait for every server to stop, the first one failing stops the others
+func (s *Server) wait(errs chan error, count int) error {
+	var err error
+
+	for i := 0; i < count; i++ {
+		it := <-errs
+
+		if !errors.Is(it, http.ErrServerClosed) && err == nil {
+			err = it
+			go s.Shutdown(context.Background())
+		}
+	}
+
+	return err
+}
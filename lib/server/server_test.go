@@ -0,0 +1,320 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Meduzz/modulr/internal/testca"
+)
+
+func TestNewServer(t *testing.T) {
+	dir := t.TempDir()
+	ca := testca.New(t)
+	cert, key := ca.Files(t, dir, "a.example.com", false)
+
+	invalid := []*Config{
+		{},
+		{TLSAddr: ":0"},
+		{Addr: ":0", DrainDelay: "soon"},
+		{TLSAddr: ":0", Certificates: []*Certificate{{Cert: filepath.Join(dir, "missing.pem"), Key: key}}},
+		{TLSAddr: ":0", Certificates: []*Certificate{{Cert: cert, Key: key}}, ClientAuth: "maybe"},
+		{TLSAddr: ":0", Certificates: []*Certificate{{Cert: cert, Key: key}}, ClientAuth: ClientAuthRequire},
+	}
+
+	for _, it := range invalid {
+		_, err := NewServer(it, http.NotFoundHandler())
+
+		if err == nil {
+			t.Errorf("expected an error for %+v", it)
+		}
+	}
+}
+
+func TestTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := testca.New(t)
+	certA, keyA := ca.Files(t, dir, "a.example.com", false)
+	certB, keyB := ca.Files(t, dir, "b.example.com", false)
+
+	config := &Config{
+		TLSAddr: "127.0.0.1:0",
+		Certificates: []*Certificate{
+			{Cert: certA, Key: keyA},
+			{Cert: certB, Key: keyB, Hosts: []string{"*.b.example.com"}},
+		},
+	}
+
+	subject, err := NewServer(config, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(req.Proto))
+	}))
+
+	if err != nil {
+		t.Fatalf("There was an unexpected error: %v", err)
+	}
+
+	addr := serve(t, subject)
+
+	t.Run("certificates are picked by server name", func(t *testing.T) {
+		names := map[string]string{
+			"a.example.com":       "a.example.com",
+			"api.b.example.com":   "b.example.com",
+			"x.api.b.example.com": "a.example.com", // the wildcard covers a single label
+			"b.example.com":       "a.example.com", // b is only served for the hosts it was given
+			"c.example.com":       "a.example.com",
+		}
+
+		for name, expected := range names {
+			state, err := handshake(addr, &tls.Config{ServerName: name, RootCAs: ca.Pool(), InsecureSkipVerify: true})
+
+			if err != nil {
+				t.Fatalf("There was an unexpected error: %v", err)
+			}
+
+			if state.PeerCertificates[0].Subject.CommonName != expected {
+				t.Errorf("expected %s for %s but got %s", expected, name, state.PeerCertificates[0].Subject.CommonName)
+			}
+		}
+	})
+
+	t.Run("http/2 is negotiated", func(t *testing.T) {
+		client := &http.Client{Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{ServerName: "a.example.com", RootCAs: ca.Pool()},
+			ForceAttemptHTTP2: true,
+		}}
+
+		res, err := client.Get("https://" + addr + "/")
+
+		if err != nil {
+			t.Fatalf("There was an unexpected error: %v", err)
+		}
+
+		defer res.Body.Close()
+
+		if res.ProtoMajor != 2 {
+			t.Errorf("expected http/2 but got %s", res.Proto)
+		}
+	})
+
+	t.Run("certificates are reloaded", func(t *testing.T) {
+		other := testca.New(t)
+		cert, key := other.Issue(t, "a.example.com", false)
+		rewrite(t, certA, cert)
+		rewrite(t, keyA, key)
+
+		_, err := handshake(addr, &tls.Config{ServerName: "a.example.com", RootCAs: other.Pool()})
+
+		if err != nil {
+			t.Errorf("There was an unexpected error: %v", err)
+		}
+	})
+}
+
+func TestClientAuth(t *testing.T) {
+	dir := t.TempDir()
+	ca := testca.New(t)
+	cert, key := ca.Files(t, dir, "localhost", false)
+	caFile := filepath.Join(dir, "ca.pem")
+	os.WriteFile(caFile, ca.PEM, 0600)
+
+	clientCert, clientKey := ca.Issue(t, "client", true)
+	client, _ := tls.X509KeyPair(clientCert, clientKey)
+
+	other := testca.New(t)
+	otherCert, otherKey := other.Issue(t, "other", true)
+	stranger, _ := tls.X509KeyPair(otherCert, otherKey)
+
+	for _, mode := range []string{ClientAuthOptional, ClientAuthRequire} {
+		t.Run(mode, func(t *testing.T) {
+			subject, err := NewServer(&Config{
+				TLSAddr:      "127.0.0.1:0",
+				Certificates: []*Certificate{{Cert: cert, Key: key}},
+				ClientCA:     caFile,
+				ClientAuth:   mode,
+			}, http.NotFoundHandler())
+
+			if err != nil {
+				t.Fatalf("There was an unexpected error: %v", err)
+			}
+
+			addr := serve(t, subject)
+
+			_, err = get(addr, ca, &client)
+
+			if err != nil {
+				t.Errorf("There was an unexpected error: %v", err)
+			}
+
+			_, err = get(addr, ca, &stranger)
+
+			if err == nil {
+				t.Error("expected certificates from other CAs to be rejected")
+			}
+
+			_, err = get(addr, ca, nil)
+
+			if mode == ClientAuthRequire && err == nil {
+				t.Error("expected a certificate to be required")
+			}
+
+			if mode == ClientAuthOptional && err != nil {
+				t.Errorf("There was an unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	subject, err := NewServer(&Config{Addr: "127.0.0.1:0"}, http.NotFoundHandler())
+
+	if err != nil {
+		t.Fatalf("There was an unexpected error: %v", err)
+	}
+
+	hooked := false
+	subject.OnShutdown(func() {
+		hooked = true
+	})
+
+	done := make(chan error)
+
+	go func() {
+		done <- subject.Start()
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	subject.Shutdown(context.Background())
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("There was an unexpected error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("the server never stopped")
+	}
+
+	if !hooked {
+		t.Error("expected the shutdown hook to run")
+	}
+}
+
+func TestDrainDelay(t *testing.T) {
+	subject, err := NewServer(&Config{Addr: "127.0.0.1:0", DrainDelay: "200ms"}, http.NotFoundHandler())
+
+	if err != nil {
+		t.Fatalf("There was an unexpected error: %v", err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go subject.Serve(listener)
+	time.Sleep(20 * time.Millisecond)
+
+	done := make(chan error)
+
+	go func() {
+		done <- subject.Shutdown(context.Background())
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	res, err := client.Get("http://" + listener.Addr().String() + "/")
+
+	if err != nil {
+		t.Fatalf("expected requests to be served while draining but got %v", err)
+	}
+
+	res.Body.Close()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("the server never stopped")
+	}
+
+	_, err = client.Get("http://" + listener.Addr().String() + "/")
+
+	if err == nil {
+		t.Error("expected the server to be closed after draining")
+	}
+}
+
+// serve - serve tls on a random port, returning its address
+func serve(t *testing.T, subject *Server) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wrapped, err := subject.TLSListener(listener)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go subject.Serve(wrapped)
+	t.Cleanup(func() { subject.Shutdown(context.Background()) })
+
+	return listener.Addr().String()
+}
+
+func handshake(addr string, config *tls.Config) (tls.ConnectionState, error) {
+	conn, err := tls.Dial("tcp", addr, config)
+
+	if err != nil {
+		return tls.ConnectionState{}, err
+	}
+
+	defer conn.Close()
+
+	return conn.ConnectionState(), nil
+}
+
+// get - a request with a fresh connection, so that the handshake is done every time
+func get(addr string, ca *testca.Authority, cert *tls.Certificate) (*http.Response, error) {
+	config := &tls.Config{ServerName: "localhost", RootCAs: ca.Pool()}
+
+	if cert != nil {
+		config.Certificates = []tls.Certificate{*cert}
+	}
+
+	transport := &http.Transport{TLSClientConfig: config, DisableKeepAlives: true}
+	res, err := (&http.Client{Transport: transport}).Get("https://" + addr + "/")
+
+	if err != nil {
+		return nil, err
+	}
+
+	res.Body.Close()
+
+	return res, nil
+}
+
+// rewrite - replace a file, making sure its modification time moves forward
+func rewrite(t *testing.T, path string, bs []byte) {
+	info, err := os.Stat(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(path, bs, 0600)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	modified := info.ModTime().Add(time.Second)
+	os.Chtimes(path, modified, modified)
+}
@@ -0,0 +1,156 @@
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/Meduzz/modulr/lib/certs"
+)
+
+type (
+	tlsConfig struct {
+		pairs      []*pair
+		clientCA   *certs.Pool
+		clientAuth tls.ClientAuthType
+	}
+
+	pair struct {
+		keyPair *certs.KeyPair
+		hosts   []string
+	}
+)
+
+const (
+	// ClientAuthNone - client certificates are not asked for
+	ClientAuthNone = "none"
+	// ClientAuthOptional - client certificates are verified when they are presented
+	ClientAuthOptional = "optional"
+	// ClientAuthRequire - clients must present a valid certificate
+	ClientAuthRequire = "require"
+)
+
+func newTLSConfig(config *Config) (*tlsConfig, error) {
+	if len(config.Certificates) == 0 {
+		return nil, fmt.Errorf("serving tls needs at least one certificate")
+	}
+
+	t := &tlsConfig{
+		pairs:      make([]*pair, 0, len(config.Certificates)),
+		clientAuth: tls.NoClientCert,
+	}
+
+	for _, it := range config.Certificates {
+		keyPair, err := certs.LoadKeyPair(it.Cert, it.Key)
+
+		if err != nil {
+			return nil, err
+		}
+
+		t.pairs = append(t.pairs, &pair{keyPair, it.Hosts})
+	}
+
+	switch config.ClientAuth {
+	case ClientAuthNone, "":
+	case ClientAuthOptional:
+		t.clientAuth = tls.VerifyClientCertIfGiven
+	case ClientAuthRequire:
+		t.clientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("unknown client auth %s", config.ClientAuth)
+	}
+
+	if t.clientAuth != tls.NoClientCert {
+		if config.ClientCA == "" {
+			return nil, fmt.Errorf("client auth needs a clientCa")
+		}
+
+		pool, err := certs.LoadPool(config.ClientCA)
+
+		if err != nil {
+			return nil, err
+		}
+
+		t.clientCA = pool
+	}
+
+	return t, nil
+}
+
+func (t *tlsConfig) listener(listener net.Listener) net.Listener {
+	return tls.NewListener(listener, &tls.Config{
+		GetConfigForClient: t.configFor,
+	})
+}
+
+// configFor - a config per handshake, so that reloaded client CAs are picked up
+func (t *tlsConfig) configFor(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+	config := &tls.Config{
+		GetCertificate: t.certificate,
+		NextProtos:     []string{"h2", "http/1.1"},
+		ClientAuth:     t.clientAuth,
+	}
+
+	if t.clientCA != nil {
+		pool, err := t.clientCA.Pool()
+
+		if err != nil {
+			return nil, err
+		}
+
+		config.ClientCAs = pool
+	}
+
+	return config, nil
+}
+
+// certificate - pick a certificate by server name, falling back to the first one
+func (t *tlsConfig) certificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	var fallback *tls.Certificate
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+
+	for _, it := range t.pairs {
+		cert, err := it.keyPair.Certificate()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if fallback == nil {
+			fallback = cert
+		}
+
+		if name == "" {
+			break
+		}
+
+		if len(it.hosts) == 0 {
+			if cert.Leaf.VerifyHostname(name) == nil {
+				return cert, nil
+			}
+
+			continue
+		}
+
+		for _, host := range it.hosts {
+			if matches(host, name) {
+				return cert, nil
+			}
+		}
+	}
+
+	return fallback, nil
+}
+
+// matches - hosts may be a name or a wildcard like *.example.com, that stands in for exactly one label
+func matches(host, name string) bool {
+	host = strings.ToLower(host)
+
+	if strings.HasPrefix(host, "*.") {
+		label, ok := strings.CutSuffix(name, host[1:])
+		return ok && label != "" && !strings.Contains(label, ".")
+	}
+
+	return host == name
+}
@@ -0,0 +1,197 @@
+package split
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/Meduzz/modulr/api"
+)
+
+type (
+	splitter struct {
+		splits map[string]*api.Split // service name -> split
+		lock   *sync.RWMutex
+	}
+)
+
+// NewTrafficSplitter - creates a new in memory traffic splitter without any splits
+func NewTrafficSplitter() api.TrafficSplitter {
+	return &splitter{
+		splits: make(map[string]*api.Split),
+		lock:   &sync.RWMutex{},
+	}
+}
+
+// Split - services without a split, or splits that point to a version without instances, get the whole pool
+func (s *splitter) Split(req *http.Request, pool []api.Service) []api.Service {
+	if len(pool) == 0 {
+		return pool
+	}
+
+	s.lock.RLock()
+	split, ok := s.splits[pool[0].GetName()]
+	s.lock.RUnlock()
+
+	if !ok {
+		return pool
+	}
+
+	version := pick(req, split)
+
+	if version == "" {
+		return pool
+	}
+
+	narrowed := make([]api.Service, 0, len(pool))
+
+	for _, it := range pool {
+		if it.GetVersion() == version {
+			narrowed = append(narrowed, it)
+		}
+	}
+
+	if len(narrowed) == 0 {
+		return pool
+	}
+
+	return narrowed
+}
+
+func (s *splitter) Set(split *api.Split) error {
+	if split.Service == "" {
+		return fmt.Errorf("split is missing a service")
+	}
+
+	for version, weight := range split.Weights {
+		if weight < 0 {
+			return fmt.Errorf("split for %s has a negative weight for version %s", split.Service, version)
+		}
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.splits[split.Service] = split
+
+	return nil
+}
+
+func (s *splitter) Remove(name string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.splits, name)
+}
+
+func (s *splitter) Splits() []*api.Split {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	splits := make([]*api.Split, 0, len(s.splits))
+
+	for _, it := range s.splits {
+		splits = append(splits, it)
+	}
+
+	sort.Slice(splits, func(i, j int) bool {
+		return splits[i].Service < splits[j].Service
+	})
+
+	return splits
+}
+
+// pick - find the version for the request, empty when there's no opinion
+func pick(req *http.Request, split *api.Split) string {
+	for _, rule := range split.Rules {
+		if matches(req, rule) {
+			return rule.Version
+		}
+	}
+
+	versions := make([]string, 0, len(split.Weights))
+	total := 0
+
+	for version, weight := range split.Weights {
+		if weight > 0 {
+			versions = append(versions, version)
+			total += weight
+		}
+	}
+
+	if total == 0 {
+		return ""
+	}
+
+	// the same client always lands in the same bucket as long as the weights stay the same
+	sort.Strings(versions)
+	bucket := int(hash(split.Service, clientKey(req, split.Sticky)) % uint32(total))
+
+	for _, version := range versions {
+		bucket -= split.Weights[version]
+
+		if bucket < 0 {
+			return version
+		}
+	}
+
+	return ""
+}
+
+func matches(req *http.Request, rule *api.SplitRule) bool {
+	value := ""
+
+	if rule.Header != "" {
+		value = req.Header.Get(rule.Header)
+	} else if rule.Cookie != "" {
+		cookie, err := req.Cookie(rule.Cookie)
+
+		if err == nil {
+			value = cookie.Value
+		}
+	}
+
+	if value == "" {
+		return false
+	}
+
+	return rule.Value == "" || rule.Value == value
+}
+
+// clientKey - the sticky header or cookie, falling back to the client ip
+func clientKey(req *http.Request, sticky string) string {
+	if sticky != "" {
+		value := req.Header.Get(sticky)
+
+		if value != "" {
+			return value
+		}
+
+		cookie, err := req.Cookie(sticky)
+
+		if err == nil && cookie.Value != "" {
+			return cookie.Value
+		}
+	}
+
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+
+	if err != nil {
+		return req.RemoteAddr
+	}
+
+	return host
+}
+
+func hash(parts ...string) uint32 {
+	h := fnv.New32a()
+
+	for _, it := range parts {
+		h.Write([]byte(it))
+	}
+
+	return h.Sum32()
+}
@@ -0,0 +1,124 @@
+package split
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Meduzz/modulr/api"
+)
+
+func TestSplitter(t *testing.T) {
+	subject := NewTrafficSplitter()
+
+	pool := []api.Service{
+		&api.DefaultService{ID: "1", Name: "test", Version: "v1"},
+		&api.DefaultService{ID: "2", Name: "test", Version: "v1"},
+		&api.DefaultService{ID: "3", Name: "test", Version: "v2"},
+	}
+
+	t.Run("without split", func(t *testing.T) {
+		result := subject.Split(httptest.NewRequest("GET", "/", nil), pool)
+
+		if len(result) != 3 {
+			t.Errorf("expected the whole pool but got %d", len(result))
+		}
+	})
+
+	err := subject.Set(&api.Split{
+		Service: "test",
+		Rules: []*api.SplitRule{
+			{Header: "X-Canary", Value: "true", Version: "v2"},
+			{Cookie: "beta", Version: "v2"},
+		},
+		Weights: map[string]int{"v1": 90, "v2": 10},
+		Sticky:  "X-User",
+	})
+
+	if err != nil {
+		t.Errorf("There was an unexpected error: %v", err)
+	}
+
+	t.Run("header rule", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-Canary", "true")
+
+		result := subject.Split(req, pool)
+
+		if len(result) != 1 || result[0].GetVersion() != "v2" {
+			t.Error("expected only v2")
+		}
+	})
+
+	t.Run("cookie rule", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.AddCookie(&http.Cookie{Name: "beta", Value: "yes"})
+
+		result := subject.Split(req, pool)
+
+		if len(result) != 1 || result[0].GetVersion() != "v2" {
+			t.Error("expected only v2")
+		}
+	})
+
+	t.Run("weights are sticky and roughly right", func(t *testing.T) {
+		v2 := 0
+
+		for i := 0; i < 1000; i++ {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set("X-User", fmt.Sprintf("user-%d", i))
+
+			first := subject.Split(req, pool)
+			second := subject.Split(req, pool)
+
+			if first[0].GetVersion() != second[0].GetVersion() {
+				t.Fatalf("user-%d was not sticky", i)
+			}
+
+			if first[0].GetVersion() == "v2" {
+				v2++
+			}
+		}
+
+		if v2 < 50 || v2 > 150 {
+			t.Errorf("expected roughly 100 requests to v2 but got %d", v2)
+		}
+	})
+
+	t.Run("missing version falls back to the pool", func(t *testing.T) {
+		subject.Set(&api.Split{Service: "test", Weights: map[string]int{"v3": 1}})
+
+		result := subject.Split(httptest.NewRequest("GET", "/", nil), pool)
+
+		if len(result) != 3 {
+			t.Errorf("expected the whole pool but got %d", len(result))
+		}
+	})
+
+	t.Run("remove", func(t *testing.T) {
+		subject.Set(&api.Split{Service: "test", Weights: map[string]int{"v2": 1}})
+
+		result := subject.Split(httptest.NewRequest("GET", "/", nil), pool)
+
+		if len(result) != 1 {
+			t.Errorf("expected only v2 but got %d", len(result))
+		}
+
+		subject.Remove("test")
+
+		result = subject.Split(httptest.NewRequest("GET", "/", nil), pool)
+
+		if len(result) != 3 {
+			t.Errorf("expected the whole pool but got %d", len(result))
+		}
+	})
+
+	t.Run("invalid split", func(t *testing.T) {
+		err := subject.Set(&api.Split{Service: "test", Weights: map[string]int{"v1": -1}})
+
+		if err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
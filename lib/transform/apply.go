@@ -0,0 +1,278 @@
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/Meduzz/modulr/api"
+	"github.com/Meduzz/modulr/lib/router"
+	"github.com/Meduzz/modulr/lib/transport"
+)
+
+type (
+	readCloser struct {
+		io.Reader
+		io.Closer
+	}
+)
+
+// bodies larger than this are left as they were, unless the transform says otherwise
+const defaultMaxBody = int64(1024 * 1024)
+
+// Request - apply a transform to a request on its way to an instance of the service.
+// Bodies that can't be rewritten are left as they were, and the reason returned.
+func Request(req *http.Request, service api.Service, t *api.Transform) error {
+	headers(req.Header, service, t)
+
+	if !rewritesBody(t) || req.Body == nil || req.Body == http.NoBody || !isJSON(req.Header) {
+		return nil
+	}
+
+	bs, rest, err := read(req.Body, t.MaxBody)
+
+	if err != nil {
+		req.Body = rest
+		return err
+	}
+
+	rewritten, err := rewriteBody(bs, t)
+
+	if err != nil {
+		rewritten = bs
+	}
+
+	req.Body = io.NopCloser(bytes.NewReader(rewritten))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(rewritten)), nil
+	}
+	req.ContentLength = int64(len(rewritten))
+	req.Header.Set("Content-Length", strconv.Itoa(len(rewritten)))
+
+	return err
+}
+
+// Response - apply a transform to a response from an instance of the service.
+// Bodies that can't be rewritten are left as they were, and the reason returned.
+func Response(res *http.Response, service api.Service, t *api.Transform) error {
+	headers(res.Header, service, t)
+
+	if t.RewriteLocation {
+		rewriteLocation(res, service)
+	}
+
+	if !rewritesBody(t) || !hasBody(res) || !isJSON(res.Header) {
+		return nil
+	}
+
+	bs, rest, err := read(res.Body, t.MaxBody)
+
+	if err != nil {
+		res.Body = rest
+		return err
+	}
+
+	rewritten, err := rewriteBody(bs, t)
+
+	if err != nil {
+		rewritten = bs
+	}
+
+	res.Body = io.NopCloser(bytes.NewReader(rewritten))
+	res.ContentLength = int64(len(rewritten))
+	res.Header.Set("Content-Length", strconv.Itoa(len(rewritten)))
+	res.TransferEncoding = nil
+
+	return err
+}
+
+// read - read a body to rewrite it. Bodies larger than max are handed back as they were, along with the reason.
+func read(body io.ReadCloser, max int64) ([]byte, io.ReadCloser, error) {
+	if max <= 0 {
+		max = defaultMaxBody
+	}
+
+	bs, err := io.ReadAll(io.LimitReader(body, max+1))
+
+	if err == nil && int64(len(bs)) <= max {
+		body.Close()
+		return bs, nil, nil
+	}
+
+	if err == nil {
+		err = fmt.Errorf("body is larger than %d bytes", max)
+	}
+
+	// whatever was read followed by the rest of the body
+	return nil, readCloser{io.MultiReader(bytes.NewReader(bs), body), body}, err
+}
+
+func headers(header http.Header, service api.Service, t *api.Transform) {
+	for from, to := range t.RenameHeaders {
+		values := header.Values(from)
+
+		if len(values) == 0 {
+			continue
+		}
+
+		header.Del(from)
+
+		for _, it := range values {
+			header.Add(to, it)
+		}
+	}
+
+	for _, it := range t.RemoveHeaders {
+		header.Del(it)
+	}
+
+	for name, value := range t.SetHeaders {
+		header.Set(name, value)
+	}
+
+	if t.InstanceHeader != "" {
+		header.Set(t.InstanceHeader, service.GetID())
+	}
+}
+
+func rewritesBody(t *api.Transform) bool {
+	return t.UnwrapBody != "" || t.WrapBody != ""
+}
+
+// hasBody - upgrades, empty & compressed responses are left alone
+func hasBody(res *http.Response) bool {
+	if res.StatusCode == http.StatusSwitchingProtocols || res.StatusCode == http.StatusNoContent || res.StatusCode == http.StatusNotModified {
+		return false
+	}
+
+	if res.Request != nil && res.Request.Method == http.MethodHead {
+		return false
+	}
+
+	encoding := res.Header.Get("Content-Encoding")
+
+	return res.Body != nil && res.Body != http.NoBody && (encoding == "" || encoding == "identity")
+}
+
+func isJSON(header http.Header) bool {
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+
+	if err != nil {
+		return false
+	}
+
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// rewriteBody - unwrap first, then wrap. Values are kept as they were, numbers included.
+func rewriteBody(bs []byte, t *api.Transform) ([]byte, error) {
+	body := json.RawMessage(bs)
+
+	if t.UnwrapBody != "" {
+		for _, key := range strings.Split(t.UnwrapBody, ".") {
+			object := make(map[string]json.RawMessage)
+			err := json.Unmarshal(body, &object)
+
+			if err != nil {
+				return nil, fmt.Errorf("body is not an object with %s: %w", t.UnwrapBody, err)
+			}
+
+			value, ok := object[key]
+
+			if !ok {
+				return nil, fmt.Errorf("body has no %s", t.UnwrapBody)
+			}
+
+			body = value
+		}
+	}
+
+	if t.WrapBody != "" {
+		keys := strings.Split(t.WrapBody, ".")
+
+		for i := len(keys) - 1; i >= 0; i-- {
+			wrapped, err := json.Marshal(map[string]json.RawMessage{keys[i]: body})
+
+			if err != nil {
+				return nil, err
+			}
+
+			body = wrapped
+		}
+	}
+
+	return body, nil
+}
+
+// rewriteLocation - redirects to the instance, or to its context, are pointed back at the path the proxy takes
+// to reach the service. Locations elsewhere, or behind routes matched by regex, are left alone.
+func rewriteLocation(res *http.Response, service api.Service) {
+	location, err := url.Parse(res.Header.Get("Location"))
+
+	if err != nil || location.String() == "" {
+		return
+	}
+
+	if location.Host != "" {
+		requested := ""
+
+		if res.Request != nil {
+			requested = res.Request.Host
+		}
+
+		if location.Host != transport.Host(service) && location.Host != requested {
+			return
+		}
+	}
+
+	path := location.Path
+
+	if !strings.HasPrefix(path, "/") || !strings.HasPrefix(path, service.GetContext()) {
+		return
+	}
+
+	path = strings.TrimPrefix(path, service.GetContext())
+
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	var match *api.Match
+
+	if res.Request != nil {
+		match = router.MatchFrom(res.Request.Context())
+	}
+
+	if match == nil {
+		path = fmt.Sprintf("/call/%s%s", service.GetName(), path)
+	} else {
+		route := match.Route
+
+		switch {
+		case route.Regex != "":
+			return
+		case route.Rewrite != "":
+			if !strings.HasPrefix(path, route.Rewrite) {
+				return
+			}
+
+			path = route.Prefix + strings.TrimPrefix(path, route.Rewrite)
+		case route.StripPrefix:
+			path = strings.TrimSuffix(route.Prefix, "/") + path
+		}
+	}
+
+	location.Scheme = ""
+	location.Host = ""
+	location.User = nil
+	location.Path = path
+	location.RawPath = ""
+
+	res.Header.Set("Location", location.String())
+}
@@ -0,0 +1,91 @@
+package transform
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/Meduzz/modulr/api"
+	"github.com/Meduzz/modulr/lib/router"
+)
+
+type (
+	transformer struct {
+		transformations map[string]*api.Transformation // name -> transformation
+		lock            *sync.RWMutex
+	}
+)
+
+// NewTransformer - creates a new transformer without any transformations
+func NewTransformer() api.Transformer {
+	return &transformer{
+		transformations: make(map[string]*api.Transformation),
+		lock:            &sync.RWMutex{},
+	}
+}
+
+func (t *transformer) Set(transformation *api.Transformation) error {
+	if transformation.Name == "" {
+		return fmt.Errorf("transformation is missing a name")
+	}
+
+	if transformation.Service == "" {
+		return fmt.Errorf("transformation %s is missing a service", transformation.Name)
+	}
+
+	if transformation.Request != nil && transformation.Request.RewriteLocation {
+		return fmt.Errorf("transformation %s can only rewrite locations of responses", transformation.Name)
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.transformations[transformation.Name] = transformation
+
+	return nil
+}
+
+func (t *transformer) Remove(name string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	delete(t.transformations, name)
+}
+
+func (t *transformer) Transformations() []*api.Transformation {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	transformations := make([]*api.Transformation, 0, len(t.transformations))
+
+	for _, it := range t.transformations {
+		transformations = append(transformations, it)
+	}
+
+	sort.Slice(transformations, func(i, j int) bool {
+		return transformations[i].Name < transformations[j].Name
+	})
+
+	return transformations
+}
+
+func (t *transformer) For(name string, req *http.Request) []*api.Transformation {
+	match := router.MatchFrom(req.Context())
+	service := make([]*api.Transformation, 0)
+	route := make([]*api.Transformation, 0)
+
+	for _, it := range t.Transformations() {
+		if it.Service != name {
+			continue
+		}
+
+		if it.Route == "" {
+			service = append(service, it)
+		} else if match != nil && match.Route.Name == it.Route {
+			route = append(route, it)
+		}
+	}
+
+	return append(service, route...)
+}
@@ -0,0 +1,228 @@
+package transform
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Meduzz/modulr/api"
+	"github.com/Meduzz/modulr/lib/router"
+)
+
+func TestTransformer(t *testing.T) {
+	subject := NewTransformer()
+
+	subject.Set(&api.Transformation{Name: "b-route", Service: "test", Route: "users"})
+	subject.Set(&api.Transformation{Name: "c-service", Service: "test"})
+	subject.Set(&api.Transformation{Name: "a-other", Service: "other"})
+
+	t.Run("without a route", func(t *testing.T) {
+		found := subject.For("test", httptest.NewRequest("GET", "/call/test/", nil))
+
+		if len(found) != 1 || found[0].Name != "c-service" {
+			t.Errorf("expected only the service wide transformation but got %d", len(found))
+		}
+	})
+
+	t.Run("matched by a route", func(t *testing.T) {
+		req := router.WithMatch(httptest.NewRequest("GET", "/users", nil), &api.Match{Route: &api.Route{Name: "users"}, Path: "/users"})
+		found := subject.For("test", req)
+
+		if len(found) != 2 || found[0].Name != "c-service" || found[1].Name != "b-route" {
+			t.Errorf("expected the service wide transformation before the routes")
+		}
+	})
+
+	t.Run("invalid transformations", func(t *testing.T) {
+		if subject.Set(&api.Transformation{Service: "test"}) == nil {
+			t.Error("expected an error without name")
+		}
+
+		if subject.Set(&api.Transformation{Name: "x"}) == nil {
+			t.Error("expected an error without service")
+		}
+
+		if subject.Set(&api.Transformation{Name: "x", Service: "test", Request: &api.Transform{RewriteLocation: true}}) == nil {
+			t.Error("expected an error when rewriting locations of requests")
+		}
+	})
+}
+
+func TestRequest(t *testing.T) {
+	service := &api.DefaultService{ID: "42", Name: "test", Address: "10.0.0.1", Port: 8080, Scheme: "http"}
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"amount":12345678901234567890}`))
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("X-Old", "value")
+	req.Header.Set("X-Secret", "shh")
+
+	err := Request(req, service, &api.Transform{
+		RenameHeaders:  map[string]string{"X-Old": "X-New"},
+		RemoveHeaders:  []string{"X-Secret"},
+		SetHeaders:     map[string]string{"X-Added": "yes"},
+		InstanceHeader: "X-Instance",
+		WrapBody:       "data.payment",
+	})
+
+	if err != nil {
+		t.Errorf("There was an unexpected error: %v", err)
+	}
+
+	if req.Header.Get("X-New") != "value" || req.Header.Get("X-Old") != "" || req.Header.Get("X-Secret") != "" {
+		t.Errorf("unexpected headers %v", req.Header)
+	}
+
+	if req.Header.Get("X-Added") != "yes" || req.Header.Get("X-Instance") != "42" {
+		t.Errorf("unexpected headers %v", req.Header)
+	}
+
+	bs, _ := io.ReadAll(req.Body)
+	expected := `{"data":{"payment":{"amount":12345678901234567890}}}`
+
+	if string(bs) != expected || req.ContentLength != int64(len(expected)) {
+		t.Errorf("unexpected body %s", string(bs))
+	}
+
+	t.Run("bodies that can't be unwrapped", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(`[1,2,3]`))
+		req.Header.Set("Content-Type", "application/json")
+
+		err := Request(req, service, &api.Transform{UnwrapBody: "data"})
+
+		if err == nil {
+			t.Error("expected an error")
+		}
+
+		bs, _ := io.ReadAll(req.Body)
+
+		if string(bs) != `[1,2,3]` {
+			t.Errorf("expected the body to be left alone but got %s", string(bs))
+		}
+	})
+
+	t.Run("bodies that are too large", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(`{"data":"too large"}`))
+		req.Header.Set("Content-Type", "application/json")
+
+		err := Request(req, service, &api.Transform{UnwrapBody: "data", MaxBody: 8})
+
+		if err == nil {
+			t.Error("expected an error")
+		}
+
+		bs, _ := io.ReadAll(req.Body)
+
+		if string(bs) != `{"data":"too large"}` {
+			t.Errorf("expected the body to be left alone but got %s", string(bs))
+		}
+	})
+
+	t.Run("bodies that are not json", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(`{"data":1}`))
+		req.Header.Set("Content-Type", "text/plain")
+
+		Request(req, service, &api.Transform{UnwrapBody: "data"})
+		bs, _ := io.ReadAll(req.Body)
+
+		if string(bs) != `{"data":1}` {
+			t.Errorf("expected the body to be left alone but got %s", string(bs))
+		}
+	})
+}
+
+func TestResponse(t *testing.T) {
+	service := &api.DefaultService{ID: "42", Name: "test", Address: "10.0.0.1", Port: 8080, Scheme: "http", Context: "/app"}
+
+	response := func(req *http.Request, status int, body string, headers ...string) *http.Response {
+		res := &http.Response{
+			StatusCode: status,
+			Header:     http.Header{},
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Request:    req,
+		}
+
+		for i := 0; i+1 < len(headers); i += 2 {
+			res.Header.Set(headers[i], headers[i+1])
+		}
+
+		return res
+	}
+
+	t.Run("envelopes", func(t *testing.T) {
+		res := response(httptest.NewRequest("GET", "/", nil), 200, `{"status":"ok","data":{"items":[1,2]}}`, "Content-Type", "application/vnd.api+json")
+
+		err := Response(res, service, &api.Transform{UnwrapBody: "data.items"})
+
+		if err != nil {
+			t.Errorf("There was an unexpected error: %v", err)
+		}
+
+		bs, _ := io.ReadAll(res.Body)
+
+		if string(bs) != `[1,2]` || res.Header.Get("Content-Length") != "5" {
+			t.Errorf("unexpected body %s", string(bs))
+		}
+	})
+
+	t.Run("bodies that are too large", func(t *testing.T) {
+		res := response(httptest.NewRequest("GET", "/", nil), 200, `{"data":"too large"}`, "Content-Type", "application/json")
+
+		err := Response(res, service, &api.Transform{UnwrapBody: "data", MaxBody: 8})
+
+		if err == nil {
+			t.Error("expected an error")
+		}
+
+		bs, _ := io.ReadAll(res.Body)
+
+		if string(bs) != `{"data":"too large"}` {
+			t.Errorf("expected the body to be left alone but got %s", string(bs))
+		}
+	})
+
+	t.Run("compressed bodies", func(t *testing.T) {
+		res := response(httptest.NewRequest("GET", "/", nil), 200, "gzipped", "Content-Type", "application/json", "Content-Encoding", "gzip")
+
+		Response(res, service, &api.Transform{UnwrapBody: "data"})
+		bs, _ := io.ReadAll(res.Body)
+
+		if string(bs) != "gzipped" {
+			t.Error("expected compressed bodies to be left alone")
+		}
+	})
+
+	locations := []struct {
+		name     string
+		match    *api.Match
+		location string
+		expected string
+	}{
+		{"to the instance", nil, "http://10.0.0.1:8080/app/login?next=/x", "/call/test/login?next=/x"},
+		{"relative to the instance", nil, "/app/login", "/call/test/login"},
+		{"somewhere else", nil, "https://idp.example.com/login", "https://idp.example.com/login"},
+		{"outside the context", nil, "/other", "/other"},
+		{"behind a route", &api.Match{Route: &api.Route{Name: "r", Prefix: "/api"}}, "/app/api/users", "/api/users"},
+		{"behind a stripping route", &api.Match{Route: &api.Route{Name: "r", Prefix: "/api/", StripPrefix: true}}, "/app/users", "/api/users"},
+		{"behind a rewriting route", &api.Match{Route: &api.Route{Name: "r", Prefix: "/api", Rewrite: "/v2"}}, "/app/v2/users", "/api/users"},
+		{"behind a regex route", &api.Match{Route: &api.Route{Name: "r", Regex: "^/x"}}, "/app/users", "/app/users"},
+	}
+
+	for _, it := range locations {
+		t.Run(it.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+
+			if it.match != nil {
+				req = router.WithMatch(req, it.match)
+			}
+
+			res := response(req, 302, "", "Location", it.location)
+			Response(res, service, &api.Transform{RewriteLocation: true})
+
+			if res.Header.Get("Location") != it.expected {
+				t.Errorf("expected %s but got %s", it.expected, res.Header.Get("Location"))
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package transport
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/Meduzz/modulr/api"
+	"github.com/Meduzz/modulr/lib/certs"
+)
+
+type (
+	upstreamTLS struct {
+		settings map[string]*api.TLSSettings // service name -> settings
+		configs  map[string]*tls.Config      // service name -> config
+		lock     *sync.RWMutex
+	}
+)
+
+const (
+	// VerifyFull - verify the chain & the hostname of the instance
+	VerifyFull = "full"
+	// VerifyChain - verify the chain but not the hostname, for instances that are reached by ip
+	VerifyChain = "chain"
+	// VerifyNone - trust whatever the instance presents
+	VerifyNone = "none"
+)
+
+// NewUpstreamTLS - creates a new in memory store of upstream tls settings
+func NewUpstreamTLS() api.UpstreamTLS {
+	return &upstreamTLS{
+		settings: make(map[string]*api.TLSSettings),
+		configs:  make(map[string]*tls.Config),
+		lock:     &sync.RWMutex{},
+	}
+}
+
+func (u *upstreamTLS) Config(name string) *tls.Config {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	return u.configs[name]
+}
+
+func (u *upstreamTLS) Set(settings *api.TLSSettings) error {
+	if settings.Service == "" {
+		return fmt.Errorf("tls settings are missing a service")
+	}
+
+	config, err := configFor(settings)
+
+	if err != nil {
+		return err
+	}
+
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	u.settings[settings.Service] = settings
+	u.configs[settings.Service] = config
+
+	return nil
+}
+
+func (u *upstreamTLS) Remove(name string) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	delete(u.settings, name)
+	delete(u.configs, name)
+}
+
+func (u *upstreamTLS) Settings() []*api.TLSSettings {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	settings := make([]*api.TLSSettings, 0, len(u.settings))
+
+	for _, it := range u.settings {
+		settings = append(settings, it)
+	}
+
+	sort.Slice(settings, func(i, j int) bool {
+		return settings[i].Service < settings[j].Service
+	})
+
+	return settings
+}
+
+// configFor - verification is done by hand so that the CA bundle can be reloaded between handshakes
+func configFor(settings *api.TLSSettings) (*tls.Config, error) {
+	verify := settings.Verify
+
+	if verify == "" {
+		verify = VerifyFull
+	}
+
+	if verify != VerifyFull && verify != VerifyChain && verify != VerifyNone {
+		return nil, fmt.Errorf("unknown verify mode %s", verify)
+	}
+
+	if (settings.Cert == "") != (settings.Key == "") {
+		return nil, fmt.Errorf("a client certificate needs both cert and key")
+	}
+
+	config := &tls.Config{
+		ServerName:         settings.ServerName,
+		InsecureSkipVerify: true,
+	}
+
+	if settings.Cert != "" {
+		pair, err := certs.LoadKeyPair(settings.Cert, settings.Key)
+
+		if err != nil {
+			return nil, err
+		}
+
+		config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return pair.Certificate()
+		}
+	}
+
+	var pool *certs.Pool
+
+	if settings.CA != "" {
+		var err error
+		pool, err = certs.LoadPool(settings.CA)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if verify == VerifyNone {
+		return config, nil
+	}
+
+	config.VerifyConnection = func(state tls.ConnectionState) error {
+		if len(state.PeerCertificates) == 0 {
+			return fmt.Errorf("the instance did not present a certificate")
+		}
+
+		opts := x509.VerifyOptions{
+			Intermediates: x509.NewCertPool(),
+		}
+
+		if pool != nil {
+			roots, err := pool.Pool()
+
+			if err != nil {
+				return err
+			}
+
+			opts.Roots = roots
+		}
+
+		if verify == VerifyFull {
+			// ServerName is left empty for ips, ForHost puts back the host that was dialed
+			if state.ServerName == "" {
+				return fmt.Errorf("there is no host to verify the certificate of the instance against")
+			}
+
+			opts.DNSName = state.ServerName
+		}
+
+		for _, cert := range state.PeerCertificates[1:] {
+			opts.Intermediates.AddCert(cert)
+		}
+
+		_, err := state.PeerCertificates[0].Verify(opts)
+
+		return err
+	}
+
+	return config, nil
+}
+
+// ForHost - a copy of config that verifies the instance against host, unless the config names a server of its own.
+// The handshake only reports the server name when it is a hostname, so this is how ips get verified.
+func ForHost(config *tls.Config, host string) *tls.Config {
+	clone := config.Clone()
+
+	if clone.ServerName == "" {
+		clone.ServerName = host
+	}
+
+	verify := config.VerifyConnection
+
+	if verify != nil {
+		name := clone.ServerName
+		clone.VerifyConnection = func(state tls.ConnectionState) error {
+			state.ServerName = name
+			return verify(state)
+		}
+	}
+
+	return clone
+}
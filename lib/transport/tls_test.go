@@ -0,0 +1,272 @@
+package transport
+
+import (
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Meduzz/modulr/api"
+	"github.com/Meduzz/modulr/internal/testca"
+)
+
+func TestUpstreamTLS(t *testing.T) {
+	ca := testca.New(t)
+	dir := t.TempDir()
+
+	serverCert, serverKey := ca.Issue(t, "localhost", false)
+	server, err := tls.X509KeyPair(serverCert, serverKey)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(req.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	upstream.TLS = &tls.Config{
+		Certificates: []tls.Certificate{server},
+		ClientCAs:    ca.Pool(),
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	upstream.EnableHTTP2 = true
+	upstream.StartTLS()
+	defer upstream.Close()
+
+	service := serviceFor(upstream.URL)
+
+	caFile := write(t, dir, "ca.pem", ca.PEM)
+	clientCert, clientKey := ca.Issue(t, "client", true)
+	certFile := write(t, dir, "client.pem", clientCert)
+	keyFile := write(t, dir, "client.key", clientKey)
+
+	settings := NewUpstreamTLS()
+	subject := NewTransports(settings)
+
+	t.Run("without settings", func(t *testing.T) {
+		_, err := call(subject, service, upstream.URL)
+
+		if err == nil {
+			t.Error("expected an error")
+		}
+	})
+
+	t.Run("mutual tls", func(t *testing.T) {
+		err := settings.Set(&api.TLSSettings{Service: "test", CA: caFile, Cert: certFile, Key: keyFile, ServerName: "localhost"})
+
+		if err != nil {
+			t.Fatalf("There was an unexpected error: %v", err)
+		}
+
+		body, err := call(subject, service, upstream.URL)
+
+		if err != nil {
+			t.Fatalf("There was an unexpected error: %v", err)
+		}
+
+		if body != "client" {
+			t.Errorf("expected the client certificate to be presented but got %s", body)
+		}
+	})
+
+	t.Run("http/2 uses the settings too", func(t *testing.T) {
+		res, err := (&http.Client{Transport: subject.H2(service)}).Get(upstream.URL)
+
+		if err != nil {
+			t.Fatalf("There was an unexpected error: %v", err)
+		}
+
+		defer res.Body.Close()
+		bs, _ := io.ReadAll(res.Body)
+
+		if res.ProtoMajor != 2 || string(bs) != "client" {
+			t.Errorf("expected the client certificate to be presented over http/2 but got %s %s", res.Proto, string(bs))
+		}
+	})
+
+	t.Run("hostname is verified", func(t *testing.T) {
+		settings.Set(&api.TLSSettings{Service: "test", CA: caFile, Cert: certFile, Key: keyFile, ServerName: "other"})
+
+		_, err := call(subject, service, upstream.URL)
+
+		if err == nil {
+			t.Error("expected an error")
+		}
+	})
+
+	t.Run("ips are verified", func(t *testing.T) {
+		settings.Set(&api.TLSSettings{Service: "test", CA: caFile, Cert: certFile, Key: keyFile})
+
+		_, err := call(subject, service, upstream.URL)
+
+		if err != nil {
+			t.Errorf("There was an unexpected error: %v", err)
+		}
+
+		otherCert, otherKey := ca.Issue(t, "other", false)
+		other, err := tls.X509KeyPair(otherCert, otherKey)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		impostor := httptest.NewUnstartedServer(http.NotFoundHandler())
+		impostor.TLS = &tls.Config{Certificates: []tls.Certificate{other}}
+		impostor.StartTLS()
+		defer impostor.Close()
+
+		_, err = call(subject, serviceFor(impostor.URL), impostor.URL)
+
+		if err == nil {
+			t.Error("expected an error")
+		}
+	})
+
+	t.Run("chain only skips the hostname", func(t *testing.T) {
+		settings.Set(&api.TLSSettings{Service: "test", CA: caFile, Cert: certFile, Key: keyFile, ServerName: "other", Verify: VerifyChain})
+
+		_, err := call(subject, service, upstream.URL)
+
+		if err != nil {
+			t.Errorf("There was an unexpected error: %v", err)
+		}
+	})
+
+	t.Run("none skips verification", func(t *testing.T) {
+		settings.Set(&api.TLSSettings{Service: "test", Cert: certFile, Key: keyFile, Verify: VerifyNone})
+
+		_, err := call(subject, service, upstream.URL)
+
+		if err != nil {
+			t.Errorf("There was an unexpected error: %v", err)
+		}
+	})
+
+	t.Run("files are reloaded", func(t *testing.T) {
+		settings.Set(&api.TLSSettings{Service: "test", CA: caFile, Cert: certFile, Key: keyFile, ServerName: "localhost"})
+
+		// a client certificate from another CA is rejected by the instance
+		other := testca.New(t)
+		otherCert, otherKey := other.Issue(t, "other", true)
+		rewrite(t, certFile, otherCert)
+		rewrite(t, keyFile, otherKey)
+
+		_, err := call(subject, service, upstream.URL)
+
+		if err == nil {
+			t.Error("expected an error")
+		}
+
+		// and a CA bundle without the CA of the instance rejects it
+		rewrite(t, certFile, clientCert)
+		rewrite(t, keyFile, clientKey)
+		rewrite(t, caFile, other.PEM)
+
+		_, err = call(subject, service, upstream.URL)
+
+		if err == nil {
+			t.Error("expected an error")
+		}
+
+		rewrite(t, caFile, ca.PEM)
+
+		_, err = call(subject, service, upstream.URL)
+
+		if err != nil {
+			t.Errorf("There was an unexpected error: %v", err)
+		}
+	})
+
+	t.Run("invalid settings", func(t *testing.T) {
+		invalid := []*api.TLSSettings{
+			{CA: caFile},
+			{Service: "test", Verify: "maybe"},
+			{Service: "test", Cert: certFile},
+			{Service: "test", CA: filepath.Join(dir, "missing.pem")},
+			{Service: "test", CA: keyFile},
+		}
+
+		for _, it := range invalid {
+			err := settings.Set(it)
+
+			if err == nil {
+				t.Errorf("expected an error for %+v", it)
+			}
+		}
+	})
+
+	t.Run("removed settings", func(t *testing.T) {
+		settings.Remove("test")
+
+		if len(settings.Settings()) != 0 {
+			t.Error("the settings were not removed")
+		}
+
+		if subject.For(service) != http.DefaultTransport {
+			t.Error("expected the default transport")
+		}
+	})
+}
+
+// call - does a GET on fresh connections, so that every call does a handshake
+func call(transports *Transports, service api.Service, url string) (string, error) {
+	transport := transports.For(service)
+
+	if it, ok := transport.(*http.Transport); ok {
+		it.CloseIdleConnections()
+	}
+
+	res, err := (&http.Client{Transport: transport}).Get(url)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer res.Body.Close()
+	bs := make([]byte, 64)
+	n, _ := res.Body.Read(bs)
+
+	return string(bs[:n]), nil
+}
+
+func write(t *testing.T, dir, name string, bs []byte) string {
+	path := filepath.Join(dir, name)
+	err := os.WriteFile(path, bs, 0600)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+// rewrite - replace a file, making sure its modification time moves forward
+func rewrite(t *testing.T, path string, bs []byte) {
+	info, err := os.Stat(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(path, bs, 0600)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	modified := info.ModTime().Add(time.Second)
+	os.Chtimes(path, modified, modified)
+}
+
+func serviceFor(raw string) *api.DefaultService {
+	u, _ := url.Parse(raw)
+	port, _ := strconv.Atoi(u.Port())
+
+	return &api.DefaultService{ID: "1", Name: "test", Address: u.Hostname(), Port: port, Scheme: "https", Type: "http"}
+}
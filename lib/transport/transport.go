@@ -0,0 +1,299 @@
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/Meduzz/modulr/api"
+	"golang.org/x/net/http2"
+)
+
+type (
+	// Transports - hands out the http transport to reach a service with
+	Transports struct {
+		tls        api.UpstreamTLS
+		transports map[string]*cached   // service name & socket -> transport
+		h2         map[string]*cachedH2 // scheme, service name & socket -> http/2 transport
+		h2c        *http2.Transport     // cleartext http/2 for services without tls settings
+		h2tls      *http2.Transport     // http/2 over tls for services without tls settings
+		lock       *sync.Mutex
+	}
+
+	cached struct {
+		transport *http.Transport
+		config    *tls.Config
+	}
+
+	cachedH2 struct {
+		transport *http2.Transport
+		config    *tls.Config
+	}
+
+	// target - what DialContext & DialTLSContext should dial
+	target struct {
+		socket string
+		config *tls.Config
+	}
+
+	targetKey struct{}
+)
+
+// Unix - the scheme of services listening on a unix socket, the address of the service is the path to the socket
+const Unix = "unix"
+
+// NewTransports - creates a new cache of transports, using the tls settings of services
+func NewTransports(upstreamTLS api.UpstreamTLS) *Transports {
+	return &Transports{
+		tls:        upstreamTLS,
+		transports: make(map[string]*cached),
+		h2:         make(map[string]*cachedH2),
+		h2c:        newH2(nil, false, (&net.Dialer{}).DialContext),
+		h2tls:      newH2(nil, true, (&net.Dialer{}).DialContext),
+		lock:       &sync.Mutex{},
+	}
+}
+
+// For - the transport to reach the service with, services with tls settings and unix sockets get a transport of their own
+func (t *Transports) For(service api.Service) http.RoundTripper {
+	config := t.tls.Config(service.GetName())
+
+	if config == nil && !IsUnix(service) {
+		return http.DefaultTransport
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	key := cacheKey(service)
+	it, ok := t.transports[key]
+
+	// the tls settings changed since the transport was created
+	if ok && it.config != config {
+		it.transport.CloseIdleConnections()
+		ok = false
+	}
+
+	if !ok {
+		it = &cached{
+			transport: http.DefaultTransport.(*http.Transport).Clone(),
+			config:    config,
+		}
+
+		it.transport.TLSClientConfig = config
+
+		if IsUnix(service) {
+			path := service.GetAddress()
+			it.transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, Unix, path)
+			}
+		}
+
+		// the handshake is done here rather than by the transport, so that instances reached by ip are verified too
+		if config != nil {
+			transport := it.transport
+			transport.DialTLSContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return dialTLS(ctx, network, addr, transport.TLSClientConfig, transport.DialContext)
+			}
+		}
+
+		t.transports[key] = it
+	}
+
+	return it.transport
+}
+
+// H2 - the http/2 transport to reach the service with, cleartext (h2c) unless the service wants https.
+// Like with For, services with tls settings and unix sockets get a transport of their own.
+func (t *Transports) H2(service api.Service) http.RoundTripper {
+	config := t.tls.Config(service.GetName())
+	secure := Scheme(service) == "https"
+
+	if config == nil && !IsUnix(service) {
+		if secure {
+			return t.h2tls
+		}
+
+		return t.h2c
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	key := h2Key(service)
+	it, ok := t.h2[key]
+
+	// the tls settings changed since the transport was created
+	if ok && it.config != config {
+		it.transport.CloseIdleConnections()
+		ok = false
+	}
+
+	if !ok {
+		dial := (&net.Dialer{}).DialContext
+
+		if IsUnix(service) {
+			path := service.GetAddress()
+			dial = func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, Unix, path)
+			}
+		}
+
+		it = &cachedH2{
+			transport: newH2(config, secure, dial),
+			config:    config,
+		}
+
+		t.h2[key] = it
+	}
+
+	return it.transport
+}
+
+// Forget - drop the transports of a unix socket, closing their idle connections
+func (t *Transports) Forget(service api.Service) {
+	if !IsUnix(service) {
+		return
+	}
+
+	t.lock.Lock()
+	it, ok := t.transports[cacheKey(service)]
+	delete(t.transports, cacheKey(service))
+	h2, h2ok := t.h2[h2Key(service)]
+	delete(t.h2, h2Key(service))
+	t.lock.Unlock()
+
+	if ok {
+		it.transport.CloseIdleConnections()
+	}
+
+	if h2ok {
+		h2.transport.CloseIdleConnections()
+	}
+}
+
+// WithService - makes DialContext & DialTLSContext reach the service like its transport would
+func (t *Transports) WithService(ctx context.Context, service api.Service) context.Context {
+	it := &target{
+		config: t.tls.Config(service.GetName()),
+	}
+
+	if IsUnix(service) {
+		it.socket = service.GetAddress()
+	}
+
+	return context.WithValue(ctx, targetKey{}, it)
+}
+
+// IsUnix - the service listens on a unix socket
+func IsUnix(service api.Service) bool {
+	return service.GetScheme() == Unix
+}
+
+// Scheme - the url scheme to call the service with, unix sockets speak plain http
+func Scheme(service api.Service) string {
+	if IsUnix(service) {
+		return "http"
+	}
+
+	return service.GetScheme()
+}
+
+// Host - the url host to call the service with, unix sockets use the name of the service
+func Host(service api.Service) string {
+	if IsUnix(service) {
+		return service.GetName()
+	}
+
+	if service.GetPort() != 0 {
+		return fmt.Sprintf("%s:%d", service.GetAddress(), service.GetPort())
+	}
+
+	return service.GetAddress()
+}
+
+// DialContext - dials the unix socket set with WithService, or the address given when there is none.
+// Meant for dialers that can't be handed a transport, like the one websockets are dialed with.
+func DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	it, ok := ctx.Value(targetKey{}).(*target)
+
+	if ok && it.socket != "" {
+		return (&net.Dialer{}).DialContext(ctx, Unix, it.socket)
+	}
+
+	return (&net.Dialer{}).DialContext(ctx, network, addr)
+}
+
+// DialTLSContext - like DialContext, but does a http/1.1 tls handshake with the tls config set with WithService
+func DialTLSContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	config := &tls.Config{}
+	it, ok := ctx.Value(targetKey{}).(*target)
+
+	if ok && it.config != nil {
+		config = it.config.Clone()
+	}
+
+	config.NextProtos = []string{"http/1.1"}
+
+	return dialTLS(ctx, network, addr, config, DialContext)
+}
+
+// dialTLS - dials addr and does the handshake, verifying the instance against the host that was dialed
+func dialTLS(ctx context.Context, network, addr string, config *tls.Config, dial func(context.Context, string, string) (net.Conn, error)) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(addr)
+
+	if err != nil {
+		host = addr
+	}
+
+	conn, err := dial(ctx, network, addr)
+
+	if err != nil {
+		return nil, err
+	}
+
+	client := tls.Client(conn, ForHost(config, host))
+	err = client.HandshakeContext(ctx)
+
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// newH2 - a http/2 transport that dials with dial, h2c is had by dialing without a handshake
+func newH2(config *tls.Config, secure bool, dial func(context.Context, string, string) (net.Conn, error)) *http2.Transport {
+	if !secure {
+		return &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				return dial(ctx, network, addr)
+			},
+		}
+	}
+
+	return &http2.Transport{
+		TLSClientConfig: config,
+		// the config handed to us is TLSClientConfig asking for h2, the handshake is ours so ips are verified too
+		DialTLSContext: func(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+			return dialTLS(ctx, network, addr, cfg, dial)
+		},
+	}
+}
+
+func h2Key(service api.Service) string {
+	return fmt.Sprintf("%s %s", Scheme(service), cacheKey(service))
+}
+
+func cacheKey(service api.Service) string {
+	if IsUnix(service) {
+		return fmt.Sprintf("%s %s", service.GetName(), service.GetAddress())
+	}
+
+	return service.GetName()
+}